@@ -3,27 +3,42 @@ package app
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/mihailtudos/gophermart/internal/app/accrual"
 	"github.com/mihailtudos/gophermart/internal/config"
 	"github.com/mihailtudos/gophermart/internal/delivery"
+	"github.com/mihailtudos/gophermart/internal/domain"
 	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/notifier"
 	"github.com/mihailtudos/gophermart/internal/repository"
 	"github.com/mihailtudos/gophermart/internal/server"
 	"github.com/mihailtudos/gophermart/internal/service"
 	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/internal/service/events"
+	"github.com/mihailtudos/gophermart/internal/service/throttle"
+	"github.com/mihailtudos/gophermart/pkg/hash"
+	"github.com/mihailtudos/gophermart/pkg/oidc"
 )
 
+// oidcProviderTimeout bounds the requests to the OpenID provider
+const oidcProviderTimeout = 10 * time.Second
+
 func Run() error {
 	cfg := config.NewConfig()
 	logger.Init(nil, cfg.Logger.Level)
 
+	if err := cfg.Auth.Validate(); err != nil {
+		return err
+	}
+
 	// Create a context that will be canceled on shutdown signal
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -41,20 +56,143 @@ func Run() error {
 		return errors.New("failed to initialize accrual client")
 	}
 
-	tms, err := auth.NewManager(cfg.Auth.JWT)
+	if err := domain.SetPasswordCost(cfg.Auth.Password.BcryptCost); err != nil {
+		return err
+	}
+
+	tms, err := auth.NewManager(cfg.Auth.JWT, hash.NewSHA256Hasher(cfg.Auth.PasswordSalt))
+	if err != nil {
+		return err
+	}
+
+	broker := events.NewBroker()
+
+	webhookService, err := service.NewWebhookService(repos.WebhookRepo, cfg.Webhook)
+	if err != nil {
+		return err
+	}
+
+	revocations, err := service.NewRevocationList(repos.RevocationRepo, cfg.Auth.JWT.AccessTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	if err := revocations.Refresh(ctx); err != nil {
+		logger.Log.ErrorContext(ctx,
+			"failed to load token revocations",
+			slog.String("err", err.Error()))
+		return err
+	}
+
+	limiter, err := throttle.NewLimiter(repos.LoginAttemptsRepo, cfg.Auth.LoginThrottle)
+	if err != nil {
+		return err
+	}
+
+	userService, err := service.NewUserService(repos.UserRepo, tms, broker, revocations, limiter,
+		cfg.Auth.EmailVerification.RequiredForWithdrawals)
+	if err != nil {
+		return err
+	}
+
+	sender, err := notifier.New(cfg.Notifier)
 	if err != nil {
 		return err
 	}
 
-	userService, err := service.NewUserService(repos.UserRepo, tms)
+	resetLimiter, err := throttle.NewScopedLimiter(repos.LoginAttemptsRepo, "password-reset",
+		cfg.Auth.PasswordReset.Throttle)
 	if err != nil {
 		return err
 	}
 
+	passwordResetService, err := service.NewPasswordResetService(repos.PasswordResetRepo,
+		userService, tms, revocations, resetLimiter, sender, cfg.Auth.PasswordReset)
+	if err != nil {
+		return err
+	}
+
+	twoFactorService, err := service.NewTwoFactorService(repos.TwoFactorRepo,
+		userService, tms, limiter, cfg.Auth.TwoFactor)
+	if err != nil {
+		return err
+	}
+
+	apiKeyService, err := service.NewAPIKeyService(repos.APIKeyRepo, tms)
+	if err != nil {
+		return err
+	}
+
+	adminService, err := service.NewAdminService(repos.AdminRepo, userService, broker)
+	if err != nil {
+		return err
+	}
+
+	verificationLimiter, err := throttle.NewScopedLimiter(repos.LoginAttemptsRepo, "email-verification",
+		cfg.Auth.EmailVerification.Throttle)
+	if err != nil {
+		return err
+	}
+
+	emailVerificationService, err := service.NewEmailVerificationService(repos.EmailVerificationRepo,
+		userService, verificationLimiter, sender, cfg.Auth.EmailVerification)
+	if err != nil {
+		return err
+	}
+
+	accountService, err := service.NewAccountService(repos.AccountRepo, userService, emailVerificationService)
+	if err != nil {
+		return err
+	}
+
+	passwordPolicy, err := service.NewPasswordPolicy(cfg.Auth.Password)
+	if err != nil {
+		return err
+	}
+
+	// the interface is left nil, not set to a nil service, while no provider is configured
+	var oidcManager delivery.OIDCManager
+	if cfg.Auth.OIDC.Issuer != "" {
+		provider, err := oidc.NewProvider(ctx, oidc.Config{
+			Issuer:       cfg.Auth.OIDC.Issuer,
+			ClientID:     cfg.Auth.OIDC.ClientID,
+			ClientSecret: cfg.Auth.OIDC.ClientSecret,
+			RedirectURL:  cfg.Auth.OIDC.RedirectURL,
+			Scopes:       cfg.Auth.OIDC.Scopes,
+		}, &http.Client{Timeout: oidcProviderTimeout})
+		if err != nil {
+			logger.Log.ErrorContext(ctx,
+				"failed to init oidc provider",
+				slog.String("err", err.Error()))
+			return err
+		}
+
+		oidcLimiter, err := throttle.NewRateLimiter(cfg.Auth.OIDC.StartLimit, cfg.Auth.OIDC.StartWindow)
+		if err != nil {
+			return err
+		}
+
+		oidcService, err := service.NewOIDCService(repos.OIDCRepo, userService, twoFactorService, provider, tms,
+			oidcLimiter, cfg.Auth.OIDC)
+		if err != nil {
+			return err
+		}
+
+		oidcLimiter.CleanupInBackground(ctx, 1*time.Minute)
+
+		oidcManager = oidcService
+	}
+
 	ss, err := service.NewServices(userService, tms, accrualClient)
 
 	// starting the backgorun process
 	ss.UpdateOrdersInBackground(ctx, 1*time.Second)
+	webhookService.DeliverWebhooksInBackground(ctx, 1*time.Second)
+	tms.ReloadKeysInBackground(ctx, cfg.Auth.JWT.KeysReloadInterval)
+	revocations.RefreshInBackground(ctx, cfg.Auth.RevocationRefreshInterval)
+	limiter.CleanupInBackground(ctx, 1*time.Minute)
+	resetLimiter.CleanupInBackground(ctx, 1*time.Minute)
+	verificationLimiter.CleanupInBackground(ctx, 1*time.Minute)
 
 	if err != nil {
 		logger.Log.ErrorContext(ctx,
@@ -63,7 +201,24 @@ func Run() error {
 		return err
 	}
 
-	srv := server.NewServer(cfg.HTTP, delivery.NewHandler(ss.UserService, ss.UserService))
+	cookies, err := cookieOptions(cfg.Auth)
+	if err != nil {
+		return err
+	}
+
+	srv := server.NewServer(cfg.HTTP, delivery.NewHandler(ss.UserService,
+		ss.UserService,
+		webhookService,
+		tms,
+		passwordResetService,
+		twoFactorService,
+		apiKeyService,
+		adminService,
+		accountService,
+		emailVerificationService,
+		oidcManager,
+		passwordPolicy,
+		delivery.Options{AllowedOrigins: cfg.HTTP.AllowedOrigins, Cookies: cookies}))
 
 	go func() {
 		if err := srv.Run(); !errors.Is(err, http.ErrServerClosed) {
@@ -81,6 +236,9 @@ func Run() error {
 	// Trigger the context cancellation to stop the background process
 	cancel()
 
+	// closing the event streams, otherwise they would hold the server shutdown
+	broker.Close()
+
 	const timeout = 5 * time.Second
 	ctx, shutdown := context.WithTimeout(ctx, timeout)
 	defer shutdown()
@@ -97,3 +255,31 @@ func Run() error {
 
 	return nil
 }
+
+// cookieOptions maps the cookie session mode config to the delivery options.
+func cookieOptions(cfg config.AuthConfig) (delivery.CookieOptions, error) {
+	opts := delivery.CookieOptions{
+		Enabled:         cfg.Cookie.Enabled,
+		Secure:          cfg.Cookie.Secure,
+		AccessTokenTTL:  cfg.JWT.AccessTokenTTL,
+		RefreshTokenTTL: cfg.JWT.RefreshTokenTTL,
+	}
+
+	switch strings.ToLower(cfg.Cookie.SameSite) {
+	case "lax":
+		opts.SameSite = http.SameSiteLaxMode
+	case "strict":
+		opts.SameSite = http.SameSiteStrictMode
+	case "none":
+		// browsers drop SameSite=None cookies which are not secure
+		if !cfg.Cookie.Secure {
+			return delivery.CookieOptions{}, errors.New("the none cookie SameSite mode requires secure cookies")
+		}
+
+		opts.SameSite = http.SameSiteNoneMode
+	default:
+		return delivery.CookieOptions{}, fmt.Errorf("unknown cookie SameSite mode %q", cfg.Cookie.SameSite)
+	}
+
+	return opts, nil
+}
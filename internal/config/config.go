@@ -1,9 +1,12 @@
 package config
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,15 +16,79 @@ import (
 const (
 	defaultLoggerlevel = "info"
 
+	// MinSecretLength is the shortest key accepted for the secrets keying the hashes and signatures.
+	MinSecretLength = 32
+
 	defaultHTTPPort           = ":8080"
 	defaultHTTPMaxHeaderBytes = 1
 	defaultHTTPReadTimeout    = "10s"
 	defaultHTTPWriteTimeout   = "10s"
 
-	defaultJWTAccessTokenTTL  = "2h"
-	defaultJWTRefreshTokenTTL = "720h"
+	defaultJWTAccessTokenTTL     = "2h"
+	defaultJWTRefreshTokenTTL    = "720h"
+	defaultJWTKeysReloadInterval = "1m"
+
+	defaultRevocationRefreshInterval = "15s"
+
+	defaultCookieSameSite = "lax"
+
+	defaultPasswordBcryptCost       = 12
+	defaultPasswordMinLength        = 8
+	defaultPasswordMinCharClasses   = 2
+	defaultPasswordBreachedMinCount = 1
+
+	defaultLoginThrottleFreeAttempts       = 3
+	defaultLoginThrottleBaseDelay          = "1s"
+	defaultLoginThrottleMaxDelay           = "1m"
+	defaultLoginThrottleLoginLockThreshold = 10
+	defaultLoginThrottleIPLockThreshold    = 100
+	defaultLoginThrottleLockoutDuration    = "15m"
+	defaultLoginThrottleFailureWindow      = "1h"
+
+	defaultPasswordResetTokenTTL = "30m"
+	defaultPasswordResetURL      = "http://localhost:8080/reset-password"
+
+	defaultPasswordResetThrottleFreeAttempts       = 2
+	defaultPasswordResetThrottleBaseDelay          = "1m"
+	defaultPasswordResetThrottleMaxDelay           = "10m"
+	defaultPasswordResetThrottleLoginLockThreshold = 5
+	defaultPasswordResetThrottleIPLockThreshold    = 20
+	defaultPasswordResetThrottleLockoutDuration    = "1h"
+	defaultPasswordResetThrottleFailureWindow      = "1h"
+
+	defaultEmailVerificationTokenTTL = "24h"
+	defaultEmailVerificationURL      = "http://localhost:8080/verify-email"
+
+	defaultEmailVerificationThrottleFreeAttempts       = 0
+	defaultEmailVerificationThrottleBaseDelay          = "1m"
+	defaultEmailVerificationThrottleMaxDelay           = "1h"
+	defaultEmailVerificationThrottleLoginLockThreshold = 10
+	defaultEmailVerificationThrottleIPLockThreshold    = 10
+	defaultEmailVerificationThrottleLockoutDuration    = "24h"
+	defaultEmailVerificationThrottleFailureWindow      = "24h"
+
+	defaultTwoFactorIssuer        = "Gophermart"
+	defaultTwoFactorChallengeTTL  = "5m"
+	defaultTwoFactorSkew          = 1
+	defaultTwoFactorRecoveryCodes = 10
+
+	defaultOIDCScopes   = "openid,profile,email"
+	defaultOIDCStateTTL = "10m"
+
+	defaultOIDCStartLimit  = 60
+	defaultOIDCStartWindow = "1m"
 
 	defaultAccrualSysAddress = "http://localhost:8000"
+
+	defaultNotifierDriver = "file"
+	defaultSMTPPort       = 25
+
+	defaultWebhookTimeout              = "10s"
+	defaultWebhookRetryBaseDelay       = "30s"
+	defaultWebhookRetryMaxDelay        = "1h"
+	defaultWebhookMaxAttempts          = 8
+	defaultWebhookDisableAfterFailures = 20
+	defaultWebhookBatchSize            = 20
 )
 
 type (
@@ -30,19 +97,129 @@ type (
 	}
 
 	AuthConfig struct {
-		JWT          JWTConfig
-		PasswordSalt string
+		JWT JWTConfig
+		// PasswordSalt keys the hashes of the refresh tokens and API keys, it has no
+		// default and must be at least MinSecretLength long
+		PasswordSalt string `env:"PASSWORD_SALT"`
+
+		RevocationRefreshInterval time.Duration `mapstructure:"revocationRefreshInterval"`
+
+		LoginThrottle     LoginThrottleConfig
+		PasswordReset     PasswordResetConfig
+		EmailVerification EmailVerificationConfig
+		TwoFactor         TwoFactorConfig
+		Cookie            CookieConfig
+		Password          PasswordPolicyConfig
+		OIDC              OIDCConfig
+	}
+	// OIDCConfig is the OpenID Connect provider users can sign in with, the
+	// sign-in is disabled while Issuer is empty.
+	OIDCConfig struct {
+		Issuer       string   `mapstructure:"issuer" env:"OIDC_ISSUER"`
+		ClientID     string   `mapstructure:"clientID" env:"OIDC_CLIENT_ID"`
+		ClientSecret string   `mapstructure:"clientSecret" env:"OIDC_CLIENT_SECRET"`
+		RedirectURL  string   `mapstructure:"redirectURL" env:"OIDC_REDIRECT_URL"`
+		Scopes       []string `mapstructure:"scopes"`
+		// StateTTL is how long the user has to sign in at the provider
+		StateTTL time.Duration `mapstructure:"stateTTL"`
+		// AutoCreate creates an account for the identities not linked to any user
+		AutoCreate bool `mapstructure:"autoCreate" env:"OIDC_AUTO_CREATE"`
+		// StartLimit is how many sign-ins a client IP can start per StartWindow, each
+		// one stores a state until StateTTL
+		StartLimit  int           `mapstructure:"startLimit"`
+		StartWindow time.Duration `mapstructure:"startWindow"`
+	}
+	// PasswordPolicyConfig are the rules new passwords are checked against.
+	PasswordPolicyConfig struct {
+		// BcryptCost is the cost of new hashes, lower cost hashes are upgraded on sign-in
+		BcryptCost int `mapstructure:"bcryptCost" env:"PASSWORD_BCRYPT_COST"`
+		MinLength  int `mapstructure:"minLength"`
+		// MinCharClasses is how many of lower case, upper case, digits and symbols must be used
+		MinCharClasses int `mapstructure:"minCharClasses"`
+		// ForbidLogin rejects the passwords containing the login
+		ForbidLogin bool `mapstructure:"forbidLogin"`
+		// BannedFile lists one banned password per line, compared case-insensitively
+		BannedFile string `mapstructure:"bannedFile" env:"PASSWORD_BANNED_FILE"`
+		// BreachedDir is the SHA-1 prefix index of a breached-password corpus, the
+		// passwords seen at least BreachedMinCount times in it are rejected
+		BreachedDir      string `mapstructure:"breachedDir" env:"PASSWORD_BREACHED_DIR"`
+		BreachedMinCount int    `mapstructure:"breachedMinCount"`
+	}
+	// CookieConfig controls the cookie session mode for browser clients, where the
+	// access token is issued as an HttpOnly cookie guarded by a CSRF token.
+	CookieConfig struct {
+		Enabled bool `mapstructure:"enabled" env:"AUTH_COOKIE_MODE"`
+		// Secure must only be turned off for local development over plain HTTP
+		Secure bool `mapstructure:"secure"`
+		// SameSite is one of lax, strict or none, none requires Secure
+		SameSite string `mapstructure:"sameSite" env:"AUTH_COOKIE_SAMESITE"`
+	}
+	// TwoFactorConfig controls the TOTP two-factor authentication.
+	TwoFactorConfig struct {
+		// Issuer is the account label shown by authenticator apps
+		Issuer string `mapstructure:"issuer"`
+		// ChallengeTTL is how long the code can be sent after the password was verified
+		ChallengeTTL time.Duration `mapstructure:"challengeTTL"`
+		// Skew is the number of 30s steps a code may be off by to tolerate clock drift
+		Skew          int `mapstructure:"skew"`
+		RecoveryCodes int `mapstructure:"recoveryCodes"`
+	}
+	// EmailVerificationConfig controls the signed links users confirm their email with.
+	EmailVerificationConfig struct {
+		// SigningKey signs the links, it has no default and must be at least
+		// MinSecretLength long
+		SigningKey string        `mapstructure:"signingKey" env:"EMAIL_VERIFICATION_KEY"`
+		TokenTTL   time.Duration `mapstructure:"tokenTTL"`
+		// URL is the page of the frontend the verification token is appended to
+		URL string `mapstructure:"url" env:"EMAIL_VERIFICATION_URL"`
+		// RequiredForWithdrawals only lets users with a verified email withdraw points
+		RequiredForWithdrawals bool `mapstructure:"requiredForWithdrawals" env:"REQUIRE_VERIFIED_EMAIL_FOR_WITHDRAWALS"`
+		// Throttle limits the links resent per user, every link counts as a failure
+		// so that each one waits longer than the previous
+		Throttle LoginThrottleConfig
+	}
+	PasswordResetConfig struct {
+		TokenTTL time.Duration `mapstructure:"tokenTTL"`
+		// URL is the page of the frontend the reset token is appended to
+		URL string `mapstructure:"url" env:"PASSWORD_RESET_URL"`
+		// Throttle limits the reset links requested per login and per client IP,
+		// every request counts as a failure
+		Throttle LoginThrottleConfig
+	}
+	// LoginThrottleConfig controls the brute-force protection of the sign-in,
+	// failures are counted per login and per client IP.
+	LoginThrottleConfig struct {
+		// FreeAttempts is the number of failures allowed before delays kick in
+		FreeAttempts int `mapstructure:"freeAttempts"`
+		// BaseDelay doubles with every failure past FreeAttempts, up to MaxDelay
+		BaseDelay time.Duration `mapstructure:"baseDelay"`
+		MaxDelay  time.Duration `mapstructure:"maxDelay"`
+		// LoginLockThreshold and IPLockThreshold are the failures that lock the key for LockoutDuration
+		LoginLockThreshold int           `mapstructure:"loginLockThreshold"`
+		IPLockThreshold    int           `mapstructure:"ipLockThreshold"`
+		LockoutDuration    time.Duration `mapstructure:"lockoutDuration"`
+		// FailureWindow is how long a failure is remembered
+		FailureWindow time.Duration `mapstructure:"failureWindow"`
 	}
 	JWTConfig struct {
 		AccessTokenTTL  time.Duration `mapstructure:"accessTokenTTL"`
 		RefreshTokenTTL time.Duration `mapstructure:"refreshTokenTTL"`
-		SigningKey      string
+		// SigningKey is the HS256 key used while no KeysDir is set, it has no default
+		// and must be at least MinSecretLength long then
+		SigningKey string `env:"JWT_SIGNING_KEY"`
+
+		// KeysDir holds <kid>.pem RSA/Ed25519 keys, when set tokens are signed
+		// asymmetrically instead of with SigningKey
+		KeysDir            string        `mapstructure:"keysDir" env:"JWT_KEYS_DIR"`
+		KeysReloadInterval time.Duration `mapstructure:"keysReloadInterval"`
 	}
 	HTTPConfig struct {
 		Port           string        `mapstructure:"port" env:"RUN_ADDRESS"`
 		MaxHeaderBytes int           `mapstructure:"maxHeaderBytes"`
 		ReadTimeout    time.Duration `mapstructure:"readTimeout"`
 		WriteTimeout   time.Duration `mapstructure:"writeTimeout"`
+		// AllowedOrigins may send credentialed cross-origin requests
+		AllowedOrigins []string `mapstructure:"allowedOrigins" env:"CORS_ALLOWED_ORIGINS"`
 	}
 
 	DBConfig struct {
@@ -53,12 +230,41 @@ type (
 		Address string `mapstructure:"address" env:"ACCRUAL_SYSTEM_ADDRESS"`
 	}
 
+	WebhookConfig struct {
+		Timeout              time.Duration `mapstructure:"timeout"`
+		RetryBaseDelay       time.Duration `mapstructure:"retryBaseDelay"`
+		RetryMaxDelay        time.Duration `mapstructure:"retryMaxDelay"`
+		MaxAttempts          int           `mapstructure:"maxAttempts"`
+		DisableAfterFailures int           `mapstructure:"disableAfterFailures"`
+		BatchSize            int           `mapstructure:"batchSize"`
+		// AllowPrivateTargets lets webhooks target loopback and private addresses,
+		// it must only be turned on for local development
+		AllowPrivateTargets bool `mapstructure:"allowPrivateTargets" env:"WEBHOOK_ALLOW_PRIVATE_TARGETS"`
+	}
+
+	// NotifierConfig selects how notifications such as password reset links are sent,
+	// the file driver writes them to FilePath or to stdout.
+	NotifierConfig struct {
+		Driver   string `mapstructure:"driver" env:"NOTIFIER_DRIVER"`
+		FilePath string `mapstructure:"filePath" env:"NOTIFIER_FILE"`
+		SMTP     SMTPConfig
+	}
+	SMTPConfig struct {
+		Host     string `mapstructure:"host" env:"SMTP_HOST"`
+		Port     int    `mapstructure:"port" env:"SMTP_PORT"`
+		Username string `mapstructure:"username" env:"SMTP_USERNAME"`
+		Password string `mapstructure:"password" env:"SMTP_PASSWORD"`
+		From     string `mapstructure:"from" env:"SMTP_FROM"`
+	}
+
 	config struct {
-		Logger  LoggerConfig
-		HTTP    HTTPConfig
-		DB      DBConfig
-		Auth    AuthConfig
-		Accrual AccrualConfig
+		Logger   LoggerConfig
+		HTTP     HTTPConfig
+		DB       DBConfig
+		Auth     AuthConfig
+		Accrual  AccrualConfig
+		Webhook  WebhookConfig
+		Notifier NotifierConfig
 	}
 )
 
@@ -97,12 +303,88 @@ func NewConfig() *config {
 			cfg.Accrual.Address = envAccrual
 		}
 
+		if envKeysDir := os.Getenv("JWT_KEYS_DIR"); envKeysDir != "" {
+			cfg.Auth.JWT.KeysDir = envKeysDir
+		}
+
+		if envSigningKey := os.Getenv("JWT_SIGNING_KEY"); envSigningKey != "" {
+			cfg.Auth.JWT.SigningKey = envSigningKey
+		}
+
+		if envSalt := os.Getenv("PASSWORD_SALT"); envSalt != "" {
+			cfg.Auth.PasswordSalt = envSalt
+		}
+
+		if envResetURL := os.Getenv("PASSWORD_RESET_URL"); envResetURL != "" {
+			cfg.Auth.PasswordReset.URL = envResetURL
+		}
+
+		if envCost, err := strconv.Atoi(os.Getenv("PASSWORD_BCRYPT_COST")); err == nil {
+			cfg.Auth.Password.BcryptCost = envCost
+		}
+
+		if envBannedFile := os.Getenv("PASSWORD_BANNED_FILE"); envBannedFile != "" {
+			cfg.Auth.Password.BannedFile = envBannedFile
+		}
+
+		if envBreachedDir := os.Getenv("PASSWORD_BREACHED_DIR"); envBreachedDir != "" {
+			cfg.Auth.Password.BreachedDir = envBreachedDir
+		}
+
+		if envOrigins := os.Getenv("CORS_ALLOWED_ORIGINS"); envOrigins != "" {
+			cfg.HTTP.AllowedOrigins = strings.Split(envOrigins, ",")
+		}
+
+		if envCookieMode, err := strconv.ParseBool(os.Getenv("AUTH_COOKIE_MODE")); err == nil {
+			cfg.Auth.Cookie.Enabled = envCookieMode
+		}
+
+		if envSameSite := os.Getenv("AUTH_COOKIE_SAMESITE"); envSameSite != "" {
+			cfg.Auth.Cookie.SameSite = envSameSite
+		}
+
+		if envPrivateTargets, err := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE_TARGETS")); err == nil {
+			cfg.Webhook.AllowPrivateTargets = envPrivateTargets
+		}
+
+		loadEmailVerificationEnv(&cfg.Auth.EmailVerification)
+		loadOIDCEnv(&cfg.Auth.OIDC)
+		loadNotifierEnv(&cfg.Notifier)
+
 		instance = &cfg
 	})
 
 	return instance
 }
 
+// Validate checks the secrets which have no safe default, so that the service refuses
+// to start without them.
+func (c AuthConfig) Validate() error {
+	if c.PasswordSalt == "" {
+		return errors.New("PASSWORD_SALT must be set")
+	}
+
+	if len(c.PasswordSalt) < MinSecretLength {
+		return fmt.Errorf("PASSWORD_SALT must be at least %d characters long", MinSecretLength)
+	}
+
+	// the asymmetric keys of KeysDir replace the HS256 key
+	if c.JWT.KeysDir == "" && len(c.JWT.SigningKey) < MinSecretLength {
+		return fmt.Errorf("JWT_SIGNING_KEY must be at least %d characters long unless JWT_KEYS_DIR is set",
+			MinSecretLength)
+	}
+
+	if c.EmailVerification.SigningKey == "" {
+		return errors.New("EMAIL_VERIFICATION_KEY must be set")
+	}
+
+	if len(c.EmailVerification.SigningKey) < MinSecretLength {
+		return fmt.Errorf("EMAIL_VERIFICATION_KEY must be at least %d characters long", MinSecretLength)
+	}
+
+	return nil
+}
+
 func setDefaults(cfg *config) {
 	// logger related defaults
 	cfg.Logger.Level = defaultLoggerlevel
@@ -116,9 +398,145 @@ func setDefaults(cfg *config) {
 	// auth related defaults
 	assignValueCfgProp(&cfg.Auth.JWT.AccessTokenTTL, defaultJWTAccessTokenTTL)
 	assignValueCfgProp(&cfg.Auth.JWT.RefreshTokenTTL, defaultJWTRefreshTokenTTL)
+	assignValueCfgProp(&cfg.Auth.JWT.KeysReloadInterval, defaultJWTKeysReloadInterval)
+	assignValueCfgProp(&cfg.Auth.RevocationRefreshInterval, defaultRevocationRefreshInterval)
+
+	// cookie session mode defaults
+	cfg.Auth.Cookie.Secure = true
+	cfg.Auth.Cookie.SameSite = defaultCookieSameSite
+
+	// password policy defaults
+	cfg.Auth.Password.BcryptCost = defaultPasswordBcryptCost
+	cfg.Auth.Password.MinLength = defaultPasswordMinLength
+	cfg.Auth.Password.MinCharClasses = defaultPasswordMinCharClasses
+	cfg.Auth.Password.ForbidLogin = true
+	cfg.Auth.Password.BreachedMinCount = defaultPasswordBreachedMinCount
+
+	// login brute-force protection defaults
+	cfg.Auth.LoginThrottle.FreeAttempts = defaultLoginThrottleFreeAttempts
+	assignValueCfgProp(&cfg.Auth.LoginThrottle.BaseDelay, defaultLoginThrottleBaseDelay)
+	assignValueCfgProp(&cfg.Auth.LoginThrottle.MaxDelay, defaultLoginThrottleMaxDelay)
+	cfg.Auth.LoginThrottle.LoginLockThreshold = defaultLoginThrottleLoginLockThreshold
+	cfg.Auth.LoginThrottle.IPLockThreshold = defaultLoginThrottleIPLockThreshold
+	assignValueCfgProp(&cfg.Auth.LoginThrottle.LockoutDuration, defaultLoginThrottleLockoutDuration)
+	assignValueCfgProp(&cfg.Auth.LoginThrottle.FailureWindow, defaultLoginThrottleFailureWindow)
+
+	// password reset defaults
+	assignValueCfgProp(&cfg.Auth.PasswordReset.TokenTTL, defaultPasswordResetTokenTTL)
+	cfg.Auth.PasswordReset.URL = defaultPasswordResetURL
+	cfg.Auth.PasswordReset.Throttle.FreeAttempts = defaultPasswordResetThrottleFreeAttempts
+	assignValueCfgProp(&cfg.Auth.PasswordReset.Throttle.BaseDelay, defaultPasswordResetThrottleBaseDelay)
+	assignValueCfgProp(&cfg.Auth.PasswordReset.Throttle.MaxDelay, defaultPasswordResetThrottleMaxDelay)
+	cfg.Auth.PasswordReset.Throttle.LoginLockThreshold = defaultPasswordResetThrottleLoginLockThreshold
+	cfg.Auth.PasswordReset.Throttle.IPLockThreshold = defaultPasswordResetThrottleIPLockThreshold
+	assignValueCfgProp(&cfg.Auth.PasswordReset.Throttle.LockoutDuration, defaultPasswordResetThrottleLockoutDuration)
+	assignValueCfgProp(&cfg.Auth.PasswordReset.Throttle.FailureWindow, defaultPasswordResetThrottleFailureWindow)
+
+	// email verification defaults
+	assignValueCfgProp(&cfg.Auth.EmailVerification.TokenTTL, defaultEmailVerificationTokenTTL)
+	cfg.Auth.EmailVerification.URL = defaultEmailVerificationURL
+	cfg.Auth.EmailVerification.Throttle.FreeAttempts = defaultEmailVerificationThrottleFreeAttempts
+	assignValueCfgProp(&cfg.Auth.EmailVerification.Throttle.BaseDelay, defaultEmailVerificationThrottleBaseDelay)
+	assignValueCfgProp(&cfg.Auth.EmailVerification.Throttle.MaxDelay, defaultEmailVerificationThrottleMaxDelay)
+	cfg.Auth.EmailVerification.Throttle.LoginLockThreshold = defaultEmailVerificationThrottleLoginLockThreshold
+	cfg.Auth.EmailVerification.Throttle.IPLockThreshold = defaultEmailVerificationThrottleIPLockThreshold
+	assignValueCfgProp(&cfg.Auth.EmailVerification.Throttle.LockoutDuration,
+		defaultEmailVerificationThrottleLockoutDuration)
+	assignValueCfgProp(&cfg.Auth.EmailVerification.Throttle.FailureWindow,
+		defaultEmailVerificationThrottleFailureWindow)
+
+	// two-factor authentication defaults
+	cfg.Auth.TwoFactor.Issuer = defaultTwoFactorIssuer
+	assignValueCfgProp(&cfg.Auth.TwoFactor.ChallengeTTL, defaultTwoFactorChallengeTTL)
+	cfg.Auth.TwoFactor.Skew = defaultTwoFactorSkew
+	cfg.Auth.TwoFactor.RecoveryCodes = defaultTwoFactorRecoveryCodes
+
+	// OpenID Connect defaults
+	cfg.Auth.OIDC.Scopes = strings.Split(defaultOIDCScopes, ",")
+	assignValueCfgProp(&cfg.Auth.OIDC.StateTTL, defaultOIDCStateTTL)
+	cfg.Auth.OIDC.StartLimit = defaultOIDCStartLimit
+	assignValueCfgProp(&cfg.Auth.OIDC.StartWindow, defaultOIDCStartWindow)
 
 	// accrual sys defaults
 	cfg.Accrual.Address = defaultAccrualSysAddress
+
+	// webhook delivery defaults
+	assignValueCfgProp(&cfg.Webhook.Timeout, defaultWebhookTimeout)
+	assignValueCfgProp(&cfg.Webhook.RetryBaseDelay, defaultWebhookRetryBaseDelay)
+	assignValueCfgProp(&cfg.Webhook.RetryMaxDelay, defaultWebhookRetryMaxDelay)
+	cfg.Webhook.MaxAttempts = defaultWebhookMaxAttempts
+	cfg.Webhook.DisableAfterFailures = defaultWebhookDisableAfterFailures
+	cfg.Webhook.BatchSize = defaultWebhookBatchSize
+
+	// notifier defaults
+	cfg.Notifier.Driver = defaultNotifierDriver
+	cfg.Notifier.SMTP.Port = defaultSMTPPort
+}
+
+func loadEmailVerificationEnv(cfg *EmailVerificationConfig) {
+	if v := os.Getenv("EMAIL_VERIFICATION_KEY"); v != "" {
+		cfg.SigningKey = v
+	}
+
+	if v := os.Getenv("EMAIL_VERIFICATION_URL"); v != "" {
+		cfg.URL = v
+	}
+
+	if v, err := strconv.ParseBool(os.Getenv("REQUIRE_VERIFIED_EMAIL_FOR_WITHDRAWALS")); err == nil {
+		cfg.RequiredForWithdrawals = v
+	}
+}
+
+func loadOIDCEnv(cfg *OIDCConfig) {
+	if v := os.Getenv("OIDC_ISSUER"); v != "" {
+		cfg.Issuer = v
+	}
+
+	if v := os.Getenv("OIDC_CLIENT_ID"); v != "" {
+		cfg.ClientID = v
+	}
+
+	if v := os.Getenv("OIDC_CLIENT_SECRET"); v != "" {
+		cfg.ClientSecret = v
+	}
+
+	if v := os.Getenv("OIDC_REDIRECT_URL"); v != "" {
+		cfg.RedirectURL = v
+	}
+
+	if v, err := strconv.ParseBool(os.Getenv("OIDC_AUTO_CREATE")); err == nil {
+		cfg.AutoCreate = v
+	}
+}
+
+func loadNotifierEnv(cfg *NotifierConfig) {
+	if v := os.Getenv("NOTIFIER_DRIVER"); v != "" {
+		cfg.Driver = v
+	}
+
+	if v := os.Getenv("NOTIFIER_FILE"); v != "" {
+		cfg.FilePath = v
+	}
+
+	if v := os.Getenv("SMTP_HOST"); v != "" {
+		cfg.SMTP.Host = v
+	}
+
+	if v, err := strconv.Atoi(os.Getenv("SMTP_PORT")); err == nil {
+		cfg.SMTP.Port = v
+	}
+
+	if v := os.Getenv("SMTP_USERNAME"); v != "" {
+		cfg.SMTP.Username = v
+	}
+
+	if v := os.Getenv("SMTP_PASSWORD"); v != "" {
+		cfg.SMTP.Password = v
+	}
+
+	if v := os.Getenv("SMTP_FROM"); v != "" {
+		cfg.SMTP.From = v
+	}
 }
 
 func assignValueCfgProp(destination *time.Duration, defaultValue string) {
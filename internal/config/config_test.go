@@ -0,0 +1,44 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAuthConfig_Validate(t *testing.T) {
+	salt := strings.Repeat("s", MinSecretLength)
+	emailKey := strings.Repeat("k", MinSecretLength)
+	jwtKey := strings.Repeat("j", MinSecretLength)
+
+	tests := []struct {
+		name     string
+		salt     string
+		emailKey string
+		jwt      JWTConfig
+		wantErr  bool
+	}{
+		{name: "missing salt", emailKey: emailKey, jwt: JWTConfig{SigningKey: jwtKey}, wantErr: true},
+		{name: "short salt", salt: "salt", emailKey: emailKey, jwt: JWTConfig{SigningKey: jwtKey}, wantErr: true},
+		{name: "missing email verification key", salt: salt, jwt: JWTConfig{SigningKey: jwtKey}, wantErr: true},
+		{name: "short email verification key", salt: salt, emailKey: "key", jwt: JWTConfig{SigningKey: jwtKey},
+			wantErr: true},
+		{name: "missing jwt signing key", salt: salt, emailKey: emailKey, wantErr: true},
+		{name: "short jwt signing key", salt: salt, emailKey: emailKey, jwt: JWTConfig{SigningKey: "secret"},
+			wantErr: true},
+		{name: "jwt keys directory", salt: salt, emailKey: emailKey, jwt: JWTConfig{KeysDir: "/etc/gophermart/keys"}},
+		{name: "long enough secrets", salt: salt, emailKey: emailKey, jwt: JWTConfig{SigningKey: jwtKey}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := AuthConfig{
+				JWT:               tt.jwt,
+				PasswordSalt:      tt.salt,
+				EmailVerification: EmailVerificationConfig{SigningKey: tt.emailKey},
+			}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/internal/service/throttle"
+	"github.com/mihailtudos/gophermart/internal/validator"
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+)
+
+type AccountManager interface {
+	GetProfile(ctx context.Context, userID string) (domain.User, error)
+	UpdateProfile(ctx context.Context, userID string, version int, input domain.UserProfileInput) (domain.User, error)
+	ExportUserData(ctx context.Context, userID string) (domain.UserExport, error)
+	DeleteAccount(ctx context.Context,
+		userID string,
+		input domain.DeleteAccountInput,
+		client domain.SessionClient) error
+}
+
+type accountHandler struct {
+	AccountManager
+	cookies CookieOptions
+}
+
+// getProfile sends the account of the signed in user, its ETag is the version the
+// profile updates have to be made against.
+func (ah accountHandler) getProfile(w http.ResponseWriter, r *http.Request) {
+	user := helpers.ContextGetUser(r)
+
+	profile, err := ah.GetProfile(r.Context(), user.ID)
+	if err != nil {
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	etag := versionETag(profile.Version)
+	w.Header().Set(ETagHeaderName, etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if inm := r.Header.Get(IfNoneMatchHeaderName); inm != "" && etagMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if err := helpers.WriteUnwrappedJSON(w, http.StatusOK, profile, nil); err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+// updateProfile applies a partial profile update, the If-Match header must carry
+// the ETag of the profile the update was made on so that no other change is lost.
+func (ah accountHandler) updateProfile(w http.ResponseWriter, r *http.Request) {
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		ErrorResponse(w, r, http.StatusPreconditionRequired, "the If-Match header must be provided")
+		return
+	}
+
+	var input domain.UserProfileInput
+	if err := helpers.ReadJSON(w, r, &input); err != nil {
+		ErrorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	v := validator.New()
+	domain.ValidateUserProfileInput(v, input)
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := helpers.ContextGetUser(r)
+
+	profile, err := ah.UpdateProfile(r.Context(), user.ID, version, input)
+	if err != nil {
+		if errors.Is(err, postgres.ErrEditConflict) {
+			ErrorResponse(w, r, http.StatusPreconditionFailed,
+				"the profile was modified since it was read, fetch it and try again")
+			return
+		}
+
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set(ETagHeaderName, versionETag(profile.Version))
+
+	if err := helpers.WriteUnwrappedJSON(w, http.StatusOK, profile, headers); err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+// exportUserData sends the personal data held about the user as a JSON download.
+func (ah accountHandler) exportUserData(w http.ResponseWriter, r *http.Request) {
+	user := helpers.ContextGetUser(r)
+
+	export, err := ah.ExportUserData(r.Context(), user.ID)
+	if err != nil {
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Disposition", `attachment; filename="gophermart-export.json"`)
+	headers.Set("Cache-Control", "no-store")
+
+	if err := helpers.WriteUnwrappedJSON(w, http.StatusOK, export, headers); err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+// deleteAccount anonymises the account of the signed in user once the password is confirmed.
+func (ah accountHandler) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	var input domain.DeleteAccountInput
+	if err := helpers.ReadJSON(w, r, &input); err != nil {
+		ErrorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Password != "", "password", "must be provided")
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := helpers.ContextGetUser(r)
+
+	if err := ah.DeleteAccount(r.Context(), user.ID, input, ah.cookies.sessionClient(w, r)); err != nil {
+		var retryErr *throttle.RetryError
+		switch {
+		case errors.As(err, &retryErr):
+			TooManyRequestsResponse(w, r, retryErr.RetryAfter)
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			FailedValidationResponse(w, r, map[string]string{"password": "is incorrect"})
+		case errors.Is(err, postgres.ErrEditConflict):
+			ErrorResponse(w, r, http.StatusConflict,
+				"the account was modified by another request, please try again")
+		default:
+			ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	helpers.ClearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,254 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mihailtudos/gophermart/internal/delivery/middleware"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/internal/validator"
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+)
+
+const defaultAdminPageSize = 50
+
+type AdminManager interface {
+	SearchUsers(ctx context.Context, filter domain.UserFilter) ([]domain.User, error)
+	GetUserDetails(ctx context.Context, userID string) (domain.UserDetails, error)
+	SuspendUser(ctx context.Context, actorID, userID string) error
+	UnsuspendUser(ctx context.Context, actorID, userID string) error
+	ForceLogout(ctx context.Context, actorID, userID string) error
+	SetUserRole(ctx context.Context, actorID, userID, role string) error
+	AdjustBalance(ctx context.Context,
+		actor domain.User,
+		adj domain.BalanceAdjustment) (domain.BalanceAdjustment, error)
+	GetBalanceAdjustments(ctx context.Context, userID string) ([]domain.BalanceAdjustment, error)
+}
+
+type adminHandler struct {
+	AdminManager
+}
+
+// NewAdminHandler serves the support tooling, support staff can look accounts up
+// while changing them is reserved to admins.
+func NewAdminHandler(am AdminManager, um UserManager, km APIKeyManager) *chi.Mux {
+	ah := adminHandler{am}
+
+	router := chi.NewMux()
+	router.Use(middleware.Authenticated(um, km))
+	router.Use(middleware.RequireSession)
+	router.Use(middleware.RequireRole(domain.RoleSupport, domain.RoleAdmin))
+
+	router.Get("/users", ah.searchUsers)
+	router.Get("/users/{id}", ah.getUser)
+	router.Get("/users/{id}/adjustments", ah.getBalanceAdjustments)
+	router.Post("/users/{id}/adjustments", ah.adjustBalance)
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.RequireRole(domain.RoleAdmin))
+		r.Post("/users/{id}/suspend", ah.suspendUser)
+		r.Post("/users/{id}/unsuspend", ah.unsuspendUser)
+		r.Post("/users/{id}/logout", ah.forceLogout)
+		r.Put("/users/{id}/role", ah.setUserRole)
+	})
+
+	return router
+}
+
+func (ah *adminHandler) searchUsers(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	filter := domain.UserFilter{
+		Login:  qs.Get("login"),
+		Role:   qs.Get("role"),
+		Limit:  helpers.ReadInt(qs, "limit", defaultAdminPageSize, v),
+		Offset: helpers.ReadInt(qs, "offset", 0, v),
+	}
+
+	domain.ValidateUserFilter(v, filter)
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, err := ah.SearchUsers(r.Context(), filter)
+	if err != nil {
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if err := helpers.WriteUnwrappedJSON(w, http.StatusOK, users, nil); err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+func (ah *adminHandler) getUser(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !validator.Matches(id, validator.UUIDRX) {
+		NotFoundResponse(w, r)
+		return
+	}
+
+	details, err := ah.GetUserDetails(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			NotFoundResponse(w, r)
+			return
+		}
+
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if err := helpers.WriteUnwrappedJSON(w, http.StatusOK, details, nil); err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+func (ah *adminHandler) getBalanceAdjustments(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !validator.Matches(id, validator.UUIDRX) {
+		NotFoundResponse(w, r)
+		return
+	}
+
+	adjustments, err := ah.GetBalanceAdjustments(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			NotFoundResponse(w, r)
+			return
+		}
+
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if err := helpers.WriteUnwrappedJSON(w, http.StatusOK, adjustments, nil); err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+// adjustBalance credits or debits the user points, support staff can not push a
+// balance below zero, admins can by setting force.
+func (ah *adminHandler) adjustBalance(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !validator.Matches(id, validator.UUIDRX) {
+		NotFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Amount     float64 `json:"amount"`
+		ReasonCode string  `json:"reason_code"`
+		Note       string  `json:"note"`
+		Force      bool    `json:"force"`
+	}
+
+	if err := helpers.ReadJSON(w, r, &input); err != nil {
+		ErrorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	adj := domain.BalanceAdjustment{
+		UserID:     id,
+		Amount:     input.Amount,
+		ReasonCode: input.ReasonCode,
+		Note:       strings.TrimSpace(input.Note),
+		Forced:     input.Force,
+	}
+
+	v := validator.New()
+	domain.ValidateBalanceAdjustment(v, &adj)
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	adj, err := ah.AdjustBalance(r.Context(), helpers.ContextGetUser(r), adj)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgres.ErrNoRowsFound):
+			NotFoundResponse(w, r)
+		case errors.Is(err, postgres.ErrInsufficientPoints):
+			ErrorResponse(w, r, http.StatusConflict, "the adjustment would make the balance negative")
+		case errors.Is(err, auth.ErrInsufficientRole):
+			ErrorResponse(w, r, http.StatusForbidden, "only admins can force a negative balance")
+		case errors.Is(err, auth.ErrSelfAction):
+			ErrorResponse(w, r, http.StatusConflict, "staff can not adjust their own balance")
+		default:
+			ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := helpers.WriteUnwrappedJSON(w, http.StatusCreated, adj, nil); err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+func (ah *adminHandler) suspendUser(w http.ResponseWriter, r *http.Request) {
+	ah.userAction(w, r, ah.SuspendUser)
+}
+
+func (ah *adminHandler) unsuspendUser(w http.ResponseWriter, r *http.Request) {
+	ah.userAction(w, r, ah.UnsuspendUser)
+}
+
+func (ah *adminHandler) forceLogout(w http.ResponseWriter, r *http.Request) {
+	ah.userAction(w, r, ah.ForceLogout)
+}
+
+func (ah *adminHandler) setUserRole(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Role string `json:"role"`
+	}
+
+	if err := helpers.ReadJSON(w, r, &input); err != nil {
+		ErrorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(input.Role, domain.Roles...), "role", "must be one of user, support or admin")
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ah.userAction(w, r, func(ctx context.Context, actorID, userID string) error {
+		return ah.SetUserRole(ctx, actorID, userID, input.Role)
+	})
+}
+
+// userAction runs an admin action against the user of the URL on behalf of the signed in admin.
+func (ah *adminHandler) userAction(w http.ResponseWriter,
+	r *http.Request,
+	action func(ctx context.Context, actorID, userID string) error) {
+	id := chi.URLParam(r, "id")
+	if !validator.Matches(id, validator.UUIDRX) {
+		NotFoundResponse(w, r)
+		return
+	}
+
+	actor := helpers.ContextGetUser(r)
+
+	if err := action(r.Context(), actor.ID, id); err != nil {
+		switch {
+		case errors.Is(err, postgres.ErrNoRowsFound):
+			NotFoundResponse(w, r)
+		case errors.Is(err, auth.ErrSelfAction):
+			ErrorResponse(w, r, http.StatusConflict, "admins can not perform this action on their own account")
+		default:
+			ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,96 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/validator"
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+)
+
+type APIKeyManager interface {
+	CreateAPIKey(ctx context.Context, key domain.APIKey) (domain.APIKey, error)
+	GetAPIKeys(ctx context.Context, userID string) ([]domain.APIKey, error)
+	DeleteAPIKey(ctx context.Context, userID, keyID string) error
+	VerifyAPIKey(ctx context.Context, key string) (domain.APIKey, error)
+}
+
+type apiKeyHandler struct {
+	APIKeyManager
+}
+
+func (kh *apiKeyHandler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+
+	if err := helpers.ReadJSON(w, r, &input); err != nil {
+		ErrorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user := helpers.ContextGetUser(r)
+	key := domain.APIKey{
+		UserID: user.ID,
+		Name:   input.Name,
+		Scopes: input.Scopes,
+	}
+
+	v := validator.New()
+	domain.ValidateAPIKey(v, &key)
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	key, err := kh.CreateAPIKey(r.Context(), key)
+	if err != nil {
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if err := helpers.WriteUnwrappedJSON(w, http.StatusCreated, key, nil); err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+func (kh *apiKeyHandler) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	user := helpers.ContextGetUser(r)
+
+	keys, err := kh.GetAPIKeys(r.Context(), user.ID)
+	if err != nil {
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if err := helpers.WriteUnwrappedJSON(w, http.StatusOK, keys, nil); err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+func (kh *apiKeyHandler) deleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !validator.Matches(id, validator.UUIDRX) {
+		NotFoundResponse(w, r)
+		return
+	}
+
+	user := helpers.ContextGetUser(r)
+
+	if err := kh.DeleteAPIKey(r.Context(), user.ID, id); err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			NotFoundResponse(w, r)
+			return
+		}
+
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -6,25 +6,31 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/mihailtudos/gophermart/internal/delivery/middleware"
 	"github.com/mihailtudos/gophermart/internal/domain"
 	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/internal/service/throttle"
 	"github.com/mihailtudos/gophermart/internal/validator"
 	"github.com/mihailtudos/gophermart/pkg/helpers"
 )
 
 type Auth interface {
-	SetSessionToken(ctx context.Context, userID string, tokens string) error
-	GenerateUserTokens(ctx context.Context, userID string) (domain.Tokens, error)
-	Login(ctx context.Context, input domain.UserAuthInput) (domain.User, error)
+	GenerateUserTokens(ctx context.Context, userID string, client domain.SessionClient) (domain.Tokens, error)
+	RefreshTokens(ctx context.Context, refreshToken string, client domain.SessionClient) (domain.Tokens, error)
+	Login(ctx context.Context, input domain.UserAuthInput, client domain.SessionClient) (domain.User, error)
 	Register(ctx context.Context, user domain.User) (string, error)
 }
 
 type authHandler struct {
 	Auth
+	twoFactor TwoFactorManager
+	passwords PasswordValidator
+	cookies   CookieOptions
 }
 
-func NewAuthHanler(auth Auth) *authHandler {
-	return &authHandler{auth}
+func NewAuthHanler(auth Auth, tm TwoFactorManager, pv PasswordValidator, cookies CookieOptions) *authHandler {
+	return &authHandler{auth, tm, pv, cookies}
 }
 
 func (ah *authHandler) Signin(w http.ResponseWriter, r *http.Request) {
@@ -34,56 +40,97 @@ func (ah *authHandler) Signin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := domain.User{Login: input.Login}
-	if err := user.Password.Set(input.Password); err != nil {
-		ServerErrorResponse(w, r, err)
-		return
-	}
-
 	v := validator.New()
-	domain.ValidateUser(v, &user)
+	v.Check(input.Login != "", "login", "must be provided")
+	domain.ValidatePasswordPlaintext(v, input.Password)
 	if !v.Valid() {
 		ErrorResponse(w, r, http.StatusUnauthorized, "invalid credentials")
 		return
 	}
-	user, err := ah.Login(r.Context(), input)
+
+	user, err := ah.Login(r.Context(), input, ah.cookies.sessionClient(w, r))
 	if err != nil {
+		var retryErr *throttle.RetryError
 		switch {
-		case errors.Is(err, postgres.ErrNoRowsFound):
-			ErrorResponse(w, r, http.StatusBadRequest, "incorrect credentials")
+		case errors.As(err, &retryErr):
+			TooManyRequestsResponse(w, r, retryErr.RetryAfter)
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			ErrorResponse(w, r, http.StatusUnauthorized, "invalid credentials")
+		case errors.Is(err, auth.ErrUserSuspended):
+			ErrorResponse(w, r, http.StatusForbidden, "account suspended")
 		default:
 			ServerErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	tokens, err := ah.GenerateUserTokens(r.Context(), user.ID)
+	// the tokens are only issued once the second step is completed
+	if user.TwoFactorEnabled {
+		challenge, err := ah.twoFactor.NewChallenge(r.Context(), user.ID)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		_, err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+		}, nil)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	tokens, err := ah.GenerateUserTokens(r.Context(), user.ID, ah.cookies.sessionClient(w, r))
 	if err != nil {
 		ServerErrorResponse(w, r,
 			fmt.Errorf("failed to generate user tokens: %w", err))
 		return
 	}
 
-	if err := ah.SetSessionToken(r.Context(), user.ID, tokens.RefreshToken); err != nil {
-		ServerErrorResponse(w, r,
-			fmt.Errorf("failed to set user session: %w", err))
+	writeTokens(w, r, tokens, ah.cookies)
+}
+
+// SigninTwoFactor completes the sign-in of a user with the two-factor authentication
+// enabled, the code can be a TOTP or a recovery code.
+func (ah *authHandler) SigninTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var input domain.TwoFactorLoginInput
+	if err := helpers.ReadJSON(w, r, &input); err != nil {
+		ErrorResponse(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Set the Authorization header
-	helpers.SetAuthorizationHeaders(w, tokens)
-
-	_, err = helpers.WriteJSON(w, http.StatusOK,
-		helpers.Envelope{
-			"access_token":  tokens.AccessToken,
-			"refresh_token": tokens.RefreshToken,
-		},
-		nil)
+	v := validator.New()
+	v.Check(input.ChallengeToken != "", "challenge_token", "must be provided")
+	v.Check(input.Code != "", "code", "must be provided")
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
 
+	tokens, err := ah.twoFactor.CompleteLogin(r.Context(), input, ah.cookies.sessionClient(w, r))
 	if err != nil {
-		ServerErrorResponse(w, r,
-			fmt.Errorf("failed to write JSON response: %w", err))
+		var retryErr *throttle.RetryError
+		switch {
+		case errors.As(err, &retryErr):
+			TooManyRequestsResponse(w, r, retryErr.RetryAfter)
+		case errors.Is(err, auth.ErrInvalidTwoFactorCode):
+			ErrorResponse(w, r, http.StatusUnauthorized, "invalid two-factor code")
+		case errors.Is(err, auth.ErrUserSuspended):
+			ErrorResponse(w, r, http.StatusForbidden, "account suspended")
+		case errors.Is(err, auth.ErrInvalidToken),
+			errors.Is(err, auth.ErrTokenExpired),
+			errors.Is(err, auth.ErrTwoFactorNotEnabled),
+			errors.Is(err, postgres.ErrNoRowsFound):
+			ErrorResponse(w, r, http.StatusUnauthorized, "invalid or expired challenge token")
+		default:
+			ServerErrorResponse(w, r, err)
+		}
+		return
 	}
+
+	writeTokens(w, r, tokens, ah.cookies)
 }
 
 func (ah *authHandler) Signup(w http.ResponseWriter, r *http.Request) {
@@ -93,13 +140,23 @@ func (ah *authHandler) Signup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	v := validator.New()
+	if err := ah.passwords.ValidatePassword(v, "password", input.Login, input.Password); err != nil {
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	user := domain.User{Login: input.Login}
 	if err := user.Password.Set(input.Password); err != nil {
 		ServerErrorResponse(w, r, err)
 		return
 	}
 
-	v := validator.New()
 	domain.ValidateUser(v, &user)
 	if !v.Valid() {
 		FailedValidationResponse(w, r, v.Errors)
@@ -118,24 +175,86 @@ func (ah *authHandler) Signup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokens, err := ah.GenerateUserTokens(r.Context(), userID)
+	tokens, err := ah.GenerateUserTokens(r.Context(), userID, ah.cookies.sessionClient(w, r))
 	if err != nil {
 		ServerErrorResponse(w, r,
 			fmt.Errorf("failed to generate user tokens: %w", err))
 		return
 	}
 
-	if err := ah.SetSessionToken(r.Context(), userID, tokens.RefreshToken); err != nil {
-		ServerErrorResponse(w, r,
-			fmt.Errorf("failed to set user session: %w", err))
+	writeTokens(w, r, tokens, ah.cookies)
+}
+
+func (ah *authHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var refreshToken string
+
+	// a token sent in the body takes precedence over the cookie
+	if r.ContentLength != 0 {
+		var input struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+
+		if err := helpers.ReadJSON(w, r, &input); err != nil {
+			ErrorResponse(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		refreshToken = input.RefreshToken
+	} else if cookie, err := r.Cookie(helpers.RefreshTokenCookieName); err == nil {
+		// sessions started in the cookie mode hold a CSRF token which must be echoed
+		if _, err := r.Cookie(helpers.CSRFTokenCookieName); err == nil && !middleware.ValidCSRFToken(r) {
+			ErrorResponse(w, r, http.StatusForbidden, "missing or invalid CSRF token")
+			return
+		}
+
+		refreshToken = cookie.Value
+	}
+
+	if refreshToken == "" {
+		ErrorResponse(w, r, http.StatusUnauthorized, "missing refresh token")
+		return
+	}
+
+	tokens, err := ah.RefreshTokens(r.Context(), refreshToken, ah.cookies.sessionClient(w, r))
+	if err != nil {
+		switch {
+		case errors.Is(err, postgres.ErrNoRowsFound), errors.Is(err, auth.ErrTokenExpired):
+			ErrorResponse(w, r, http.StatusUnauthorized, "invalid or expired refresh token")
+		case errors.Is(err, postgres.ErrRefreshTokenReused):
+			ErrorResponse(w, r, http.StatusUnauthorized, "refresh token reuse detected, please log in again")
+		case errors.Is(err, auth.ErrUserSuspended):
+			ErrorResponse(w, r, http.StatusForbidden, "account suspended")
+		default:
+			ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	writeTokens(w, r, tokens, ah.cookies)
+}
+
+// writeTokens sends the token pair in the auth headers and in the JSON body, in
+// the cookie session mode the tokens are only sent as cookies together with the
+// CSRF token the client has to echo.
+func writeTokens(w http.ResponseWriter, r *http.Request, tokens domain.Tokens, cookies CookieOptions) {
+	if cookies.requested(r) {
+		csrfToken, err := cookies.setSessionCookies(w, tokens)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		_, err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"csrf_token": csrfToken}, nil)
+		if err != nil {
+			ServerErrorResponse(w, r,
+				fmt.Errorf("failed to write JSON response: %w", err))
+		}
 		return
 	}
 
-	// Setting auth headers
 	helpers.SetAuthorizationHeaders(w, tokens)
 
-	// Respond with the tokens in the JSON body
-	_, err = helpers.WriteJSON(w, http.StatusOK,
+	_, err := helpers.WriteJSON(w, http.StatusOK,
 		helpers.Envelope{
 			"access_token":  tokens.AccessToken,
 			"refresh_token": tokens.RefreshToken,
@@ -147,3 +266,13 @@ func (ah *authHandler) Signup(w http.ResponseWriter, r *http.Request) {
 			fmt.Errorf("failed to write JSON response: %w", err))
 	}
 }
+
+// sessionClient describes the device the request was sent from, a device ID is
+// issued when the request does not carry one.
+func (o CookieOptions) sessionClient(w http.ResponseWriter, r *http.Request) domain.SessionClient {
+	return domain.SessionClient{
+		DeviceID:   o.deviceID(w, r),
+		DeviceInfo: r.UserAgent(),
+		IPAddress:  helpers.ClientIP(r),
+	}
+}
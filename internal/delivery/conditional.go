@@ -0,0 +1,121 @@
+package delivery
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+)
+
+const (
+	ETagHeaderName            = "ETag"
+	LastModifiedHeaderName    = "Last-Modified"
+	IfNoneMatchHeaderName     = "If-None-Match"
+	IfModifiedSinceHeaderName = "If-Modified-Since"
+	IfMatchHeaderName         = "If-Match"
+)
+
+// writeConditionalJSON writes data as JSON along with its validators (a weak ETag computed
+// from the payload and the Last-Modified time), or responds with 304 Not Modified when
+// the client already holds the current representation.
+func writeConditionalJSON(w http.ResponseWriter, r *http.Request, data any, lastModified time.Time) error {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+
+	etag := weakETag(js)
+
+	w.Header().Set(ETagHeaderName, etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if !lastModified.IsZero() {
+		w.Header().Set(LastModifiedHeaderName, lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	w.Header().Set(ContentTypeHeaderName, "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(js)
+
+	return err
+}
+
+func weakETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified evaluates the conditional request headers as described in RFC 9110,
+// If-Modified-Since is ignored when If-None-Match is present.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get(IfNoneMatchHeaderName); inm != "" {
+		return etagMatches(inm, etag)
+	}
+
+	ims := r.Header.Get(IfModifiedSinceHeaderName)
+	if ims == "" || lastModified.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+
+	// the header has a second precision
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// etagMatches uses the weak comparison, which is the one required for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// versionETag is the strong ETag of a resource guarded by a version column, the
+// client sends it back in If-Match to update the version it has read.
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatchVersion reads the version from the If-Match header, ok is false when the
+// header is missing. * is reported as AnyProfileVersion, it matches the current
+// version. Weak tags do not tell which version the client has read, they are
+// reported as version 0 which never matches.
+func ifMatchVersion(r *http.Request) (version int, ok bool) {
+	tag := strings.TrimSpace(r.Header.Get(IfMatchHeaderName))
+	if tag == "" {
+		return 0, false
+	}
+
+	if tag == "*" {
+		return domain.AnyProfileVersion, true
+	}
+
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, true
+	}
+
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil {
+		return 0, true
+	}
+
+	return version, true
+}
@@ -0,0 +1,128 @@
+package delivery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+)
+
+func TestWriteConditionalJSON(t *testing.T) {
+	balance := domain.UserBalance{Current: 500.5, Withdrawn: 42}
+	lastModified := time.Date(2024, time.September, 20, 10, 30, 15, 500, time.UTC)
+
+	first := httptest.NewRecorder()
+	if err := writeConditionalJSON(first, httptest.NewRequest(http.MethodGet, "/", http.NoBody), balance, lastModified); err != nil {
+		t.Fatalf("writeConditionalJSON() error = %v", err)
+	}
+
+	etag := first.Header().Get(ETagHeaderName)
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("writeConditionalJSON() = %d with ETag %q, want 200 with an ETag", first.Code, etag)
+	}
+
+	if got := first.Header().Get(LastModifiedHeaderName); got != "Fri, 20 Sep 2024 10:30:15 GMT" {
+		t.Errorf("Last-Modified = %q", got)
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		data    any
+		want    int
+	}{
+		{
+			name:    "matching etag",
+			headers: map[string]string{IfNoneMatchHeaderName: etag},
+			data:    balance,
+			want:    http.StatusNotModified,
+		},
+		{
+			name:    "matching etag in a list",
+			headers: map[string]string{IfNoneMatchHeaderName: `W/"stale", ` + etag},
+			data:    balance,
+			want:    http.StatusNotModified,
+		},
+		{
+			name:    "stale etag",
+			headers: map[string]string{IfNoneMatchHeaderName: etag},
+			data:    domain.UserBalance{Current: 400.5, Withdrawn: 142},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "not modified since",
+			headers: map[string]string{IfModifiedSinceHeaderName: "Fri, 20 Sep 2024 10:30:15 GMT"},
+			data:    balance,
+			want:    http.StatusNotModified,
+		},
+		{
+			name:    "modified since",
+			headers: map[string]string{IfModifiedSinceHeaderName: "Fri, 20 Sep 2024 10:30:14 GMT"},
+			data:    balance,
+			want:    http.StatusOK,
+		},
+		{
+			name: "if-none-match takes precedence",
+			headers: map[string]string{
+				IfNoneMatchHeaderName:     `W/"stale"`,
+				IfModifiedSinceHeaderName: "Fri, 20 Sep 2024 10:30:15 GMT",
+			},
+			data: balance,
+			want: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			w := httptest.NewRecorder()
+			if err := writeConditionalJSON(w, r, tt.data, lastModified); err != nil {
+				t.Fatalf("writeConditionalJSON() error = %v", err)
+			}
+
+			if w.Code != tt.want {
+				t.Errorf("writeConditionalJSON() status = %d, want %d", w.Code, tt.want)
+			}
+
+			if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Error("304 response must not have a body")
+			}
+		})
+	}
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		wantVersion int
+		wantOK      bool
+	}{
+		{name: "missing", wantOK: false},
+		{name: "version etag", header: versionETag(7), wantVersion: 7, wantOK: true},
+		{name: "weak etag", header: `W/"7"`, wantOK: true},
+		{name: "any", header: "*", wantVersion: domain.AnyProfileVersion, wantOK: true},
+		{name: "unquoted", header: "7", wantOK: true},
+		{name: "not a version", header: `"abc"`, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/", http.NoBody)
+			if tt.header != "" {
+				req.Header.Set(IfMatchHeaderName, tt.header)
+			}
+
+			version, ok := ifMatchVersion(req)
+			if version != tt.wantVersion || ok != tt.wantOK {
+				t.Errorf("ifMatchVersion() = %d, %v, want %d, %v", version, ok, tt.wantVersion, tt.wantOK)
+			}
+		})
+	}
+}
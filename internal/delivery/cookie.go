@@ -0,0 +1,110 @@
+package delivery
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+)
+
+const (
+	// AuthModeHeaderName lets browser clients ask for the cookie session mode
+	// when signing in or refreshing the tokens.
+	AuthModeHeaderName = "X-Auth-Mode"
+	authModeCookie     = "cookie"
+
+	deviceIDLength    = 16
+	deviceIDCookieTTL = 400 * 24 * time.Hour // the longest lifetime browsers keep a cookie for
+)
+
+// CookieOptions configures the cookie session mode, in which the tokens are only
+// issued as HttpOnly cookies so that scripts running in the page can not read them.
+type CookieOptions struct {
+	Enabled  bool
+	Secure   bool
+	SameSite http.SameSite
+	// AccessTokenTTL and RefreshTokenTTL match the lifetime of the tokens
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+// requested reports whether the client asked for the cookie session mode and it is enabled.
+func (o CookieOptions) requested(r *http.Request) bool {
+	return o.Enabled && r.Header.Get(AuthModeHeaderName) == authModeCookie
+}
+
+// setSessionCookies issues the tokens and a fresh CSRF token as cookies, the CSRF
+// token is returned so that it can also be sent in the response body.
+func (o CookieOptions) setSessionCookies(w http.ResponseWriter, tokens domain.Tokens) (string, error) {
+	csrfToken, err := newCSRFToken()
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, o.cookie(helpers.AccessTokenCookieName, tokens.AccessToken, o.AccessTokenTTL, true))
+	http.SetCookie(w, o.cookie(helpers.RefreshTokenCookieName, tokens.RefreshToken, o.RefreshTokenTTL, true))
+	// the CSRF cookie is read by the client scripts and echoed in the CSRF header
+	http.SetCookie(w, o.cookie(helpers.CSRFTokenCookieName, csrfToken, o.RefreshTokenTTL, false))
+
+	return csrfToken, nil
+}
+
+func (o CookieOptions) cookie(name, value string, ttl time.Duration, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: httpOnly,
+		Secure:   o.Secure,
+		SameSite: o.SameSite,
+	}
+}
+
+func newCSRFToken() (string, error) {
+	return randomHex(32)
+}
+
+// deviceID returns the device ID cookie of the request, issuing a new one when it
+// is missing or malformed. The ID is empty if it could not be generated, the session
+// is then not tied to a device.
+func (o CookieOptions) deviceID(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(helpers.DeviceIDCookieName); err == nil && validDeviceID(cookie.Value) {
+		return cookie.Value
+	}
+
+	id, err := randomHex(deviceIDLength)
+	if err != nil {
+		return ""
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     helpers.DeviceIDCookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(deviceIDCookieTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   o.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return id
+}
+
+func validDeviceID(id string) bool {
+	b, err := hex.DecodeString(id)
+	return err == nil && len(b) == deviceIDLength
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,58 @@
+package delivery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+)
+
+func TestSessionClient(t *testing.T) {
+	const issued = "00112233445566778899aabbccddeeff"
+
+	tests := []struct {
+		name      string
+		cookie    string
+		secure    bool
+		wantIssue bool
+	}{
+		{name: "first visit", wantIssue: true},
+		{name: "first visit over TLS", secure: true, wantIssue: true},
+		{name: "known device", cookie: issued},
+		{name: "malformed device ID", cookie: "phone", wantIssue: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/signin", http.NoBody)
+			req.Header.Set("User-Agent", "Mozilla/5.0")
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: helpers.DeviceIDCookieName, Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+
+			client := CookieOptions{Secure: tt.secure}.sessionClient(rec, req)
+
+			cookies := rec.Result().Cookies()
+			if !tt.wantIssue {
+				if client.DeviceID != tt.cookie || len(cookies) != 0 {
+					t.Errorf("device ID = %q with %d cookies, want %q kept", client.DeviceID, len(cookies), tt.cookie)
+				}
+				return
+			}
+
+			if len(cookies) != 1 || cookies[0].Name != helpers.DeviceIDCookieName || !cookies[0].HttpOnly {
+				t.Fatalf("cookies = %+v, want an HttpOnly device ID cookie", cookies)
+			}
+
+			if cookies[0].Secure != tt.secure {
+				t.Errorf("device ID cookie Secure = %v, want %v", cookies[0].Secure, tt.secure)
+			}
+
+			if client.DeviceID != cookies[0].Value || !validDeviceID(client.DeviceID) {
+				t.Errorf("device ID = %q, want the issued %q", client.DeviceID, cookies[0].Value)
+			}
+		})
+	}
+}
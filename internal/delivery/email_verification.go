@@ -0,0 +1,80 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/internal/service/throttle"
+	"github.com/mihailtudos/gophermart/internal/validator"
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+)
+
+type EmailVerificationManager interface {
+	ResendVerificationLink(ctx context.Context, userID string) error
+	VerifyEmail(ctx context.Context, token string) error
+}
+
+type emailVerificationHandler struct {
+	EmailVerificationManager
+}
+
+// resendVerification sends a new verification link to the email of the signed in user.
+func (eh emailVerificationHandler) resendVerification(w http.ResponseWriter, r *http.Request) {
+	user := helpers.ContextGetUser(r)
+
+	if err := eh.ResendVerificationLink(r.Context(), user.ID); err != nil {
+		var retryErr *throttle.RetryError
+		switch {
+		case errors.As(err, &retryErr):
+			TooManyRequestsResponse(w, r, retryErr.RetryAfter)
+		case errors.Is(err, auth.ErrEmailNotSet):
+			ErrorResponse(w, r, http.StatusConflict, "no email is set on the profile")
+		case errors.Is(err, auth.ErrEmailAlreadyVerified):
+			ErrorResponse(w, r, http.StatusConflict, "the email is already verified")
+		default:
+			ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	_, err := helpers.WriteJSON(w, http.StatusAccepted, helpers.Envelope{
+		"message": "a verification link has been sent",
+	}, nil)
+	if err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+// verifyEmail confirms the email with the token of the link, it does not need a
+// session as the link may be opened on another device.
+func (eh emailVerificationHandler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	if err := helpers.ReadJSON(w, r, &input); err != nil {
+		ErrorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Token != "", "token", "must be provided")
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := eh.VerifyEmail(r.Context(), input.Token); err != nil {
+		if errors.Is(err, auth.ErrInvalidEmailToken) {
+			ErrorResponse(w, r, http.StatusBadRequest, "invalid or expired verification link")
+			return
+		}
+
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
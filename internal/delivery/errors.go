@@ -2,7 +2,10 @@ package delivery
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/mihailtudos/gophermart/internal/logger"
 	"github.com/mihailtudos/gophermart/pkg/helpers"
@@ -30,10 +33,19 @@ func ServerErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 
 func NotFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "the requested resource could not be found"
-	ErrorResponse(w, r, http.StatusInternalServerError, message)
+	ErrorResponse(w, r, http.StatusNotFound, message)
 }
 
 func MethodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
-	ErrorResponse(w, r, http.StatusInternalServerError, message)
+	ErrorResponse(w, r, http.StatusMethodNotAllowed, message)
+}
+
+func TooManyRequestsResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	// Retry-After is in whole seconds, rounding up so clients do not retry too early
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	message := "too many failed attempts, try again later"
+	ErrorResponse(w, r, http.StatusTooManyRequests, message)
 }
@@ -0,0 +1,125 @@
+package delivery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+)
+
+const (
+	EventStreamContentType = "text/event-stream"
+	LastEventIDHeaderName  = "Last-Event-ID"
+
+	sseHeartbeatInterval = 15 * time.Second
+)
+
+func (uh *userHandler) streamEvents(w http.ResponseWriter, r *http.Request) {
+	user := helpers.ContextGetUser(r)
+	rc := http.NewResponseController(w)
+
+	// the stream is long lived, so it must not be cut by the server write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		ServerErrorResponse(w, r, fmt.Errorf("failed to disable write deadline: %w", err))
+		return
+	}
+
+	// subscribing before the replay so that no event is lost in between
+	events, unsubscribe := uh.SubscribeEvents(user.ID)
+	defer unsubscribe()
+
+	var replay []domain.Event
+	if lastEventID := r.Header.Get(LastEventIDHeaderName); lastEventID != "" {
+		changes, err := uh.GetUserOrderStatusChanges(r.Context(), user.ID, lastEventID)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		for _, change := range changes {
+			replay = append(replay, domain.Event{
+				ID:   change.ID,
+				Type: domain.EventOrderStatusChanged,
+				Data: change,
+			})
+		}
+
+		if len(replay) > 0 {
+			balance, err := uh.GetUserBalance(r.Context(), user.ID)
+			if err != nil {
+				ServerErrorResponse(w, r, err)
+				return
+			}
+
+			replay = append(replay, domain.Event{Type: domain.EventBalanceUpdated, Data: balance})
+		}
+	}
+
+	w.Header().Set(ContentTypeHeaderName, EventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range replay {
+		if err := writeEvent(w, event); err != nil {
+			logger.LogError(r.Context(), err, "failed to replay event")
+			return
+		}
+	}
+
+	if err := rc.Flush(); err != nil {
+		logger.LogError(r.Context(), err, "failed to flush event stream")
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			if err := writeEvent(w, event); err != nil {
+				logger.LogError(r.Context(), err, "failed to write event")
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			logger.LogError(r.Context(), err, "failed to flush event stream")
+			return
+		}
+	}
+}
+
+func writeEvent(w io.Writer, event domain.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	if event.ID != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", event.ID); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+
+	return err
+}
@@ -2,62 +2,173 @@ package delivery
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/validator"
 )
 
 type AuthManager interface {
-	SetSessionToken(ctx context.Context, userID string, tokens string) error
-	GenerateUserTokens(ctx context.Context, userID string) (domain.Tokens, error)
-	Login(ctx context.Context, input domain.UserAuthInput) (domain.User, error)
+	GenerateUserTokens(ctx context.Context, userID string, client domain.SessionClient) (domain.Tokens, error)
+	RefreshTokens(ctx context.Context, refreshToken string, client domain.SessionClient) (domain.Tokens, error)
+	Login(ctx context.Context, input domain.UserAuthInput, client domain.SessionClient) (domain.User, error)
 	Register(ctx context.Context, user domain.User) (string, error)
 }
 type UserManager interface {
 	RegisterOrder(ctx context.Context, order domain.Order) (domain.Order, error)
-	VerifyToken(ctx context.Context, token string) (string, error)
+	VerifyToken(ctx context.Context, token string) (domain.TokenClaims, error)
 	GetUserByID(ctx context.Context, ID string) (domain.User, error)
+	GetUserSessions(ctx context.Context, userID string) ([]domain.UserSession, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	RevokeAllSessions(ctx context.Context, userID string) error
+	Logout(ctx context.Context, claims domain.TokenClaims) error
+	ChangePassword(ctx context.Context,
+		userID string,
+		input domain.ChangePasswordInput,
+		client domain.SessionClient) (domain.Tokens, error)
 	GetUserOrders(ctx context.Context, userID string) ([]domain.UserOrder, error)
-	GetUnfinishedOrders(ctx context.Context) ([]domain.Order, error)
-	UpdateOrder(ctx context.Context, updatedOrder domain.Order) error
+	GetUserOrder(ctx context.Context, userID, orderNumber string) (domain.UserOrderDetails, error)
+	GetUnfinishedOrders(ctx context.Context, lease time.Duration) ([]domain.Order, error)
+	ReleaseOrderLease(ctx context.Context, orderNumber string) error
+	CancelOrder(ctx context.Context, userID, orderNumber string) (domain.OrderStatusChange, error)
+	UpdateOrder(ctx context.Context, updatedOrder domain.Order) (domain.OrderStatusChange, error)
+	GetUserOrderStatusChanges(ctx context.Context, userID, sinceID string) ([]domain.OrderStatusChange, error)
+	SubscribeEvents(userID string) (<-chan domain.Event, func())
 	GetUserBalance(ctx context.Context, userID string) (domain.UserBalance, error)
 	WithdrawalPoints(ctx context.Context, wp domain.Withdrawal) (string, error)
 	GetWithdrawals(ctx context.Context, userID string) ([]domain.Withdrawal, error)
 }
 
+type PasswordResetManager interface {
+	ForgotPassword(ctx context.Context, login, ip string) error
+	ResetPassword(ctx context.Context, input domain.PasswordResetInput) error
+}
+
+type TwoFactorManager interface {
+	Setup(ctx context.Context, userID string, input domain.TwoFactorSetupInput,
+		client domain.SessionClient) (domain.TwoFactorSetup, error)
+	Confirm(ctx context.Context, userID string, input domain.TwoFactorConfirmInput,
+		client domain.SessionClient) ([]string, error)
+	Disable(ctx context.Context, userID string, input domain.TwoFactorDisableInput, client domain.SessionClient) error
+	NewChallenge(ctx context.Context, userID string) (string, error)
+	CompleteLogin(ctx context.Context,
+		input domain.TwoFactorLoginInput,
+		client domain.SessionClient) (domain.Tokens, error)
+}
+
+// PasswordValidator checks new passwords against the password policy.
+type PasswordValidator interface {
+	ValidatePassword(v *validator.Validator, key, login, password string) error
+}
+
+type KeyProvider interface {
+	JWKS() domain.JWKS
+}
+
+// Options holds the HTTP settings of the handler that do not come from the services.
+type Options struct {
+	// AllowedOrigins may send credentialed cross-origin requests, when it is empty
+	// any origin is allowed but without credentials
+	AllowedOrigins []string
+	Cookies        CookieOptions
+}
+
 type Handler struct {
-	Auth        AuthManager
-	UserManager UserManager
+	Auth           AuthManager
+	UserManager    UserManager
+	WebhookManager WebhookManager
+	KeyProvider    KeyProvider
+	PasswordReset  PasswordResetManager
+	TwoFactor      TwoFactorManager
+	APIKeys        APIKeyManager
+	Admin          AdminManager
+	Accounts       AccountManager
+	Emails         EmailVerificationManager
+	OIDC           OIDCManager
+	Passwords      PasswordValidator
 }
 
-func NewHandler(ah AuthManager, um UserManager) *chi.Mux {
+func NewHandler(ah AuthManager,
+	um UserManager,
+	wm WebhookManager,
+	kp KeyProvider,
+	pm PasswordResetManager,
+	tm TwoFactorManager,
+	km APIKeyManager,
+	am AdminManager,
+	acm AccountManager,
+	em EmailVerificationManager,
+	om OIDCManager,
+	pv PasswordValidator,
+	opts Options) *chi.Mux {
 	h := &Handler{
-		Auth:        ah,
-		UserManager: um,
+		Auth:           ah,
+		UserManager:    um,
+		WebhookManager: wm,
+		KeyProvider:    kp,
+		PasswordReset:  pm,
+		TwoFactor:      tm,
+		APIKeys:        km,
+		Admin:          am,
+		Accounts:       acm,
+		Emails:         em,
+		OIDC:           om,
+		Passwords:      pv,
 	}
 
 	router := chi.NewMux()
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 
+	// browsers refuse credentials with a wildcard origin, cookies can only be
+	// used cross-origin by the origins explicitly allowed
+	allowedOrigins := []string{"*"}
+	if len(opts.AllowedOrigins) > 0 {
+		allowedOrigins = opts.AllowedOrigins
+	}
+
 	router.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "PUT", "POST", "DELETE", "HEAD", "OPTION"},
-		AllowedHeaders:   []string{"User-Agent", "Content-Type", "Accept", "Accept-Encoding", "Accept-Language", "Cache-Control", "Connection", "DNT", "Host", "Origin", "Pragma", "Referer"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
+		AllowedOrigins:   allowedOrigins,
+		AllowedMethods:   []string{"GET", "PUT", "PATCH", "POST", "DELETE", "HEAD", "OPTIONS"},
+		AllowedHeaders:   []string{"User-Agent", "Content-Type", "Accept", "Accept-Encoding", "Accept-Language", "Cache-Control", "Connection", "DNT", "Host", "Origin", "Pragma", "Referer", "If-None-Match", "If-Modified-Since", "If-Match", "X-API-Key", "X-CSRF-Token", "X-Auth-Mode"},
+		ExposedHeaders:   []string{"Link", "ETag", "Last-Modified"},
+		AllowCredentials: len(opts.AllowedOrigins) > 0,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 
-	authHandler := NewAuthHanler(h.Auth)
+	authHandler := NewAuthHanler(h.Auth, h.TwoFactor, h.Passwords, opts.Cookies)
+	passwordResetHandler := passwordResetHandler{h.PasswordReset, h.Passwords}
+	emailVerificationHandler := emailVerificationHandler{h.Emails}
+
+	router.Get("/.well-known/jwks.json", jwksHandler(h.KeyProvider))
 
 	router.Route("/api/user", func(r chi.Router) {
-		r.Mount("/", NewUserHandler(h.UserManager))
+		r.Mount("/", NewUserHandler(h.UserManager,
+			h.WebhookManager,
+			h.TwoFactor,
+			h.APIKeys,
+			h.Accounts,
+			h.Emails,
+			h.Passwords,
+			opts.Cookies))
 		r.Post("/login", authHandler.Signin)
+		r.Post("/login/2fa", authHandler.SigninTwoFactor)
 		r.Post("/register", authHandler.Signup)
+		r.Post("/token/refresh", authHandler.Refresh)
+		r.Post("/password/forgot", passwordResetHandler.forgotPassword)
+		r.Post("/password/reset", passwordResetHandler.resetPassword)
+		r.Post("/email/verify", emailVerificationHandler.verifyEmail)
+
+		// the OpenID Connect sign-in is only served when a provider is configured
+		if h.OIDC != nil {
+			r.Mount("/oidc", NewOIDCHandler(h.OIDC, h.UserManager, h.APIKeys, opts.Cookies))
+		}
 	})
 
+	router.Mount("/api/admin", NewAdminHandler(h.Admin, h.UserManager, h.APIKeys))
+
 	return router
 }
@@ -0,0 +1,23 @@
+package delivery
+
+import (
+	"net/http"
+
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+)
+
+// jwksCacheControl lets verifiers cache the keys for less than the key reload interval.
+const jwksCacheControl = "public, max-age=60"
+
+// jwksHandler publishes the public token signing keys so other services can
+// verify access tokens without sharing a secret.
+func jwksHandler(kp KeyProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		headers := make(http.Header)
+		headers.Set("Cache-Control", jwksCacheControl)
+
+		if err := helpers.WriteUnwrappedJSON(w, http.StatusOK, kp.JWKS(), headers); err != nil {
+			ServerErrorResponse(w, r, err)
+		}
+	}
+}
@@ -14,6 +14,8 @@ import (
 )
 
 const (
+	APIKeyHeaderName = "X-API-Key"
+
 	authTokenType      = "Bearer"
 	authHeaderParts    = 2
 	authTokenTypeIndex = 0
@@ -21,22 +23,49 @@ const (
 )
 
 type authService interface {
-	VerifyToken(ctx context.Context, token string) (string, error)
+	VerifyToken(ctx context.Context, token string) (domain.TokenClaims, error)
 	GetUserByID(ctx context.Context, ID string) (domain.User, error)
 }
 
+type apiKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key string) (domain.APIKey, error)
+}
+
 var bearerRegex = regexp.MustCompile(`^Bearer\s[\w-]*\.[\w-]*\.[\w-]*$`)
 
-func Authenticated(us authService) func(http.Handler) http.Handler {
+// Authenticated accepts a Bearer access token, an API key sent in the X-API-Key
+// header or, for browser clients, the access token cookie. Requests made with an
+// API key are limited to its scopes, requests made with the cookie must pass the
+// CSRF check.
+func Authenticated(us authService, keys apiKeyVerifier) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// avoid any sort of chaching
 			w.Header().Add("Vary", "Authorization")
+			w.Header().Add("Vary", APIKeyHeaderName)
+			w.Header().Add("Vary", "Cookie")
+
+			if apiKey := r.Header.Get(APIKeyHeaderName); apiKey != "" {
+				authenticateAPIKey(w, r, next, us, keys, apiKey)
+				return
+			}
+
 			authHeader := r.Header.Get("Authorization")
 
 			// Check if the Authorization header is present
 			if authHeader == "" {
-				http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+				cookie, err := r.Cookie(helpers.AccessTokenCookieName)
+				if err != nil || cookie.Value == "" {
+					http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+					return
+				}
+
+				if !ValidCSRFToken(r) {
+					http.Error(w, "missing or invalid CSRF token", http.StatusForbidden)
+					return
+				}
+
+				authenticateToken(w, r, next, us, cookie.Value)
 				return
 			}
 
@@ -52,36 +81,118 @@ func Authenticated(us authService) func(http.Handler) http.Handler {
 				return
 			}
 
-			token := headerParts[authTokenIndex]
-			id, err := us.VerifyToken(r.Context(), token)
-			if err != nil {
-				switch {
-				case errors.Is(err, auth.ErrTokenExpired):
-					http.Error(w, "token expired", http.StatusUnauthorized)
-					return
-				case errors.Is(err, auth.ErrInvalidToken):
-					http.Error(w, "invalid token", http.StatusUnauthorized)
-					return
-				default:
-					http.Error(w, "we encountered an issue, try later", http.StatusInternalServerError)
-					return
-				}
-			}
+			authenticateToken(w, r, next, us, headerParts[authTokenIndex])
+		})
+	}
+}
 
-			user, err := us.GetUserByID(r.Context(), id)
-			if err != nil {
-				switch {
-				case errors.Is(err, postgres.ErrNoRowsFound):
-					http.Error(w, "token expired", http.StatusUnauthorized)
-					return
-				default:
-					http.Error(w, "we encountered an issue, try later", http.StatusInternalServerError)
-					return
-				}
+func authenticateToken(w http.ResponseWriter,
+	r *http.Request,
+	next http.Handler,
+	us authService,
+	token string) {
+	claims, err := us.VerifyToken(r.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrTokenExpired):
+			http.Error(w, "token expired", http.StatusUnauthorized)
+			return
+		case errors.Is(err, auth.ErrTokenRevoked):
+			http.Error(w, "token revoked", http.StatusUnauthorized)
+			return
+		case errors.Is(err, auth.ErrInvalidToken):
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		default:
+			http.Error(w, "we encountered an issue, try later", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	user, err := us.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgres.ErrNoRowsFound):
+			http.Error(w, "token expired", http.StatusUnauthorized)
+			return
+		default:
+			http.Error(w, "we encountered an issue, try later", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if user.Suspended() {
+		http.Error(w, "account suspended", http.StatusForbidden)
+		return
+	}
+
+	r = helpers.ContextSetUser(r, user)
+	r = helpers.ContextSetTokenClaims(r, claims)
+	next.ServeHTTP(w, r)
+}
+
+func authenticateAPIKey(w http.ResponseWriter,
+	r *http.Request,
+	next http.Handler,
+	us authService,
+	keys apiKeyVerifier,
+	apiKey string) {
+	key, err := keys.VerifyAPIKey(r.Context(), apiKey)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAPIKey) {
+			http.Error(w, "invalid api key", http.StatusUnauthorized)
+			return
+		}
+
+		http.Error(w, "we encountered an issue, try later", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := us.GetUserByID(r.Context(), key.UserID)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			http.Error(w, "invalid api key", http.StatusUnauthorized)
+			return
+		}
+
+		http.Error(w, "we encountered an issue, try later", http.StatusInternalServerError)
+		return
+	}
+
+	if user.Suspended() {
+		http.Error(w, "account suspended", http.StatusForbidden)
+		return
+	}
+
+	r = helpers.ContextSetUser(r, user)
+	r = helpers.ContextSetAPIKey(r, key)
+	next.ServeHTTP(w, r)
+}
+
+// RequireScope rejects the requests made with an API key lacking the scope,
+// access tokens are not limited by scopes.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key, ok := helpers.ContextGetAPIKey(r); ok && !key.HasScope(scope) {
+				http.Error(w, "the api key lacks the "+scope+" scope", http.StatusForbidden)
+				return
 			}
 
-			r = helpers.ContextSetUser(r, user)
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// RequireSession rejects the requests made with an API key, it guards the account
+// management routes which need a signed in user.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := helpers.ContextGetAPIKey(r); ok {
+			http.Error(w, "this endpoint is not available to api keys", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
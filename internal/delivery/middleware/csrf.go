@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+)
+
+// ValidCSRFToken implements the double-submit check of the cookie session mode,
+// state-changing requests must echo the CSRF cookie in the CSRF header. Another
+// origin can make the browser send the cookie but can not read it to set the header.
+func ValidCSRFToken(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	cookie, err := r.Cookie(helpers.CSRFTokenCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	header := r.Header.Get(helpers.CSRFTokenHeaderName)
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) == 1
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/mihailtudos/gophermart/internal/validator"
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+)
+
+// RequireRole lets through the users holding one of the roles, it must run after
+// Authenticated. The role is read from the freshly loaded user rather than from the
+// token claim, so that a demotion takes effect right away.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := helpers.ContextGetUser(r)
+
+			if !validator.PermittedValue(user.Role, roles...) {
+				http.Error(w, "insufficient role", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
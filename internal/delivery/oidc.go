@@ -0,0 +1,171 @@
+package delivery
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mihailtudos/gophermart/internal/delivery/middleware"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/internal/service/throttle"
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+	"github.com/mihailtudos/gophermart/pkg/oidc"
+)
+
+const (
+	// oidcStateCookieName binds a sign-in to the browser that started it, so that
+	// a callback URL of someone else's sign-in can not be replayed in it
+	oidcStateCookieName = "oidc_state"
+	oidcCookiePath      = "/api/user/oidc"
+)
+
+type OIDCManager interface {
+	StartLogin(ctx context.Context, linkUserID, ip string) (domain.OIDCLogin, error)
+	Callback(ctx context.Context, code, state string, client domain.SessionClient) (domain.OIDCSignin, error)
+}
+
+type oidcHandler struct {
+	OIDCManager
+	cookies CookieOptions
+}
+
+func NewOIDCHandler(om OIDCManager, um UserManager, km APIKeyManager, cookies CookieOptions) *chi.Mux {
+	oh := oidcHandler{om, cookies}
+
+	router := chi.NewMux()
+	router.Get("/login", oh.login)
+	router.Get("/callback", oh.callback)
+
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.Authenticated(um, km))
+		r.Use(middleware.RequireSession)
+		r.Post("/link", oh.link)
+	})
+
+	return router
+}
+
+// login sends the browser to the provider to sign in.
+func (oh oidcHandler) login(w http.ResponseWriter, r *http.Request) {
+	login, err := oh.StartLogin(r.Context(), "", helpers.ClientIP(r))
+	if err != nil {
+		oh.startLoginError(w, r, err)
+		return
+	}
+
+	oh.setStateCookie(w, login)
+	http.Redirect(w, r, login.URL, http.StatusFound)
+}
+
+// link starts a sign-in at the provider which links the identity to the signed in
+// user, the client navigates to the returned URL.
+func (oh oidcHandler) link(w http.ResponseWriter, r *http.Request) {
+	user := helpers.ContextGetUser(r)
+
+	login, err := oh.StartLogin(r.Context(), user.ID, helpers.ClientIP(r))
+	if err != nil {
+		oh.startLoginError(w, r, err)
+		return
+	}
+
+	oh.setStateCookie(w, login)
+
+	_, err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"authorization_url": login.URL}, nil)
+	if err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+// callback completes the sign-in the provider redirected back from and issues the tokens.
+func (oh oidcHandler) callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		ErrorResponse(w, r, http.StatusBadRequest, "the provider refused the sign-in: "+providerErr)
+		return
+	}
+
+	code, state := query.Get("code"), query.Get("state")
+	if code == "" || state == "" {
+		ErrorResponse(w, r, http.StatusBadRequest, "the code and the state must be provided")
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookieName)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		ErrorResponse(w, r, http.StatusBadRequest, "invalid or expired sign-in state")
+		return
+	}
+
+	// the state is single-use either way
+	clearCookie := oh.stateCookie("", 0)
+	clearCookie.MaxAge = -1
+	http.SetCookie(w, clearCookie)
+
+	signin, err := oh.Callback(r.Context(), code, state, oh.cookies.sessionClient(w, r))
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidOIDCState):
+			ErrorResponse(w, r, http.StatusBadRequest, "invalid or expired sign-in state")
+		case errors.Is(err, oidc.ErrInvalidIDToken), errors.Is(err, oidc.ErrUnknownKey):
+			ErrorResponse(w, r, http.StatusUnauthorized, "the identity could not be verified")
+		case errors.Is(err, auth.ErrIdentityNotLinked):
+			ErrorResponse(w, r, http.StatusForbidden,
+				"the identity is not linked to an account, sign in and link it first")
+		case errors.Is(err, postgres.ErrIdentityAlreadyLinked):
+			ErrorResponse(w, r, http.StatusConflict, "the identity is already linked to another account")
+		case errors.Is(err, auth.ErrUserSuspended):
+			ErrorResponse(w, r, http.StatusForbidden, "account suspended")
+		default:
+			ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the tokens are only issued once the local second step is completed
+	if signin.ChallengeToken != "" {
+		_, err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{
+			"two_factor_required": true,
+			"challenge_token":     signin.ChallengeToken,
+		}, nil)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	writeTokens(w, r, signin.Tokens, oh.cookies)
+}
+
+func (oh oidcHandler) startLoginError(w http.ResponseWriter, r *http.Request, err error) {
+	var retryErr *throttle.RetryError
+	if errors.As(err, &retryErr) {
+		TooManyRequestsResponse(w, r, retryErr.RetryAfter)
+		return
+	}
+
+	ServerErrorResponse(w, r, err)
+}
+
+func (oh oidcHandler) setStateCookie(w http.ResponseWriter, login domain.OIDCLogin) {
+	http.SetCookie(w, oh.stateCookie(login.State, time.Until(login.ExpiresAt)))
+}
+
+// stateCookie is Lax regardless of the session cookies, the provider redirects
+// back with a cross-site navigation.
+func (oh oidcHandler) stateCookie(value string, ttl time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    value,
+		Path:     oidcCookiePath,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   oh.cookies.Secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,98 @@
+package delivery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/service/throttle"
+)
+
+// fakeOIDCManager asks for the two-factor authentication when the code is "two-factor".
+type fakeOIDCManager struct {
+	startErr error
+}
+
+func (f fakeOIDCManager) StartLogin(_ context.Context, _, _ string) (domain.OIDCLogin, error) {
+	return domain.OIDCLogin{URL: "https://idp.example/authorize"}, f.startErr
+}
+
+func (fakeOIDCManager) Callback(_ context.Context, code, _ string, _ domain.SessionClient) (domain.OIDCSignin, error) {
+	if code == "two-factor" {
+		return domain.OIDCSignin{ChallengeToken: "challenge"}, nil
+	}
+
+	return domain.OIDCSignin{Tokens: domain.Tokens{AccessToken: "access", RefreshToken: "refresh"}}, nil
+}
+
+func TestOIDCHandler_CallbackState(t *testing.T) {
+	oh := oidcHandler{fakeOIDCManager{}, CookieOptions{}}
+
+	tests := []struct {
+		name   string
+		query  string
+		cookie string
+		want   int
+		// wantChallenge expects a challenge token instead of the tokens
+		wantChallenge bool
+	}{
+		{name: "state bound to the browser", query: "?code=code&state=state-1", cookie: "state-1",
+			want: http.StatusOK},
+		{name: "two-factor challenge", query: "?code=two-factor&state=state-1", cookie: "state-1",
+			want: http.StatusOK, wantChallenge: true},
+		{name: "state of another browser", query: "?code=code&state=state-1", cookie: "state-2",
+			want: http.StatusBadRequest},
+		{name: "missing state cookie", query: "?code=code&state=state-1", want: http.StatusBadRequest},
+		{name: "provider error", query: "?error=access_denied", cookie: "state-1",
+			want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/callback"+tt.query, http.NoBody)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: oidcStateCookieName, Value: tt.cookie})
+			}
+
+			rec := httptest.NewRecorder()
+			oh.callback(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+
+			if got := strings.Contains(rec.Body.String(), "challenge_token"); got != tt.wantChallenge {
+				t.Errorf("body = %s, want a challenge %v", rec.Body.String(), tt.wantChallenge)
+			}
+		})
+	}
+}
+
+func TestOIDCHandler_LoginThrottle(t *testing.T) {
+	tests := []struct {
+		name     string
+		startErr error
+		want     int
+	}{
+		{name: "sign-in started", want: http.StatusFound},
+		{name: "too many sign-ins", startErr: &throttle.RetryError{RetryAfter: time.Minute},
+			want: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oh := oidcHandler{fakeOIDCManager{startErr: tt.startErr}, CookieOptions{}}
+
+			rec := httptest.NewRecorder()
+			oh.login(rec, httptest.NewRequest(http.MethodGet, "/login", http.NoBody))
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
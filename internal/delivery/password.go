@@ -0,0 +1,128 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/internal/service/throttle"
+	"github.com/mihailtudos/gophermart/internal/validator"
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+)
+
+func (uh *userHandler) changePassword(w http.ResponseWriter, r *http.Request) {
+	var input domain.ChangePasswordInput
+	if err := helpers.ReadJSON(w, r, &input); err != nil {
+		ErrorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user := helpers.ContextGetUser(r)
+
+	v := validator.New()
+	v.Check(input.CurrentPassword != "", "current_password", "must be provided")
+	v.Check(input.NewPassword != input.CurrentPassword, "password", "must differ from the current password")
+	if err := uh.passwords.ValidatePassword(v, "password", user.Login, input.NewPassword); err != nil {
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tokens, err := uh.ChangePassword(r.Context(), user.ID, input, uh.cookies.sessionClient(w, r))
+	if err != nil {
+		var retryErr *throttle.RetryError
+		switch {
+		case errors.As(err, &retryErr):
+			TooManyRequestsResponse(w, r, retryErr.RetryAfter)
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			FailedValidationResponse(w, r, map[string]string{"current_password": "is incorrect"})
+		case errors.Is(err, postgres.ErrEditConflict):
+			ErrorResponse(w, r, http.StatusConflict,
+				"the account was modified by another request, please try again")
+		default:
+			ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	writeTokens(w, r, tokens, uh.cookies)
+}
+
+type passwordResetHandler struct {
+	PasswordResetManager
+	passwords PasswordValidator
+}
+
+func (ph passwordResetHandler) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input domain.ForgotPasswordInput
+	if err := helpers.ReadJSON(w, r, &input); err != nil {
+		ErrorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Login != "", "login", "must be provided")
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := ph.ForgotPassword(r.Context(), input.Login, helpers.ClientIP(r)); err != nil {
+		var retryErr *throttle.RetryError
+		if errors.As(err, &retryErr) {
+			TooManyRequestsResponse(w, r, retryErr.RetryAfter)
+			return
+		}
+
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	// the same answer whether the login exists or not
+	_, err := helpers.WriteJSON(w, http.StatusAccepted, helpers.Envelope{
+		"message": "if the account exists, a password reset link has been sent",
+	}, nil)
+	if err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+func (ph passwordResetHandler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var input domain.PasswordResetInput
+	if err := helpers.ReadJSON(w, r, &input); err != nil {
+		ErrorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Token != "", "token", "must be provided")
+
+	// the login is only known once the token is consumed, it is not checked here
+	if err := ph.passwords.ValidatePassword(v, "password", "", input.Password); err != nil {
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := ph.ResetPassword(r.Context(), input); err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			ErrorResponse(w, r, http.StatusBadRequest, "invalid or expired reset token")
+			return
+		}
+
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,74 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/validator"
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+)
+
+func (uh *userHandler) getSessions(w http.ResponseWriter, r *http.Request) {
+	user := helpers.ContextGetUser(r)
+
+	sessions, err := uh.GetUserSessions(r.Context(), user.ID)
+	if err != nil {
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	current := helpers.ContextGetTokenClaims(r).SessionID
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	if err := helpers.WriteUnwrappedJSON(w, http.StatusOK, sessions, nil); err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+func (uh *userHandler) revokeSession(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !validator.Matches(id, validator.UUIDRX) {
+		NotFoundResponse(w, r)
+		return
+	}
+
+	user := helpers.ContextGetUser(r)
+
+	if err := uh.RevokeSession(r.Context(), user.ID, id); err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			NotFoundResponse(w, r)
+			return
+		}
+
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (uh *userHandler) logout(w http.ResponseWriter, r *http.Request) {
+	if err := uh.Logout(r.Context(), helpers.ContextGetTokenClaims(r)); err != nil {
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	helpers.ClearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (uh *userHandler) logoutAll(w http.ResponseWriter, r *http.Request) {
+	user := helpers.ContextGetUser(r)
+
+	if err := uh.RevokeAllSessions(r.Context(), user.ID); err != nil {
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	helpers.ClearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,134 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/internal/service/throttle"
+	"github.com/mihailtudos/gophermart/internal/validator"
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+)
+
+type twoFactorHandler struct {
+	TwoFactorManager
+	cookies CookieOptions
+}
+
+func (th twoFactorHandler) setup(w http.ResponseWriter, r *http.Request) {
+	var input domain.TwoFactorSetupInput
+	if err := helpers.ReadJSON(w, r, &input); err != nil {
+		ErrorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Password != "", "password", "must be provided")
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := helpers.ContextGetUser(r)
+
+	setup, err := th.Setup(r.Context(), user.ID, input, th.cookies.sessionClient(w, r))
+	if err != nil {
+		var retryErr *throttle.RetryError
+		switch {
+		case errors.As(err, &retryErr):
+			TooManyRequestsResponse(w, r, retryErr.RetryAfter)
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			FailedValidationResponse(w, r, map[string]string{"password": "is incorrect"})
+		case errors.Is(err, auth.ErrTwoFactorEnabled):
+			ErrorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+		default:
+			ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := helpers.WriteUnwrappedJSON(w, http.StatusOK, setup, nil); err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+func (th twoFactorHandler) confirm(w http.ResponseWriter, r *http.Request) {
+	var input domain.TwoFactorConfirmInput
+	if err := helpers.ReadJSON(w, r, &input); err != nil {
+		ErrorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Password != "", "password", "must be provided")
+	v.Check(input.Code != "", "code", "must be provided")
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := helpers.ContextGetUser(r)
+
+	codes, err := th.Confirm(r.Context(), user.ID, input, th.cookies.sessionClient(w, r))
+	if err != nil {
+		var retryErr *throttle.RetryError
+		switch {
+		case errors.As(err, &retryErr):
+			TooManyRequestsResponse(w, r, retryErr.RetryAfter)
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			FailedValidationResponse(w, r, map[string]string{"password": "is incorrect"})
+		case errors.Is(err, auth.ErrInvalidTwoFactorCode):
+			FailedValidationResponse(w, r, map[string]string{"code": "is incorrect"})
+		case errors.Is(err, auth.ErrTwoFactorEnabled):
+			ErrorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+		case errors.Is(err, auth.ErrTwoFactorNotEnabled):
+			ErrorResponse(w, r, http.StatusConflict, "two-factor setup has not been started")
+		default:
+			ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	_, err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+func (th twoFactorHandler) disable(w http.ResponseWriter, r *http.Request) {
+	var input domain.TwoFactorDisableInput
+	if err := helpers.ReadJSON(w, r, &input); err != nil {
+		ErrorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Password != "", "password", "must be provided")
+	v.Check(input.Code != "", "code", "must be provided")
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := helpers.ContextGetUser(r)
+
+	if err := th.Disable(r.Context(), user.ID, input, th.cookies.sessionClient(w, r)); err != nil {
+		var retryErr *throttle.RetryError
+		switch {
+		case errors.As(err, &retryErr):
+			TooManyRequestsResponse(w, r, retryErr.RetryAfter)
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			FailedValidationResponse(w, r, map[string]string{"password": "is incorrect"})
+		case errors.Is(err, auth.ErrInvalidTwoFactorCode):
+			FailedValidationResponse(w, r, map[string]string{"code": "is incorrect"})
+		case errors.Is(err, auth.ErrTwoFactorNotEnabled):
+			ErrorResponse(w, r, http.StatusConflict, "two-factor authentication is not enabled")
+		default:
+			ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,16 +1,16 @@
 package delivery
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/mihailtudos/gophermart/internal/delivery/middleware"
 	"github.com/mihailtudos/gophermart/internal/domain"
 	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
 	"github.com/mihailtudos/gophermart/internal/validator"
 	"github.com/mihailtudos/gophermart/pkg/helpers"
 )
@@ -22,21 +22,73 @@ const (
 
 type userHandler struct {
 	UserManager
+	passwords PasswordValidator
+	cookies   CookieOptions
 }
 
-func NewUserHandler(um UserManager) *chi.Mux {
-	uh := userHandler{um}
+func NewUserHandler(um UserManager,
+	wm WebhookManager,
+	tm TwoFactorManager,
+	km APIKeyManager,
+	am AccountManager,
+	em EmailVerificationManager,
+	pv PasswordValidator,
+	cookies CookieOptions) *chi.Mux {
+	uh := userHandler{um, pv, cookies}
+	wh := webhookHandler{wm}
+	th := twoFactorHandler{tm, cookies}
+	kh := apiKeyHandler{km}
+	ah := accountHandler{am, cookies}
+	eh := emailVerificationHandler{em}
 
 	router := chi.NewMux()
 
-	// user protected routes
+	// user protected routes, API keys are limited to the scope each route declares
 	router.Group(func(r chi.Router) {
-		r.Use(middleware.Authenticated(um))
-		r.Post("/orders", uh.registerOrder)
-		r.Get("/orders", uh.getOrders)
-		r.Get("/balance", uh.getBalance)
-		r.Post("/balance/withdraw", uh.withrawalPoints)
-		r.Get("/withdrawals", uh.getWithrawals)
+		r.Use(middleware.Authenticated(um, km))
+		r.With(middleware.RequireScope(domain.ScopeOrdersWrite)).Post("/orders", uh.registerOrder)
+		r.With(middleware.RequireScope(domain.ScopeOrdersRead)).Get("/orders", uh.getOrders)
+		r.With(middleware.RequireScope(domain.ScopeOrdersRead)).Get("/orders/{number}", uh.getOrder)
+		r.With(middleware.RequireScope(domain.ScopeOrdersWrite)).Delete("/orders/{number}", uh.cancelOrder)
+		r.With(middleware.RequireScope(domain.ScopeBalanceRead)).Get("/balance", uh.getBalance)
+		r.With(middleware.RequireScope(domain.ScopeBalanceWithdraw)).Post("/balance/withdraw", uh.withrawalPoints)
+		r.With(middleware.RequireScope(domain.ScopeBalanceRead)).Get("/withdrawals", uh.getWithrawals)
+		r.With(middleware.RequireScope(domain.ScopeEventsRead)).Get("/events", uh.streamEvents)
+	})
+
+	// account management routes, only available to signed in users
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.Authenticated(um, km))
+		r.Use(middleware.RequireSession)
+		r.Get("/sessions", uh.getSessions)
+		r.Delete("/sessions/{id}", uh.revokeSession)
+		r.Post("/logout", uh.logout)
+		r.Post("/logout-all", uh.logoutAll)
+		r.Put("/password", uh.changePassword)
+		r.Get("/", ah.getProfile)
+		r.Patch("/", ah.updateProfile)
+		r.Post("/email/verification", eh.resendVerification)
+		r.Get("/export", ah.exportUserData)
+		r.Delete("/", ah.deleteAccount)
+
+		r.Route("/2fa", func(r chi.Router) {
+			r.Post("/setup", th.setup)
+			r.Post("/confirm", th.confirm)
+			r.Post("/disable", th.disable)
+		})
+
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Post("/", wh.createWebhook)
+			r.Get("/", wh.getWebhooks)
+			r.Delete("/{id}", wh.deleteWebhook)
+			r.Get("/{id}/deliveries", wh.getWebhookDeliveries)
+		})
+
+		r.Route("/api-keys", func(r chi.Router) {
+			r.Post("/", kh.createAPIKey)
+			r.Get("/", kh.getAPIKeys)
+			r.Delete("/{id}", kh.deleteAPIKey)
+		})
 	})
 
 	return router
@@ -82,6 +134,9 @@ func (uh *userHandler) registerOrder(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, postgres.ErrOrderAlreadyExistsDifferentUser):
 			w.WriteHeader(http.StatusConflict)
 			return
+		case errors.Is(err, postgres.ErrOrderCancelled):
+			ErrorResponse(w, r, http.StatusConflict, "the order has been cancelled and can not be uploaded again")
+			return
 		default:
 			ServerErrorResponse(w, r, err)
 			return
@@ -100,10 +155,21 @@ func (uh *userHandler) getOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fmt.Printf("%#v", orders)
-	fmt.Println("order cOunt", len(orders))
+	// the cancelled orders are left out, their cancellation still changes the list
+	// so it counts for the conditional requests
+	var lastModified time.Time
+	listed := make([]domain.UserOrder, 0, len(orders))
+	for _, order := range orders {
+		if order.UpdatedAt.After(lastModified) {
+			lastModified = order.UpdatedAt
+		}
 
-	if len(orders) == 0 {
+		if order.Status != domain.OrderStatusCancelled {
+			listed = append(listed, order)
+		}
+	}
+
+	if len(listed) == 0 {
 		_, err := helpers.WriteJSON(w, http.StatusNoContent, nil, nil)
 		if err != nil {
 			ServerErrorResponse(w, r, err)
@@ -112,20 +178,70 @@ func (uh *userHandler) getOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	js, err := json.MarshalIndent(orders, "", "\t")
+	if err := writeConditionalJSON(w, r, listed, lastModified); err != nil {
+		ServerErrorResponse(w, r, err)
+		return
+	}
+}
+
+func (uh *userHandler) getOrder(w http.ResponseWriter, r *http.Request) {
+	number := chi.URLParam(r, "number")
+
+	v := validator.New()
+	v.Check(validator.IsValidOrderNumber(number), "order number", "invalid order number format")
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := helpers.ContextGetUser(r)
+
+	order, err := uh.GetUserOrder(r.Context(), user.ID, number)
 	if err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			NotFoundResponse(w, r)
+			return
+		}
+
 		ServerErrorResponse(w, r, err)
 		return
 	}
-	js = append(js, '\n')
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(js); err != nil {
+
+	if err := helpers.WriteUnwrappedJSON(w, http.StatusOK, order, nil); err != nil {
 		ServerErrorResponse(w, r, err)
 		return
 	}
 }
 
+// cancelOrder cancels an order uploaded by mistake. Cancelling is final, the order is left
+// out of the orders list and its number can not be uploaded again.
+func (uh *userHandler) cancelOrder(w http.ResponseWriter, r *http.Request) {
+	number := chi.URLParam(r, "number")
+
+	v := validator.New()
+	v.Check(validator.IsValidOrderNumber(number), "order number", "invalid order number format")
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := helpers.ContextGetUser(r)
+
+	if _, err := uh.CancelOrder(r.Context(), user.ID, number); err != nil {
+		switch {
+		case errors.Is(err, postgres.ErrNoRowsFound):
+			NotFoundResponse(w, r)
+		case errors.Is(err, postgres.ErrOrderNotCancellable):
+			ErrorResponse(w, r, http.StatusConflict, "the order can no longer be cancelled")
+		default:
+			ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (uh *userHandler) getBalance(w http.ResponseWriter, r *http.Request) {
 	user := helpers.ContextGetUser(r)
 
@@ -135,7 +251,7 @@ func (uh *userHandler) getBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := helpers.WriteUnwrappedJSON(w, http.StatusOK, balance, nil); err != nil {
+	if err := writeConditionalJSON(w, r, balance, balance.UpdatedAt); err != nil {
 		ServerErrorResponse(w, r, err)
 		return
 	}
@@ -166,6 +282,11 @@ func (uh *userHandler) withrawalPoints(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			ErrorResponse(w, r, http.StatusForbidden, "a verified email is required to withdraw points")
+			return
+		}
+
 		ServerErrorResponse(w, r, err)
 		return
 	}
@@ -184,7 +305,14 @@ func (uh *userHandler) getWithrawals(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := helpers.WriteUnwrappedJSON(w, http.StatusOK, withdrawals, nil); err != nil {
+	var lastModified time.Time
+	for _, withdrawal := range withdrawals {
+		if withdrawal.UpdatedAt.After(lastModified) {
+			lastModified = withdrawal.UpdatedAt
+		}
+	}
+
+	if err := writeConditionalJSON(w, r, withdrawals, lastModified); err != nil {
 		ServerErrorResponse(w, r, err)
 		return
 	}
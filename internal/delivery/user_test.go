@@ -0,0 +1,270 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/internal/service/throttle"
+	"github.com/mihailtudos/gophermart/internal/validator"
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+)
+
+// fakeUserManager only implements the methods the tests call, the others panic
+// on the nil embedded interface.
+type fakeUserManager struct {
+	UserManager
+	orders            map[string]domain.UserOrderDetails
+	changePasswordErr error
+}
+
+func (f *fakeUserManager) ChangePassword(_ context.Context, _ string, _ domain.ChangePasswordInput,
+	_ domain.SessionClient) (domain.Tokens, error) {
+	if f.changePasswordErr != nil {
+		return domain.Tokens{}, f.changePasswordErr
+	}
+
+	return domain.Tokens{AccessToken: "access", RefreshToken: "refresh"}, nil
+}
+
+// acceptAnyPassword is a password policy accepting every password.
+type acceptAnyPassword struct{}
+
+func (acceptAnyPassword) ValidatePassword(_ *validator.Validator, _, _, _ string) error { return nil }
+
+func (f *fakeUserManager) GetUserOrder(_ context.Context,
+	userID, orderNumber string) (domain.UserOrderDetails, error) {
+	order, ok := f.orders[userID+"|"+orderNumber]
+	if !ok {
+		return domain.UserOrderDetails{}, postgres.ErrNoRowsFound
+	}
+
+	return order, nil
+}
+
+func (f *fakeUserManager) GetUserOrders(_ context.Context, userID string) ([]domain.UserOrder, error) {
+	var orders []domain.UserOrder
+	for key, order := range f.orders {
+		if strings.HasPrefix(key, userID+"|") {
+			orders = append(orders, order.UserOrder)
+		}
+	}
+
+	return orders, nil
+}
+
+func (f *fakeUserManager) CancelOrder(_ context.Context,
+	userID, orderNumber string) (domain.OrderStatusChange, error) {
+	order, ok := f.orders[userID+"|"+orderNumber]
+	if !ok {
+		return domain.OrderStatusChange{}, postgres.ErrNoRowsFound
+	}
+
+	if order.Status != domain.OrderStatusNew {
+		return domain.OrderStatusChange{}, postgres.ErrOrderNotCancellable
+	}
+
+	return domain.OrderStatusChange{OrderNumber: orderNumber, NewStatus: domain.OrderStatusCancelled}, nil
+}
+
+// serveAs routes the request to the handler as if the user was authenticated.
+func serveAs(userID, pattern string, handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	router := chi.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, helpers.ContextSetUser(r, domain.User{ID: userID}))
+		})
+	})
+	router.MethodFunc(req.Method, pattern, handler)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestUserHandler_GetOrder(t *testing.T) {
+	processing := domain.OrderStatusProcessing
+	um := &fakeUserManager{orders: map[string]domain.UserOrderDetails{
+		"user-1|12345678903": {
+			UserOrder: domain.UserOrder{Number: "12345678903", Status: domain.OrderStatusProcessed, Accrual: 500},
+			History: []domain.OrderStatusChange{
+				{OrderNumber: "12345678903", NewStatus: domain.OrderStatusNew, Source: domain.OrderStatusSourceUser},
+				{OrderNumber: "12345678903", OldStatus: &processing, NewStatus: domain.OrderStatusProcessed,
+					Accrual: 500, Source: domain.OrderStatusSourcePoller},
+			},
+		},
+	}}
+	uh := &userHandler{UserManager: um}
+
+	tests := []struct {
+		name        string
+		userID      string
+		number      string
+		want        int
+		wantHistory int
+	}{
+		{name: "own order", userID: "user-1", number: "12345678903", want: http.StatusOK, wantHistory: 2},
+		{name: "unknown order", userID: "user-1", number: "9278923470", want: http.StatusNotFound},
+		{name: "order of another user", userID: "user-2", number: "12345678903", want: http.StatusNotFound},
+		{name: "invalid order number", userID: "user-1", number: "12345678900",
+			want: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/orders/"+tt.number, http.NoBody)
+			rec := serveAs(tt.userID, "/orders/{number}", uh.getOrder, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var got domain.UserOrderDetails
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Number != tt.number || len(got.History) != tt.wantHistory {
+				t.Errorf("order = %+v, want %s with %d history entries", got, tt.number, tt.wantHistory)
+			}
+		})
+	}
+}
+
+func TestUserHandler_GetOrders(t *testing.T) {
+	uploaded := time.Date(2024, 9, 20, 10, 0, 0, 0, time.UTC)
+	cancelled := uploaded.Add(time.Hour)
+
+	um := &fakeUserManager{orders: map[string]domain.UserOrderDetails{
+		"user-1|12345678903": {UserOrder: domain.UserOrder{Number: "12345678903", Status: domain.OrderStatusNew,
+			UpdatedAt: uploaded}},
+		"user-1|9278923470": {UserOrder: domain.UserOrder{Number: "9278923470", Status: domain.OrderStatusCancelled,
+			UpdatedAt: cancelled}},
+		"user-2|9278923470": {UserOrder: domain.UserOrder{Number: "9278923470", Status: domain.OrderStatusCancelled,
+			UpdatedAt: cancelled}},
+	}}
+	uh := &userHandler{UserManager: um}
+
+	tests := []struct {
+		name   string
+		userID string
+		want   int
+		// wantOrders are the listed orders
+		wantOrders []string
+	}{
+		{name: "cancelled orders left out", userID: "user-1", want: http.StatusOK, wantOrders: []string{"12345678903"}},
+		{name: "only cancelled orders", userID: "user-2", want: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/orders", http.NoBody)
+			rec := serveAs(tt.userID, "/orders", uh.getOrders, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var got []domain.UserOrder
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+
+			var numbers []string
+			for _, order := range got {
+				numbers = append(numbers, order.Number)
+			}
+
+			if fmt.Sprint(numbers) != fmt.Sprint(tt.wantOrders) {
+				t.Errorf("orders = %v, want %v", numbers, tt.wantOrders)
+			}
+
+			// the cancellation changed the list even though the order is not listed
+			if got := rec.Header().Get(LastModifiedHeaderName); got != cancelled.Format(http.TimeFormat) {
+				t.Errorf("Last-Modified = %q, want %q", got, cancelled.Format(http.TimeFormat))
+			}
+		})
+	}
+}
+
+func TestUserHandler_CancelOrder(t *testing.T) {
+	um := &fakeUserManager{orders: map[string]domain.UserOrderDetails{
+		"user-1|12345678903": {UserOrder: domain.UserOrder{Number: "12345678903", Status: domain.OrderStatusNew}},
+		"user-1|9278923470": {UserOrder: domain.UserOrder{Number: "9278923470",
+			Status: domain.OrderStatusProcessing}},
+	}}
+	uh := &userHandler{UserManager: um}
+
+	tests := []struct {
+		name   string
+		userID string
+		number string
+		want   int
+	}{
+		{name: "own new order", userID: "user-1", number: "12345678903", want: http.StatusNoContent},
+		{name: "own order being processed", userID: "user-1", number: "9278923470", want: http.StatusConflict},
+		{name: "order of another user", userID: "user-2", number: "12345678903", want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/orders/"+tt.number, http.NoBody)
+			rec := serveAs(tt.userID, "/orders/{number}", uh.cancelOrder, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserHandler_ChangePassword(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  error
+		want int
+	}{
+		{name: "password changed", body: `{"current_password":"correct horse","new_password":"battery staple"}`,
+			want: http.StatusOK},
+		{name: "wrong current password", body: `{"current_password":"wrong horse","new_password":"battery staple"}`,
+			err: auth.ErrInvalidCredentials, want: http.StatusUnprocessableEntity},
+		{name: "version conflict", body: `{"current_password":"correct horse","new_password":"battery staple"}`,
+			err: fmt.Errorf("update: %w", postgres.ErrEditConflict), want: http.StatusConflict},
+		{name: "too many attempts", body: `{"current_password":"wrong horse","new_password":"battery staple"}`,
+			err: &throttle.RetryError{RetryAfter: time.Minute}, want: http.StatusTooManyRequests},
+		{name: "same password", body: `{"current_password":"correct horse","new_password":"correct horse"}`,
+			want: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uh := &userHandler{UserManager: &fakeUserManager{changePasswordErr: tt.err}, passwords: acceptAnyPassword{}}
+
+			req := httptest.NewRequest(http.MethodPut, "/password", strings.NewReader(tt.body))
+			rec := serveAs("user-1", "/password", uh.changePassword, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
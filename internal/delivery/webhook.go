@@ -0,0 +1,134 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/validator"
+	"github.com/mihailtudos/gophermart/pkg/helpers"
+	"github.com/mihailtudos/gophermart/pkg/netguard"
+)
+
+type WebhookManager interface {
+	CreateWebhook(ctx context.Context, webhook domain.Webhook) (domain.Webhook, error)
+	GetWebhooks(ctx context.Context, userID string) ([]domain.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID, webhookID string) error
+	GetWebhookDeliveries(ctx context.Context, userID, webhookID string) ([]domain.WebhookDelivery, error)
+}
+
+type webhookHandler struct {
+	WebhookManager
+}
+
+func (wh *webhookHandler) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+
+	if err := helpers.ReadJSON(w, r, &input); err != nil {
+		ErrorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user := helpers.ContextGetUser(r)
+	webhook := domain.Webhook{
+		UserID: user.ID,
+		URL:    input.URL,
+		Events: input.Events,
+	}
+
+	// subscribing to all the events when none are specified
+	if len(webhook.Events) == 0 {
+		webhook.Events = domain.WebhookEvents
+	}
+
+	v := validator.New()
+	domain.ValidateWebhook(v, &webhook)
+	if !v.Valid() {
+		FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	webhook, err := wh.CreateWebhook(r.Context(), webhook)
+	if err != nil {
+		switch {
+		case errors.Is(err, netguard.ErrForbiddenAddress):
+			FailedValidationResponse(w, r, map[string]string{"url": "must not point to a private or local address"})
+		case errors.Is(err, netguard.ErrUnresolvableHost):
+			FailedValidationResponse(w, r, map[string]string{"url": "the host could not be resolved"})
+		default:
+			ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := helpers.WriteUnwrappedJSON(w, http.StatusCreated, webhook, nil); err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+func (wh *webhookHandler) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	user := helpers.ContextGetUser(r)
+
+	webhooks, err := wh.GetWebhooks(r.Context(), user.ID)
+	if err != nil {
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if err := helpers.WriteUnwrappedJSON(w, http.StatusOK, webhooks, nil); err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
+
+func (wh *webhookHandler) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !validator.Matches(id, validator.UUIDRX) {
+		NotFoundResponse(w, r)
+		return
+	}
+
+	user := helpers.ContextGetUser(r)
+
+	if err := wh.DeleteWebhook(r.Context(), user.ID, id); err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			NotFoundResponse(w, r)
+			return
+		}
+
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (wh *webhookHandler) getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !validator.Matches(id, validator.UUIDRX) {
+		NotFoundResponse(w, r)
+		return
+	}
+
+	user := helpers.ContextGetUser(r)
+
+	deliveries, err := wh.GetWebhookDeliveries(r.Context(), user.ID, id)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			NotFoundResponse(w, r)
+			return
+		}
+
+		ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if err := helpers.WriteUnwrappedJSON(w, http.StatusOK, deliveries, nil); err != nil {
+		ServerErrorResponse(w, r, err)
+	}
+}
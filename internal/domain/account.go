@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+// UserExport is the personal data export of an account, the balance history is
+// made of the order accruals, the withdrawals and the manual adjustments.
+type UserExport struct {
+	ExportedAt  time.Time           `json:"exported_at"`
+	Profile     User                `json:"profile"`
+	Balance     UserBalance         `json:"balance"`
+	Orders      []UserOrderDetails  `json:"orders"`
+	Withdrawals []Withdrawal        `json:"withdrawals"`
+	Adjustments []BalanceAdjustment `json:"balance_adjustments"`
+	Sessions    []UserSession       `json:"sessions"`
+}
+
+type DeleteAccountInput struct {
+	Password string `json:"password"`
+}
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"math"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/validator"
+)
+
+const (
+	AdjustmentReasonGoodwill   = "goodwill"
+	AdjustmentReasonCorrection = "correction"
+	AdjustmentReasonFraud      = "fraud"
+	AdjustmentReasonOther      = "other"
+)
+
+var AdjustmentReasons = []string{
+	AdjustmentReasonGoodwill,
+	AdjustmentReasonCorrection,
+	AdjustmentReasonFraud,
+	AdjustmentReasonOther,
+}
+
+// maxAdjustmentAmount keeps a typo from crediting a fortune, larger changes need several adjustments
+const maxAdjustmentAmount = 100000
+
+// BalanceAdjustment is a manual credit, positive Amount, or debit made by support staff.
+// Forced adjustments were allowed to push the balance below zero.
+type BalanceAdjustment struct {
+	ID            string    `json:"id"`
+	UserID        string    `json:"user_id"`
+	ActorID       string    `json:"actor_id"`
+	Amount        float64   `json:"amount"`
+	ReasonCode    string    `json:"reason_code"`
+	Note          string    `json:"note"`
+	Forced        bool      `json:"forced"`
+	BalanceBefore float64   `json:"balance_before"`
+	BalanceAfter  float64   `json:"balance_after"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func ValidateBalanceAdjustment(v *validator.Validator, adj *BalanceAdjustment) {
+	v.Check(adj.Amount != 0, "amount", "must not be zero")
+	v.Check(math.Abs(adj.Amount) <= maxAdjustmentAmount, "amount", "must not be more than 100000 points")
+	v.Check(math.Round(adj.Amount*100)/100 == adj.Amount, "amount", "must not have more than 2 decimals")
+
+	v.Check(validator.PermittedValue(adj.ReasonCode, AdjustmentReasons...), "reason_code",
+		"must be one of goodwill, correction, fraud or other")
+
+	v.Check(adj.Note != "", "note", "must be provided")
+	v.Check(len(adj.Note) <= 1000, "note", "must not be more than 1000 bytes long")
+}
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/validator"
+)
+
+const (
+	ScopeOrdersRead      = "orders:read"
+	ScopeOrdersWrite     = "orders:write"
+	ScopeBalanceRead     = "balance:read"
+	ScopeBalanceWithdraw = "balance:withdraw"
+	ScopeEventsRead      = "events:read"
+)
+
+var APIKeyScopes = []string{
+	ScopeOrdersRead,
+	ScopeOrdersWrite,
+	ScopeBalanceRead,
+	ScopeBalanceWithdraw,
+	ScopeEventsRead,
+}
+
+// APIKey lets a machine client act on behalf of a user within its scopes, Key
+// is only set when the key is created.
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Key        string     `json:"key,omitempty"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	return validator.PermittedValue(scope, k.Scopes...)
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(key.Scopes) > 0, "scopes", "must contain at least one scope")
+	v.Check(validator.Unique(key.Scopes), "scopes", "must not contain duplicate values")
+	for _, scope := range key.Scopes {
+		v.Check(validator.PermittedValue(scope, APIKeyScopes...), "scopes", "contains an unknown scope "+scope)
+	}
+}
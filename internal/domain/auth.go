@@ -1,11 +1,44 @@
 package domain
 
+import "time"
+
 type UserAuthInput struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
 }
 
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ForgotPasswordInput struct {
+	Login string `json:"login"`
+}
+
+type PasswordResetInput struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
 type Tokens struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 }
+
+// ChallengeClaims identify a two-factor challenge token, the ID is consumed by the
+// first attempt to complete the sign-in.
+type ChallengeClaims struct {
+	ID        string
+	UserID    string
+	ExpiresAt time.Time
+}
+
+// TokenClaims holds the identity carried by a verified access token.
+type TokenClaims struct {
+	ID        string
+	UserID    string
+	SessionID string
+	Role      string
+	IssuedAt  time.Time
+}
@@ -0,0 +1,14 @@
+package domain
+
+// Event is a notification about a change in the user data
+// delivered to the user subscribers.
+type Event struct {
+	ID   string
+	Type string
+	Data any
+}
+
+const (
+	EventOrderStatusChanged = "order.status_changed"
+	EventBalanceUpdated     = "balance.updated"
+)
@@ -0,0 +1,11 @@
+package domain
+
+import "time"
+
+// LoginAttempts tracks the failed sign-ins of a login or a client IP.
+type LoginAttempts struct {
+	Key          string
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+}
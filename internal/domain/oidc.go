@@ -0,0 +1,39 @@
+package domain
+
+import "time"
+
+// OIDCState is a sign-in started at the OpenID provider, it is looked up by the
+// hash of the state parameter when the provider redirects back.
+type OIDCState struct {
+	StateHash    string
+	CodeVerifier string
+	Nonce        string
+	// LinkUserID is set when a signed-in user links the identity to their account
+	LinkUserID string
+	ExpiresAt  time.Time
+}
+
+// UserIdentity links an account of the OpenID provider to a user.
+type UserIdentity struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCLogin is a sign-in started at the provider, the client is sent to URL and
+// State is bound to its browser until the provider redirects back.
+type OIDCLogin struct {
+	URL       string
+	State     string
+	ExpiresAt time.Time
+}
+
+// OIDCSignin is the outcome of a sign-in at the provider, a user with the two-factor
+// authentication enabled gets a ChallengeToken instead of the tokens.
+type OIDCSignin struct {
+	Tokens         Tokens
+	ChallengeToken string
+}
@@ -9,13 +9,34 @@ type Order struct {
 	Accrual     float64   `json:"accrual" db:"accrual"`
 	CreatedAt   time.Time `json:"-" db:"created_at"`
 	UpdatedAt   time.Time `json:"-" db:"updated_at"`
+
+	// StatusSource tells who triggered the status change, it is stored in the order history
+	StatusSource string `json:"-" db:"-"`
 }
 
 type UserOrder struct {
-	Number     string  `json:"number"`
-	Status     string  `json:"status"`
-	Accrual    float64 `json:"accrual"`
-	UploadedAt string  `json:"uploaded_at"`
+	Number     string    `json:"number"`
+	Status     string    `json:"status"`
+	Accrual    float64   `json:"accrual"`
+	UploadedAt string    `json:"uploaded_at"`
+	UpdatedAt  time.Time `json:"-"`
+}
+
+type UserOrderDetails struct {
+	UserOrder
+	History []OrderStatusChange `json:"history"`
+}
+
+type OrderStatusChange struct {
+	ID          string    `json:"-"`
+	OrderNumber string    `json:"number"`
+	UserID      string    `json:"-"`
+	OldStatus   *string   `json:"old_status"`
+	NewStatus   string    `json:"new_status"`
+	Accrual     float64   `json:"accrual"`
+	Source      string    `json:"source"`
+	CreatedAt   time.Time `json:"-"`
+	ChangedAt   string    `json:"changed_at"`
 }
 
 const (
@@ -23,4 +44,12 @@ const (
 	OrderStatusProcessing = "PROCESSING"
 	OrderStatusInvalid    = "INVALID"
 	OrderStatusProcessed  = "PROCESSED"
+	OrderStatusCancelled  = "CANCELLED"
+)
+
+const (
+	OrderStatusSourceUser    = "user"
+	OrderStatusSourcePoller  = "poller"
+	OrderStatusSourceWebhook = "webhook"
+	OrderStatusSourceAdmin   = "admin"
 )
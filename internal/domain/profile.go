@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"regexp"
+	"time"
+	"unicode/utf8"
+
+	// the time zones are validated the same way whether or not the host has them installed
+	_ "time/tzdata"
+
+	"github.com/mihailtudos/gophermart/internal/validator"
+)
+
+const displayNameMaxLength = 100
+
+// AnyProfileVersion updates the current version of the profile, whichever it is.
+// It is what the clients ask for with If-Match: *.
+const AnyProfileVersion = -1
+
+// LocaleRX matches a language tag with an optional region, e.g. en or en-GB
+var LocaleRX = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+// UserProfile is the part of the account the user manages themselves.
+type UserProfile struct {
+	DisplayName      string `json:"display_name"`
+	Email            string `json:"email"`
+	Locale           string `json:"locale"`
+	Timezone         string `json:"timezone"`
+	MarketingConsent bool   `json:"marketing_consent"`
+	// EmailVerifiedAt is set once the user followed the link sent to the email, it
+	// is not part of the updates
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+}
+
+func (p UserProfile) EmailVerified() bool {
+	return p.Email != "" && p.EmailVerifiedAt != nil
+}
+
+// UserProfileInput is a partial profile update, the fields left out are kept.
+type UserProfileInput struct {
+	DisplayName      *string `json:"display_name"`
+	Email            *string `json:"email"`
+	Locale           *string `json:"locale"`
+	Timezone         *string `json:"timezone"`
+	MarketingConsent *bool   `json:"marketing_consent"`
+}
+
+func (p *UserProfile) Apply(input UserProfileInput) {
+	if input.DisplayName != nil {
+		p.DisplayName = *input.DisplayName
+	}
+
+	if input.Email != nil {
+		p.Email = *input.Email
+	}
+
+	if input.Locale != nil {
+		p.Locale = *input.Locale
+	}
+
+	if input.Timezone != nil {
+		p.Timezone = *input.Timezone
+	}
+
+	if input.MarketingConsent != nil {
+		p.MarketingConsent = *input.MarketingConsent
+	}
+}
+
+// ValidateUserProfileInput checks the fields of the update which are set.
+func ValidateUserProfileInput(v *validator.Validator, input UserProfileInput) {
+	v.Check(input != (UserProfileInput{}), "profile", "must contain at least one field")
+
+	if input.DisplayName != nil {
+		v.Check(utf8.ValidString(*input.DisplayName), "display_name", "must be valid UTF-8")
+		v.Check(utf8.RuneCountInString(*input.DisplayName) <= displayNameMaxLength, "display_name",
+			"must not be more than 100 characters long")
+	}
+
+	// the email is optional, an empty one removes it
+	if input.Email != nil && *input.Email != "" {
+		ValidateEmail(v, *input.Email)
+	}
+
+	if input.Locale != nil {
+		v.Check(validator.Matches(*input.Locale, LocaleRX), "locale", "must be a language tag such as en or en-GB")
+	}
+
+	if input.Timezone != nil {
+		v.Check(validTimezone(*input.Timezone), "timezone", "must be an IANA time zone such as Europe/London")
+	}
+}
+
+func validTimezone(name string) bool {
+	// LoadLocation maps the empty name to UTC and Local to the zone of the host
+	if name == "" || name == "Local" {
+		return false
+	}
+
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mihailtudos/gophermart/internal/validator"
+)
+
+func TestValidateUserProfileInput(t *testing.T) {
+	str := func(s string) *string { return &s }
+	consent := true
+
+	tests := []struct {
+		name    string
+		input   UserProfileInput
+		wantKey string
+	}{
+		{name: "empty update", input: UserProfileInput{}, wantKey: "profile"},
+		{name: "consent only", input: UserProfileInput{MarketingConsent: &consent}},
+		{name: "all fields", input: UserProfileInput{
+			DisplayName: str("Gopher"),
+			Email:       str("gopher@example.com"),
+			Locale:      str("en-GB"),
+			Timezone:    str("Europe/Chisinau"),
+		}},
+		{name: "email removed", input: UserProfileInput{Email: str("")}},
+		{name: "invalid email", input: UserProfileInput{Email: str("gopher")}, wantKey: "email"},
+		{name: "long display name", input: UserProfileInput{DisplayName: str(strings.Repeat("ă", 101))},
+			wantKey: "display_name"},
+		{name: "invalid locale", input: UserProfileInput{Locale: str("english")}, wantKey: "locale"},
+		{name: "unknown timezone", input: UserProfileInput{Timezone: str("Mars/Olympus")}, wantKey: "timezone"},
+		{name: "host timezone", input: UserProfileInput{Timezone: str("Local")}, wantKey: "timezone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateUserProfileInput(v, tt.input)
+
+			if tt.wantKey == "" && !v.Valid() {
+				t.Errorf("unexpected errors %v", v.Errors)
+			}
+
+			if _, ok := v.Errors[tt.wantKey]; tt.wantKey != "" && !ok {
+				t.Errorf("errors = %v, want one for %q", v.Errors, tt.wantKey)
+			}
+		})
+	}
+}
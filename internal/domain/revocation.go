@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// TokenRevocation revokes a single access token by its JTI, or every access token
+// of a session or a user issued before RevokedAt. The entry is kept until ExpiresAt,
+// when all the tokens it covers have expired on their own.
+type TokenRevocation struct {
+	JTI       *string
+	SessionID *string
+	UserID    *string
+	RevokedAt time.Time
+	ExpiresAt time.Time
+}
@@ -2,12 +2,56 @@ package domain
 
 import "time"
 
+// MaxUserSessions is the number of sessions a user can keep open, signing in on
+// another device ends the least recently refreshed ones.
+const MaxUserSessions = 10
+
 type Session struct {
-	ID         string    `json:"-"`
-	UserID     string    `json:"-"`
-	Token      string    `json:"token"`
-	ExpiresAt  time.Time `json:"-"`
-	CreatedAt  time.Time `json:"-"`
-	DeviceInfo *string   `json:"-"`
-	IPAddress  *string   `json:"-"`
+	ID         string     `json:"-"`
+	UserID     string     `json:"-"`
+	TokenHash  string     `json:"-"`
+	ExpiresAt  time.Time  `json:"-"`
+	CreatedAt  time.Time  `json:"-"`
+	DeviceID   *string    `json:"-"`
+	DeviceInfo *string    `json:"-"`
+	IPAddress  *string    `json:"-"`
+	FamilyID   string     `json:"-"`
+	ParentID   *string    `json:"-"`
+	UsedAt     *time.Time `json:"-"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+// SetClient records the device the session was opened from, empty values are stored as NULL.
+func (s *Session) SetClient(client SessionClient) {
+	if client.DeviceID != "" {
+		s.DeviceID = &client.DeviceID
+	}
+
+	if client.DeviceInfo != "" {
+		s.DeviceInfo = &client.DeviceInfo
+	}
+
+	if client.IPAddress != "" {
+		s.IPAddress = &client.IPAddress
+	}
+}
+
+// SessionClient describes the device a session was opened from, the DeviceID is
+// issued by the server and identifies the device across logins.
+type SessionClient struct {
+	DeviceID   string
+	DeviceInfo string
+	IPAddress  string
+}
+
+// UserSession is a logged in device, its ID is the token family ID so it stays
+// the same across refresh token rotations.
+type UserSession struct {
+	ID         string    `json:"id"`
+	DeviceInfo *string   `json:"device_info"`
+	IPAddress  *string   `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
 }
@@ -0,0 +1,44 @@
+package domain
+
+import "time"
+
+// TwoFactor is the TOTP state of a user, PendingSecret holds the secret of an
+// enrollment that was not confirmed yet.
+type TwoFactor struct {
+	UserID        string
+	Secret        *string
+	PendingSecret *string
+	EnabledAt     *time.Time
+	LastStep      int64
+}
+
+func (tf TwoFactor) Enabled() bool {
+	return tf.EnabledAt != nil && tf.Secret != nil
+}
+
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// TwoFactorSetupInput starts an enrollment, the password is required so that a
+// stolen access token is not enough.
+type TwoFactorSetupInput struct {
+	Password string `json:"password"`
+}
+
+type TwoFactorConfirmInput struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type TwoFactorDisableInput struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// TwoFactorLoginInput completes a sign-in, Code is a TOTP or a recovery code.
+type TwoFactorLoginInput struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
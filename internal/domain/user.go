@@ -1,7 +1,14 @@
 package domain
 
 import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mihailtudos/gophermart/internal/validator"
@@ -10,6 +17,14 @@ import (
 
 var ErrInvalidHash = errors.New("invalid hash")
 
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+var Roles = []string{RoleUser, RoleSupport, RoleAdmin}
+
 // swap to UUID
 type User struct {
 	ID        string    `json:"id,omitempty"`
@@ -18,6 +33,64 @@ type User struct {
 	Version   int       `json:"-"`
 	CreatedAt time.Time `json:"created_at,omitempty"`
 	UpdatedAt time.Time `json:"updated_at,omitempty"`
+
+	Role string `json:"role"`
+	// SuspendedAt is set while the account is suspended, a suspended user can not sign in
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+	// TwoFactorEnabled requires a TOTP code on sign-in
+	TwoFactorEnabled bool `json:"-"`
+
+	UserProfile
+}
+
+func (u User) Suspended() bool {
+	return u.SuspendedAt != nil
+}
+
+// UserFilter narrows the users listed by the admin search.
+type UserFilter struct {
+	Login  string
+	Role   string
+	Limit  int
+	Offset int
+}
+
+// UserDetails is the account overview shown to support staff.
+type UserDetails struct {
+	User        User         `json:"user"`
+	Balance     UserBalance  `json:"balance"`
+	Orders      []UserOrder  `json:"orders"`
+	Withdrawals []Withdrawal `json:"withdrawals"`
+}
+
+func ValidateUserFilter(v *validator.Validator, f UserFilter) {
+	v.Check(f.Role == "" || validator.PermittedValue(f.Role, Roles...), "role", "must be one of user, support or admin")
+	v.Check(f.Limit > 0 && f.Limit <= 100, "limit", "must be between 1 and 100")
+	v.Check(f.Offset >= 0, "offset", "must not be negative")
+}
+
+// DefaultPasswordCost is the bcrypt cost of new hashes until SetPasswordCost is called.
+const DefaultPasswordCost = 12
+
+var passwordCost atomic.Int32
+
+// SetPasswordCost sets the bcrypt cost of the hashes created from now on, the
+// hashes of a lower cost are upgraded as users sign in.
+func SetPasswordCost(cost int) error {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("the bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	passwordCost.Store(int32(cost))
+	return nil
+}
+
+func currentPasswordCost() int {
+	if cost := passwordCost.Load(); cost != 0 {
+		return int(cost)
+	}
+
+	return DefaultPasswordCost
 }
 
 type password struct {
@@ -26,7 +99,7 @@ type password struct {
 }
 
 func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), currentPasswordCost())
 	if err != nil {
 		return err
 	}
@@ -36,7 +109,13 @@ func (p *password) Set(plaintextPassword string) error {
 	return nil
 }
 
+// Matches reports whether the plaintext password matches the hash, the legacy
+// hashes are verified as well so that they can be upgraded on sign-in.
 func (p *password) Matches(plaintextPassword string) (bool, error) {
+	if _, err := bcrypt.Cost(p.Hash); err != nil {
+		return p.matchesLegacy(plaintextPassword)
+	}
+
 	err := bcrypt.CompareHashAndPassword(p.Hash, []byte(plaintextPassword))
 
 	if err != nil {
@@ -51,6 +130,71 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+// matchesLegacy verifies the hashes stored before bcrypt was used, the hex
+// encoded MD5 and SHA-256 digests of the password.
+func (p *password) matchesLegacy(plaintextPassword string) (bool, error) {
+	var digest []byte
+
+	switch len(p.Hash) {
+	case hex.EncodedLen(md5.Size):
+		sum := md5.Sum([]byte(plaintextPassword))
+		digest = sum[:]
+	case hex.EncodedLen(sha256.Size):
+		sum := sha256.Sum256([]byte(plaintextPassword))
+		digest = sum[:]
+	default:
+		return false, ErrInvalidHash
+	}
+
+	want, err := hex.DecodeString(string(p.Hash))
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+
+	return subtle.ConstantTimeCompare(digest, want) == 1, nil
+}
+
+// dummyHashes holds a hash per bcrypt cost for CompareDummyPassword.
+var (
+	dummyHashesMu sync.Mutex
+	dummyHashes   = map[int][]byte{}
+)
+
+// CompareDummyPassword runs a bcrypt comparison of the current cost against a fixed
+// hash, so that signing in with an unknown login takes as long as with a known one.
+func CompareDummyPassword(plaintextPassword string) {
+	hash, err := dummyHash(currentPasswordCost())
+	if err != nil {
+		return
+	}
+
+	_ = bcrypt.CompareHashAndPassword(hash, []byte(plaintextPassword))
+}
+
+func dummyHash(cost int) ([]byte, error) {
+	dummyHashesMu.Lock()
+	defer dummyHashesMu.Unlock()
+
+	if hash, ok := dummyHashes[cost]; ok {
+		return hash, nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("gophermart dummy password"), cost)
+	if err != nil {
+		return nil, err
+	}
+
+	dummyHashes[cost] = hash
+	return hash, nil
+}
+
+// NeedsRehash reports whether the hash was created with a lower cost than the
+// current one, or with another algorithm than bcrypt.
+func (p *password) NeedsRehash() bool {
+	cost, err := bcrypt.Cost(p.Hash)
+	return err != nil || cost < currentPasswordCost()
+}
+
 func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "must be provided")
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
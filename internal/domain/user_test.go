@@ -0,0 +1,124 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPassword_NeedsRehash(t *testing.T) {
+	t.Cleanup(func() { passwordCost.Store(0) })
+
+	if err := SetPasswordCost(bcrypt.MinCost); err != nil {
+		t.Fatal(err)
+	}
+
+	var p password
+	if err := p.Set("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.NeedsRehash() {
+		t.Error("NeedsRehash() = true for a hash of the current cost")
+	}
+
+	if err := SetPasswordCost(bcrypt.MinCost + 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.NeedsRehash() {
+		t.Error("NeedsRehash() = false after the cost was raised")
+	}
+
+	var stronger password
+	if err := stronger.Set("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	// lowering the cost does not downgrade the existing hashes
+	if err := SetPasswordCost(bcrypt.MinCost); err != nil {
+		t.Fatal(err)
+	}
+
+	if stronger.NeedsRehash() {
+		t.Error("NeedsRehash() = true for a hash of a higher cost")
+	}
+
+	legacy := password{Hash: []byte("5f4dcc3b5aa765d61d8327deb882cf99")}
+	if !legacy.NeedsRehash() {
+		t.Error("NeedsRehash() = false for a hash which is not bcrypt")
+	}
+}
+
+func TestSetPasswordCost_OutOfRange(t *testing.T) {
+	for _, cost := range []int{bcrypt.MinCost - 1, bcrypt.MaxCost + 1} {
+		if err := SetPasswordCost(cost); err == nil {
+			t.Errorf("SetPasswordCost(%d) expected an error", cost)
+		}
+	}
+}
+
+func TestCompareDummyPassword(t *testing.T) {
+	t.Cleanup(func() { passwordCost.Store(0) })
+
+	for _, cost := range []int{bcrypt.MinCost, bcrypt.MinCost + 1} {
+		if err := SetPasswordCost(cost); err != nil {
+			t.Fatal(err)
+		}
+
+		CompareDummyPassword("correct horse")
+
+		dummyHashesMu.Lock()
+		hash, ok := dummyHashes[cost]
+		dummyHashesMu.Unlock()
+		if !ok {
+			t.Fatalf("no dummy hash was compared for the cost %d", cost)
+		}
+
+		if got, err := bcrypt.Cost(hash); err != nil || got != cost {
+			t.Errorf("dummy hash cost = %d, %v, want %d", got, err, cost)
+		}
+	}
+}
+
+func TestPassword_MatchesLegacy(t *testing.T) {
+	tests := []struct {
+		name      string
+		hash      string
+		plaintext string
+		want      bool
+		wantErr   error
+	}{
+		{name: "MD5", hash: "5f4dcc3b5aa765d61d8327deb882cf99", plaintext: "password", want: true},
+		{name: "MD5 mismatch", hash: "5f4dcc3b5aa765d61d8327deb882cf99", plaintext: "passw0rd"},
+		{
+			name:      "SHA-256",
+			hash:      "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8",
+			plaintext: "password",
+			want:      true,
+		},
+		{
+			name:      "SHA-256 mismatch",
+			hash:      "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8",
+			plaintext: "passw0rd",
+		},
+		{name: "unknown format", hash: "plaintext", plaintext: "plaintext", wantErr: ErrInvalidHash},
+		{name: "not hex", hash: "zf4dcc3b5aa765d61d8327deb882cf99", plaintext: "password", wantErr: ErrInvalidHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := password{Hash: []byte(tt.hash)}
+
+			got, err := p.Matches(tt.plaintext)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Matches() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/validator"
+)
+
+const (
+	WebhookEventOrderProcessed    = "order.processed"
+	WebhookEventOrderInvalid      = "order.invalid"
+	WebhookEventWithdrawalCreated = "withdrawal.created"
+)
+
+var WebhookEvents = []string{
+	WebhookEventOrderProcessed,
+	WebhookEventOrderInvalid,
+	WebhookEventWithdrawalCreated,
+}
+
+// OrderWebhookEvent returns the event the webhooks are notified with when an order
+// reaches the status, ok is false for the statuses which are not notified.
+func OrderWebhookEvent(status string) (event string, ok bool) {
+	switch status {
+	case OrderStatusProcessed:
+		return WebhookEventOrderProcessed, true
+	case OrderStatusInvalid:
+		return WebhookEventOrderInvalid, true
+	}
+
+	return "", false
+}
+
+const (
+	WebhookDeliveryStatusPending   = "PENDING"
+	WebhookDeliveryStatusDelivered = "DELIVERED"
+	WebhookDeliveryStatusFailed    = "FAILED"
+)
+
+type Webhook struct {
+	ID                  string     `json:"id"`
+	UserID              string     `json:"-"`
+	URL                 string     `json:"url"`
+	Secret              string     `json:"secret,omitempty"`
+	Events              []string   `json:"events"`
+	IsActive            bool       `json:"active"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"-"`
+}
+
+type WebhookDelivery struct {
+	ID            string                   `json:"id"`
+	WebhookID     string                   `json:"webhook_id"`
+	EventType     string                   `json:"event"`
+	Payload       []byte                   `json:"-"`
+	Status        string                   `json:"status"`
+	Attempts      int                      `json:"attempts"`
+	NextAttemptAt time.Time                `json:"next_attempt_at"`
+	DeliveredAt   *time.Time               `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time                `json:"created_at"`
+	Log           []WebhookDeliveryAttempt `json:"log"`
+
+	// target of the delivery, only loaded by the dispatcher
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+type WebhookDeliveryAttempt struct {
+	ID             string    `json:"-"`
+	DeliveryID     string    `json:"-"`
+	ResponseStatus *int      `json:"response_status,omitempty"`
+	Error          *string   `json:"error,omitempty"`
+	DurationMS     int64     `json:"duration_ms"`
+	CreatedAt      time.Time `json:"attempted_at"`
+}
+
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	v.Check(webhook.URL != "", "url", "must be provided")
+
+	u, err := url.Parse(webhook.URL)
+	v.Check(err == nil && u.Host != "", "url", "must be a valid absolute URL")
+	v.Check(err == nil && validator.PermittedValue(u.Scheme, "http", "https"), "url", "must use http or https")
+
+	v.Check(len(webhook.Events) > 0, "events", "must contain at least one event")
+	v.Check(validator.Unique(webhook.Events), "events", "must not contain duplicate values")
+	for _, event := range webhook.Events {
+		v.Check(validator.PermittedValue(event, WebhookEvents...), "events", "contains an unknown event "+event)
+	}
+}
@@ -0,0 +1,30 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// FileSender writes the notifications to a file or to stdout, it is meant for
+// development where no mail server is available.
+type FileSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewFileSender(w io.Writer) *FileSender {
+	return &FileSender{w: w}
+}
+
+func (fs *FileSender) Send(_ context.Context, msg Message) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	_, err := fmt.Fprintf(fs.w, "--- %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().UTC().Format(time.RFC3339), msg.To, msg.Subject, msg.Body)
+
+	return err
+}
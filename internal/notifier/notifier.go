@@ -0,0 +1,48 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+)
+
+const (
+	DriverFile = "file"
+	DriverSMTP = "smtp"
+)
+
+// Message is a notification for a single recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers notifications to users.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New builds the sender selected by the configured driver, the file driver
+// writes to stdout when no path is set.
+func New(cfg config.NotifierConfig) (Sender, error) {
+	switch cfg.Driver {
+	case DriverFile, "":
+		if cfg.FilePath == "" {
+			return NewFileSender(os.Stdout), nil
+		}
+
+		f, err := os.OpenFile(cfg.FilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open notifications file: %w", err)
+		}
+
+		return NewFileSender(f), nil
+	case DriverSMTP:
+		return NewSMTPSender(cfg.SMTP), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier driver %q", cfg.Driver)
+	}
+}
@@ -0,0 +1,70 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+)
+
+// SMTPSender delivers the notifications as plain text emails.
+type SMTPSender struct {
+	cfg config.SMTPConfig
+}
+
+func NewSMTPSender(cfg config.SMTPConfig) *SMTPSender {
+	return &SMTPSender{cfg: cfg}
+}
+
+func (ss *SMTPSender) Send(ctx context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") {
+		return fmt.Errorf("invalid recipient %q", msg.To)
+	}
+
+	addr := net.JoinHostPort(ss.cfg.Host, strconv.Itoa(ss.cfg.Port))
+
+	var auth smtp.Auth
+	if ss.cfg.Username != "" {
+		auth = smtp.PlainAuth("", ss.cfg.Username, ss.cfg.Password, ss.cfg.Host)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(addr, auth, ss.cfg.From, []string{msg.To}, ss.compose(msg))
+	}()
+
+	// net/smtp has no context support, the send is abandoned when the context is done
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("failed to send email: %w", err)
+		}
+
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (ss *SMTPSender) compose(msg Message) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", ss.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return b.Bytes()
+}
@@ -0,0 +1,172 @@
+package notifier
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+)
+
+// fakeSMTPMail is a mail accepted by the fake server.
+type fakeSMTPMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// startFakeSMTPServer accepts a single SMTP session and sends the received mail on the channel.
+func startFakeSMTPServer(t *testing.T) (string, int, <-chan fakeSMTPMail) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	mails := make(chan fakeSMTPMail, 1)
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) {
+			_, _ = conn.Write([]byte(line + "\r\n"))
+		}
+
+		var mail fakeSMTPMail
+		reply("220 localhost fake SMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			cmd := strings.ToUpper(line)
+
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				mail.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				mail.to = append(mail.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 end data with <CR><LF>.<CR><LF>")
+
+				var data bytes.Buffer
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				mail.data = data.String()
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 bye")
+				mails <- mail
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return host, p, mails
+}
+
+func TestSMTPSender_Send(t *testing.T) {
+	host, port, mails := startFakeSMTPServer(t)
+
+	sender := NewSMTPSender(config.SMTPConfig{
+		Host: host,
+		Port: port,
+		From: "noreply@gophermart.local",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := sender.Send(ctx, Message{
+		To:      "user@example.com",
+		Subject: "Reset your password",
+		Body:    "line one\nline two",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	select {
+	case mail := <-mails:
+		if mail.from != "noreply@gophermart.local" {
+			t.Errorf("from = %q", mail.from)
+		}
+
+		if len(mail.to) != 1 || mail.to[0] != "user@example.com" {
+			t.Errorf("to = %v", mail.to)
+		}
+
+		for _, want := range []string{"Subject: Reset your password\r\n", "\r\n\r\nline one\r\nline two\r\n"} {
+			if !strings.Contains(mail.data, want) {
+				t.Errorf("data %q does not contain %q", mail.data, want)
+			}
+		}
+	case <-ctx.Done():
+		t.Fatal("the fake server did not receive the mail")
+	}
+}
+
+func TestSMTPSender_RejectsHeaderInjection(t *testing.T) {
+	sender := NewSMTPSender(config.SMTPConfig{Host: "127.0.0.1", Port: 1})
+
+	err := sender.Send(context.Background(), Message{To: "user@example.com\r\nBcc: evil@example.com"})
+	if err == nil {
+		t.Fatal("Send() accepted a recipient with a line break")
+	}
+}
+
+func TestFileSender_Send(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := NewFileSender(&buf).Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Hello",
+		Body:    "body",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	for _, want := range []string{"To: user@example.com\n", "Subject: Hello\n", "\nbody\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output %q does not contain %q", buf.String(), want)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_number TEXT NOT NULL REFERENCES orders(order_number) ON DELETE CASCADE,
+    old_status TEXT,
+    new_status TEXT NOT NULL,
+    accrual NUMERIC DEFAULT 0 NOT NULL,
+    source TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS order_status_history_order_number_idx
+    ON order_status_history (order_number, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS order_status_history;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TRIGGER update_user_webhooks_updated_at
+BEFORE UPDATE ON user_webhooks
+FOR EACH ROW
+EXECUTE FUNCTION update_timestamp();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS update_user_webhooks_updated_at ON user_webhooks;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TRIGGER update_webhook_deliveries_updated_at
+BEFORE UPDATE ON webhook_deliveries
+FOR EACH ROW
+EXECUTE FUNCTION update_timestamp();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS update_webhook_deliveries_updated_at ON webhook_deliveries;
+-- +goose StatementEnd
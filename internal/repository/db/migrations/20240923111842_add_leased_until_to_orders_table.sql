@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS leased_until TIMESTAMP WITH TIME ZONE;
+
+-- taking or releasing a lease must not count as an order modification
+CREATE OR REPLACE FUNCTION update_orders_timestamp()
+RETURNS TRIGGER AS $$
+BEGIN
+   IF ROW(NEW.order_status, NEW.accrual) IS DISTINCT FROM ROW(OLD.order_status, OLD.accrual) THEN
+      NEW.updated_at = NOW();
+   END IF;
+   RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS update_orders_updated_at ON orders;
+
+CREATE TRIGGER update_orders_updated_at
+BEFORE UPDATE ON orders
+FOR EACH ROW
+EXECUTE FUNCTION update_orders_timestamp();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS update_orders_updated_at ON orders;
+
+CREATE TRIGGER update_orders_updated_at
+BEFORE UPDATE ON orders
+FOR EACH ROW
+EXECUTE FUNCTION update_timestamp();
+
+DROP FUNCTION IF EXISTS update_orders_timestamp();
+
+ALTER TABLE orders DROP COLUMN IF EXISTS leased_until;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE session_tokens
+    ADD COLUMN IF NOT EXISTS family_id UUID NOT NULL DEFAULT gen_random_uuid(),
+    ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES session_tokens(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS used_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_session_tokens_family_id ON session_tokens (family_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_session_tokens_family_id;
+
+ALTER TABLE session_tokens
+    DROP COLUMN IF EXISTS revoked_at,
+    DROP COLUMN IF EXISTS used_at,
+    DROP COLUMN IF EXISTS parent_id,
+    DROP COLUMN IF EXISTS family_id;
+-- +goose StatementEnd
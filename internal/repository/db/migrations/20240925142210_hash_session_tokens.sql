@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- plaintext refresh tokens can not be converted, every session has to log in again
+DELETE FROM session_tokens;
+
+ALTER TABLE session_tokens RENAME COLUMN token TO token_hash;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM session_tokens;
+
+ALTER TABLE session_tokens RENAME COLUMN token_hash TO token;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    jti TEXT,
+    session_id UUID,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    revoked_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    CONSTRAINT revoked_tokens_single_target CHECK (num_nonnulls(jti, session_id, user_id) = 1)
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS revoked_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TRIGGER update_login_attempts_updated_at
+BEFORE UPDATE ON login_attempts
+FOR EACH ROW
+EXECUTE FUNCTION update_timestamp();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS update_login_attempts_updated_at ON login_attempts;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS totp_secret TEXT,
+    ADD COLUMN IF NOT EXISTS totp_pending_secret TEXT,
+    ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+    DROP COLUMN IF EXISTS totp_last_step,
+    DROP COLUMN IF EXISTS totp_enabled_at,
+    DROP COLUMN IF EXISTS totp_pending_secret,
+    DROP COLUMN IF EXISTS totp_secret;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'support', 'admin')),
+    ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP WITH TIME ZONE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+    DROP COLUMN IF EXISTS suspended_at,
+    DROP COLUMN IF EXISTS role;
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS balance_adjustments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    actor_id UUID NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount <> 0),
+    reason_code TEXT NOT NULL,
+    note TEXT NOT NULL,
+    forced BOOLEAN DEFAULT FALSE NOT NULL,
+    balance_before DECIMAL(10, 2) NOT NULL,
+    balance_after DECIMAL(10, 2) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_balance_adjustments_user_id ON balance_adjustments (user_id);
+
+-- the adjustments are an audit trail, rows can only ever be inserted
+CREATE OR REPLACE FUNCTION prevent_balance_adjustments_change()
+RETURNS TRIGGER AS $$
+BEGIN
+   RAISE EXCEPTION 'balance adjustments are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER balance_adjustments_immutable
+BEFORE UPDATE OR DELETE ON balance_adjustments
+FOR EACH ROW
+EXECUTE FUNCTION prevent_balance_adjustments_change();
+
+CREATE TRIGGER balance_adjustments_no_truncate
+BEFORE TRUNCATE ON balance_adjustments
+FOR EACH STATEMENT
+EXECUTE FUNCTION prevent_balance_adjustments_change();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS balance_adjustments;
+DROP FUNCTION IF EXISTS prevent_balance_adjustments_change();
+-- +goose StatementEnd
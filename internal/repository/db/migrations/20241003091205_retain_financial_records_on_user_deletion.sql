@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+-- deleted accounts are anonymised, the financial records must outlive them
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE orders
+    DROP CONSTRAINT IF EXISTS orders_user_id_fkey,
+    ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT;
+
+ALTER TABLE user_loyalty_points
+    DROP CONSTRAINT IF EXISTS user_loyalty_points_user_id_fkey,
+    ADD CONSTRAINT user_loyalty_points_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT;
+
+ALTER TABLE user_withdrawals
+    DROP CONSTRAINT IF EXISTS user_withdrawals_user_id_fkey,
+    ADD CONSTRAINT user_withdrawals_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_withdrawals
+    DROP CONSTRAINT IF EXISTS user_withdrawals_user_id_fkey,
+    ADD CONSTRAINT user_withdrawals_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE user_loyalty_points
+    DROP CONSTRAINT IF EXISTS user_loyalty_points_user_id_fkey,
+    ADD CONSTRAINT user_loyalty_points_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE orders
+    DROP CONSTRAINT IF EXISTS orders_user_id_fkey,
+    ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
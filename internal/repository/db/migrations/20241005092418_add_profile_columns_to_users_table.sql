@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS email citext NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT 'en',
+    ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC',
+    ADD COLUMN IF NOT EXISTS marketing_consent BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+    DROP COLUMN IF EXISTS marketing_consent,
+    DROP COLUMN IF EXISTS timezone,
+    DROP COLUMN IF EXISTS locale,
+    DROP COLUMN IF EXISTS email,
+    DROP COLUMN IF EXISTS display_name;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE session_tokens
+    ADD COLUMN IF NOT EXISTS device_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_session_tokens_user_id_device_id ON session_tokens (user_id, device_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_session_tokens_user_id_device_id;
+
+ALTER TABLE session_tokens
+    DROP COLUMN IF EXISTS device_id;
+-- +goose StatementEnd
@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mihailtudos/gophermart/internal/repository/postgres/queries"
+)
+
+// DeleteAccount anonymises the user and erases the personal data, the orders,
+// withdrawals, balance and adjustments are retained. It fails with ErrEditConflict
+// when the user was modified since it was read.
+func (u *userRepository) DeleteAccount(ctx context.Context, userID string, version int) error {
+	tx, err := u.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	res, err := tx.ExecContext(ctx, queries.AnonymiseUser, userID, version)
+	if err != nil {
+		return fmt.Errorf("error anonymising user: %w", err)
+	}
+
+	if err = expectAffected(res); err != nil {
+		if errors.Is(err, ErrNoRowsFound) {
+			err = ErrEditConflict
+		}
+
+		return err
+	}
+
+	for _, query := range queries.DeleteUserPersonalData {
+		if _, err = tx.ExecContext(ctx, query, userID); err != nil {
+			return fmt.Errorf("error deleting personal data: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres/queries"
+)
+
+// AdjustBalance applies the adjustment and records it with the balance before and
+// after, under a lock of the balance row. It fails with ErrInsufficientPoints when
+// the balance would go negative and the adjustment is not forced.
+func (u *userRepository) AdjustBalance(ctx context.Context,
+	adj domain.BalanceAdjustment) (domain.BalanceAdjustment, error) {
+	tx, err := u.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return domain.BalanceAdjustment{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	err = tx.QueryRowContext(ctx, queries.GetUserBalanceForUpdate, adj.UserID).Scan(&adj.BalanceBefore)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrNoRowsFound
+			return domain.BalanceAdjustment{}, err
+		}
+
+		return domain.BalanceAdjustment{}, fmt.Errorf("error locking balance: %w", err)
+	}
+
+	// the new balance is computed by the database to keep the decimal precision
+	err = tx.QueryRowContext(ctx, queries.AdjustUserBalance, adj.Amount, adj.UserID).Scan(&adj.BalanceAfter)
+	if err != nil {
+		return domain.BalanceAdjustment{}, fmt.Errorf("error adjusting balance: %w", err)
+	}
+
+	if adj.BalanceAfter < 0 && !adj.Forced {
+		err = ErrInsufficientPoints
+		return domain.BalanceAdjustment{}, err
+	}
+
+	err = tx.QueryRowContext(ctx, queries.InsertBalanceAdjustment,
+		adj.UserID,
+		adj.ActorID,
+		adj.Amount,
+		adj.ReasonCode,
+		adj.Note,
+		adj.Forced,
+		adj.BalanceBefore,
+		adj.BalanceAfter,
+	).Scan(&adj.ID, &adj.CreatedAt)
+	if err != nil {
+		return domain.BalanceAdjustment{}, fmt.Errorf("error inserting balance adjustment: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return domain.BalanceAdjustment{}, err
+	}
+
+	return adj, nil
+}
+
+func (u *userRepository) GetBalanceAdjustments(ctx context.Context, userID string) ([]domain.BalanceAdjustment, error) {
+	rows, err := u.db.QueryContext(ctx, queries.GetUserBalanceAdjustments, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	adjustments := []domain.BalanceAdjustment{}
+	for rows.Next() {
+		var adj domain.BalanceAdjustment
+
+		err := rows.Scan(
+			&adj.ID,
+			&adj.UserID,
+			&adj.ActorID,
+			&adj.Amount,
+			&adj.ReasonCode,
+			&adj.Note,
+			&adj.Forced,
+			&adj.BalanceBefore,
+			&adj.BalanceAfter,
+			&adj.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("error scanning balance adjustment row: %w", err)
+		}
+
+		adjustments = append(adjustments, adj)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after reading rows: %w", err)
+	}
+
+	return adjustments, nil
+}
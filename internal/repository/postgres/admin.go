@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres/queries"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (u *userRepository) SearchUsers(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
+	rows, err := u.db.QueryContext(ctx, queries.SearchUsers,
+		likeEscaper.Replace(filter.Login),
+		filter.Role,
+		filter.Limit,
+		filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	users := []domain.User{}
+	for rows.Next() {
+		var user domain.User
+
+		err := rows.Scan(
+			&user.ID,
+			&user.Login,
+			&user.Role,
+			&user.SuspendedAt,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&user.DisplayName,
+			&user.Email,
+			&user.Locale,
+			&user.Timezone,
+			&user.MarketingConsent,
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("error scanning user row: %w", err)
+		}
+
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after reading rows: %w", err)
+	}
+
+	return users, nil
+}
+
+// SetUserSuspended suspends or reinstates the account, it fails with
+// ErrNoRowsFound when the user does not exist or was deleted.
+func (u *userRepository) SetUserSuspended(ctx context.Context, userID string, suspended bool) error {
+	query := queries.UnsuspendUser
+	if suspended {
+		query = queries.SuspendUser
+	}
+
+	res, err := u.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (u *userRepository) SetUserRole(ctx context.Context, userID, role string) error {
+	res, err := u.db.ExecContext(ctx, queries.SetUserRole, userID, role)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
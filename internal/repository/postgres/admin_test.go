@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+)
+
+func TestUserRepository_SearchUsersEscapesWildcards(t *testing.T) {
+	db, fdb := newFakeDB(t, fakeResult{match: "FROM users", columns: []string{"id", "login", "role",
+		"suspended_at", "created_at", "updated_at", "display_name", "email", "locale", "timezone",
+		"marketing_consent"}})
+
+	repo, _ := NewUserRepository(db)
+
+	if _, err := repo.SearchUsers(context.Background(), domain.UserFilter{Login: `50%_off\`, Limit: 10}); err != nil {
+		t.Fatalf("SearchUsers() error = %v", err)
+	}
+
+	ran := fdb.ran("FROM users")
+	if len(ran) != 1 {
+		t.Fatalf("got %d searches, want 1", len(ran))
+	}
+
+	if got, want := ran[0].args[0].Value, `50\%\_off\\`; got != want {
+		t.Errorf("login pattern = %q, want %q", got, want)
+	}
+
+	if !strings.Contains(ran[0].query, "deleted_at IS NULL") {
+		t.Error("the search lists the deleted users")
+	}
+}
+
+func TestUserRepository_AdminActionsSkipDeletedUsers(t *testing.T) {
+	tests := []struct {
+		name   string
+		action func(repo *userRepository) error
+	}{
+		{name: "suspend", action: func(repo *userRepository) error {
+			return repo.SetUserSuspended(context.Background(), "user-1", true)
+		}},
+		{name: "unsuspend", action: func(repo *userRepository) error {
+			return repo.SetUserSuspended(context.Background(), "user-1", false)
+		}},
+		{name: "set role", action: func(repo *userRepository) error {
+			return repo.SetUserRole(context.Background(), "user-1", domain.RoleAdmin)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a deleted user is not matched by the update
+			db, fdb := newFakeDB(t, fakeResult{match: "UPDATE users"})
+
+			repo, _ := NewUserRepository(db)
+
+			if err := tt.action(repo); !errors.Is(err, ErrNoRowsFound) {
+				t.Errorf("error = %v, want %v", err, ErrNoRowsFound)
+			}
+
+			ran := fdb.ran("UPDATE users")
+			if len(ran) != 1 || !strings.Contains(ran[0].query, "deleted_at IS NULL") {
+				t.Errorf("statements = %+v, want one skipping the deleted users", ran)
+			}
+		})
+	}
+}
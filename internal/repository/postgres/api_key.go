@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres/queries"
+)
+
+type apiKeyRepository struct {
+	db *sqlx.DB
+}
+
+func NewAPIKeyRepository(db *sqlx.DB) (*apiKeyRepository, error) {
+	return &apiKeyRepository{
+		db: db,
+	}, nil
+}
+
+func (ar *apiKeyRepository) CreateAPIKey(ctx context.Context, key domain.APIKey) (domain.APIKey, error) {
+	err := ar.db.QueryRowContext(ctx, queries.InsertAPIKey,
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		pq.Array(key.Scopes),
+	).Scan(
+		&key.ID,
+		&key.CreatedAt,
+	)
+
+	if err != nil {
+		return domain.APIKey{}, fmt.Errorf("error inserting api key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (ar *apiKeyRepository) GetAPIKeys(ctx context.Context, userID string) ([]domain.APIKey, error) {
+	rows, err := ar.db.QueryContext(ctx, queries.GetUserAPIKeys, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	keys := []domain.APIKey{}
+	for rows.Next() {
+		var key domain.APIKey
+
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array(&key.Scopes),
+			&key.LastUsedAt,
+			&key.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("error scanning api key row: %w", err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after reading rows: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (ar *apiKeyRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (domain.APIKey, error) {
+	var key domain.APIKey
+
+	err := ar.db.QueryRowContext(ctx, queries.GetAPIKeyByPrefix, prefix).Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		pq.Array(&key.Scopes),
+		&key.LastUsedAt,
+		&key.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.APIKey{}, ErrNoRowsFound
+		}
+
+		return domain.APIKey{}, err
+	}
+
+	return key, nil
+}
+
+func (ar *apiKeyRepository) DeleteAPIKey(ctx context.Context, userID, keyID string) error {
+	res, err := ar.db.ExecContext(ctx, queries.DeleteUserAPIKey, keyID, userID)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+func (ar *apiKeyRepository) TouchAPIKey(ctx context.Context, keyID string) error {
+	_, err := ar.db.ExecContext(ctx, queries.TouchAPIKey, keyID)
+	return err
+}
@@ -9,4 +9,9 @@ var (
 	ErrOrderAlreadyExistsDifferentUser = errors.New("the order number has already been uploaded by another user")
 	ErrOrderAlreadyAccepted            = errors.New("the order number has already been accepted for processing")
 	ErrInsufficientPoints              = errors.New("insufficient points")
+	ErrOrderNotCancellable             = errors.New("the order can no longer be cancelled")
+	ErrOrderCancelled                  = errors.New("the order has been cancelled")
+	ErrRefreshTokenReused              = errors.New("refresh token has already been used")
+	ErrEditConflict                    = errors.New("unable to update the record due to an edit conflict")
+	ErrIdentityAlreadyLinked           = errors.New("the identity is already linked to a user")
 )
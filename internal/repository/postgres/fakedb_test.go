@@ -0,0 +1,182 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeResult answers the statements containing match, with rows for the queries
+// and affected for the other statements.
+type fakeResult struct {
+	match    string
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+}
+
+// fakeStatement is a statement the repository ran.
+type fakeStatement struct {
+	query string
+	args  []driver.NamedValue
+}
+
+// fakeDB is an in-memory database/sql driver answering with scripted results, so
+// that the queries and the scans of the repositories can be tested without Postgres.
+type fakeDB struct {
+	mu         sync.Mutex
+	results    []fakeResult
+	statements []fakeStatement
+}
+
+var (
+	fakeDBsMu      sync.Mutex
+	fakeDBs        = map[string]*fakeDB{}
+	registerFakeDB sync.Once
+)
+
+func newFakeDB(t *testing.T, results ...fakeResult) (*sqlx.DB, *fakeDB) {
+	t.Helper()
+
+	registerFakeDB.Do(func() { sql.Register("fakedb", fakeDriver{}) })
+
+	fdb := &fakeDB{results: results}
+
+	fakeDBsMu.Lock()
+	fakeDBs[t.Name()] = fdb
+	fakeDBsMu.Unlock()
+
+	db, err := sql.Open("fakedb", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = db.Close()
+
+		fakeDBsMu.Lock()
+		delete(fakeDBs, t.Name())
+		fakeDBsMu.Unlock()
+	})
+
+	return sqlx.NewDb(db, "postgres"), fdb
+}
+
+// ran returns the statements containing match.
+func (f *fakeDB) ran(match string) []fakeStatement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var ran []fakeStatement
+	for _, st := range f.statements {
+		if strings.Contains(st.query, match) {
+			ran = append(ran, st)
+		}
+	}
+
+	return ran
+}
+
+func (f *fakeDB) answer(query string, args []driver.NamedValue) (fakeResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.statements = append(f.statements, fakeStatement{query: query, args: args})
+
+	for _, r := range f.results {
+		if strings.Contains(query, r.match) {
+			return r, nil
+		}
+	}
+
+	return fakeResult{}, errors.New("fakedb: unexpected statement: " + query)
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+
+	fdb, ok := fakeDBs[name]
+	if !ok {
+		return nil, errors.New("fakedb: unknown database " + name)
+	}
+
+	return fakeConn{fdb}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c fakeConn) Prepare(_ string) (driver.Stmt, error) {
+	return nil, errors.New("fakedb: prepared statements are not supported")
+}
+
+func (c fakeConn) Close() error {
+	return nil
+}
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r, err := c.db.answer(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fakeRows{columns: r.columns, rows: r.rows}, nil
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r, err := c.db.answer(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(r.affected), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error {
+	return nil
+}
+
+func (fakeTx) Rollback() error {
+	return nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres/queries"
+)
+
+type loginAttemptsRepository struct {
+	db *sqlx.DB
+}
+
+func NewLoginAttemptsRepository(db *sqlx.DB) (*loginAttemptsRepository, error) {
+	return &loginAttemptsRepository{
+		db: db,
+	}, nil
+}
+
+func (lr *loginAttemptsRepository) GetLoginAttempts(ctx context.Context, key string) (domain.LoginAttempts, error) {
+	var attempts domain.LoginAttempts
+
+	err := lr.db.QueryRowContext(ctx, queries.GetLoginAttempts, key).Scan(
+		&attempts.Key,
+		&attempts.Failures,
+		&attempts.LastFailedAt,
+		&attempts.LockedUntil,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return attempts, ErrNoRowsFound
+		}
+
+		return attempts, fmt.Errorf("error retrieving login attempts: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// RecordLoginFailure increments the failures of the key, restarting the count
+// when the previous failure happened before windowStart.
+func (lr *loginAttemptsRepository) RecordLoginFailure(ctx context.Context,
+	key string,
+	failedAt time.Time,
+	windowStart time.Time) (domain.LoginAttempts, error) {
+	var attempts domain.LoginAttempts
+
+	err := lr.db.QueryRowContext(ctx, queries.RecordLoginFailure, key, failedAt, windowStart).Scan(
+		&attempts.Key,
+		&attempts.Failures,
+		&attempts.LastFailedAt,
+		&attempts.LockedUntil,
+	)
+	if err != nil {
+		return attempts, fmt.Errorf("error recording login failure: %w", err)
+	}
+
+	return attempts, nil
+}
+
+func (lr *loginAttemptsRepository) LockLogin(ctx context.Context, key string, until time.Time) error {
+	if _, err := lr.db.ExecContext(ctx, queries.LockLogin, key, until); err != nil {
+		return fmt.Errorf("error locking login: %w", err)
+	}
+
+	return nil
+}
+
+func (lr *loginAttemptsRepository) ResetLoginAttempts(ctx context.Context, key string) error {
+	if _, err := lr.db.ExecContext(ctx, queries.DeleteLoginAttempts, key); err != nil {
+		return fmt.Errorf("error resetting login attempts: %w", err)
+	}
+
+	return nil
+}
+
+func (lr *loginAttemptsRepository) DeleteStaleLoginAttempts(ctx context.Context,
+	loginPrefix, ipPrefix string,
+	before time.Time) error {
+	_, err := lr.db.ExecContext(ctx, queries.DeleteStaleLoginAttempts, before, loginPrefix, ipPrefix)
+	if err != nil {
+		return fmt.Errorf("error deleting stale login attempts: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres/queries"
+)
+
+// uniqueViolation is the postgres error code of a duplicate key
+const uniqueViolation = "23505"
+
+type oidcRepository struct {
+	db *sqlx.DB
+}
+
+func NewOIDCRepository(db *sqlx.DB) (*oidcRepository, error) {
+	return &oidcRepository{
+		db: db,
+	}, nil
+}
+
+// CreateOIDCState stores a new sign-in state, the expired ones are dropped on the way.
+func (or *oidcRepository) CreateOIDCState(ctx context.Context, state domain.OIDCState) error {
+	if _, err := or.db.ExecContext(ctx, queries.DeleteExpiredOIDCStates); err != nil {
+		return fmt.Errorf("error deleting expired oidc states: %w", err)
+	}
+
+	var linkUserID sql.NullString
+	if state.LinkUserID != "" {
+		linkUserID = sql.NullString{String: state.LinkUserID, Valid: true}
+	}
+
+	_, err := or.db.ExecContext(ctx, queries.InsertOIDCState,
+		state.StateHash,
+		state.CodeVerifier,
+		state.Nonce,
+		linkUserID,
+		state.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error inserting oidc state: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeOIDCState deletes and returns the sign-in state, it fails with ErrNoRowsFound
+// when the state is unknown, already used or expired.
+func (or *oidcRepository) ConsumeOIDCState(ctx context.Context, stateHash string) (domain.OIDCState, error) {
+	state := domain.OIDCState{StateHash: stateHash}
+
+	err := or.db.QueryRowContext(ctx, queries.ConsumeOIDCState, stateHash).Scan(
+		&state.CodeVerifier,
+		&state.Nonce,
+		&state.LinkUserID,
+		&state.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.OIDCState{}, ErrNoRowsFound
+		}
+
+		return domain.OIDCState{}, fmt.Errorf("error consuming oidc state: %w", err)
+	}
+
+	return state, nil
+}
+
+func (or *oidcRepository) GetUserIdentity(ctx context.Context, issuer, subject string) (domain.UserIdentity, error) {
+	var identity domain.UserIdentity
+
+	err := or.db.QueryRowContext(ctx, queries.GetUserIdentity, issuer, subject).Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Issuer,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.UserIdentity{}, ErrNoRowsFound
+		}
+
+		return domain.UserIdentity{}, err
+	}
+
+	return identity, nil
+}
+
+// CreateUserIdentity links the identity to the user, it fails with ErrIdentityAlreadyLinked
+// when the identity, or another identity of the same issuer for the user, is linked already.
+func (or *oidcRepository) CreateUserIdentity(ctx context.Context,
+	identity domain.UserIdentity) (domain.UserIdentity, error) {
+	err := or.db.QueryRowContext(ctx, queries.InsertUserIdentity,
+		identity.UserID,
+		identity.Issuer,
+		identity.Subject,
+		identity.Email,
+	).Scan(
+		&identity.ID,
+		&identity.CreatedAt,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return domain.UserIdentity{}, ErrIdentityAlreadyLinked
+		}
+
+		return domain.UserIdentity{}, fmt.Errorf("error inserting user identity: %w", err)
+	}
+
+	return identity, nil
+}
@@ -0,0 +1,101 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres/queries"
+)
+
+type passwordResetRepository struct {
+	db *sqlx.DB
+}
+
+func NewPasswordResetRepository(db *sqlx.DB) (*passwordResetRepository, error) {
+	return &passwordResetRepository{
+		db: db,
+	}, nil
+}
+
+// CreatePasswordResetToken stores the token hash, the previous tokens of the user
+// that were not used yet stop working.
+func (pr *passwordResetRepository) CreatePasswordResetToken(ctx context.Context,
+	userID, tokenHash string,
+	expiresAt time.Time) error {
+	tx, err := pr.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, queries.DeleteUnusedPasswordResetTokens, userID); err != nil {
+		return fmt.Errorf("error deleting old reset tokens: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, queries.InsertPasswordResetToken, userID, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("error inserting reset token: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ResetPassword consumes the reset token, sets the new password hash and revokes the
+// sessions of the user in the same transaction, it fails with ErrNoRowsFound when the
+// token is unknown, used or expired.
+func (pr *passwordResetRepository) ResetPassword(ctx context.Context,
+	tokenHash string,
+	passwordHash []byte,
+	now time.Time) (string, error) {
+	tx, err := pr.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var tokenID, userID string
+	err = tx.QueryRowContext(ctx, queries.GetPasswordResetTokenForUpdate, tokenHash, now).Scan(&tokenID, &userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrNoRowsFound
+			return "", err
+		}
+
+		return "", fmt.Errorf("error retrieving reset token: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, queries.MarkPasswordResetTokenUsed, tokenID, now); err != nil {
+		return "", fmt.Errorf("error marking reset token as used: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, queries.ResetUserPassword, passwordHash, userID); err != nil {
+		return "", fmt.Errorf("error updating password: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, queries.RevokeUserSessions, userID); err != nil {
+		return "", fmt.Errorf("error revoking sessions: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return userID, nil
+}
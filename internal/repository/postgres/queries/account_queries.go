@@ -0,0 +1,33 @@
+package queries
+
+// AnonymiseUser is used to delete an account, the row is kept for the financial
+// records referencing it while the login, password, profile and 2FA secrets are erased
+const AnonymiseUser = `
+	UPDATE users
+		SET login = 'deleted-' || id,
+			password_hash = ''::bytea,
+			totp_secret = NULL,
+			totp_pending_secret = NULL,
+			totp_enabled_at = NULL,
+			display_name = DEFAULT,
+			email = DEFAULT,
+			email_verified_at = NULL,
+			locale = DEFAULT,
+			timezone = DEFAULT,
+			marketing_consent = DEFAULT,
+			deleted_at = NOW(),
+			version = version + 1
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+`
+
+// DeleteUserPersonalData is used to erase the personal data of a deleted account
+// which is not needed for the financial records, one statement per table
+var DeleteUserPersonalData = []string{
+	`DELETE FROM session_tokens WHERE user_id = $1`,
+	`DELETE FROM recovery_codes WHERE user_id = $1`,
+	`DELETE FROM api_keys WHERE user_id = $1`,
+	`DELETE FROM user_webhooks WHERE user_id = $1`,
+	`DELETE FROM password_reset_tokens WHERE user_id = $1`,
+	`DELETE FROM oidc_states WHERE link_user_id = $1`,
+	`DELETE FROM user_identities WHERE user_id = $1`,
+}
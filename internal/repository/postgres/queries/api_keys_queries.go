@@ -0,0 +1,36 @@
+package queries
+
+// InsertAPIKey is used to store a new API key of an user
+const InsertAPIKey = `
+	INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at
+`
+
+// GetUserAPIKeys is used to retrieve all the API keys of an user, without their hashes
+const GetUserAPIKeys = `
+	SELECT id, user_id, name, prefix, scopes, last_used_at, created_at
+	FROM api_keys
+	WHERE user_id = $1
+	ORDER BY created_at ASC
+`
+
+// GetAPIKeyByPrefix is used to look up the key presented by a client
+const GetAPIKeyByPrefix = `
+	SELECT id, user_id, name, prefix, key_hash, scopes, last_used_at, created_at
+	FROM api_keys
+	WHERE prefix = $1
+`
+
+// DeleteUserAPIKey is used to revoke an API key of an user
+const DeleteUserAPIKey = `
+	DELETE FROM api_keys
+	WHERE id = $1 AND user_id = $2
+`
+
+// TouchAPIKey is used to record the key usage, at most once a minute to spare writes
+const TouchAPIKey = `
+	UPDATE api_keys
+		SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+`
@@ -0,0 +1,33 @@
+package queries
+
+// GetUserBalanceForUpdate is used to lock the balance while it is adjusted
+const GetUserBalanceForUpdate = `
+	SELECT current
+	FROM user_loyalty_points
+	WHERE user_id = $1
+	FOR UPDATE
+`
+
+// AdjustUserBalance is used to apply an adjustment, returning the new balance
+const AdjustUserBalance = `
+	UPDATE user_loyalty_points
+		SET current = current + $1
+		WHERE user_id = $2
+		RETURNING current
+`
+
+// InsertBalanceAdjustment is used to record an adjustment in the audit trail
+const InsertBalanceAdjustment = `
+	INSERT INTO balance_adjustments
+		(user_id, actor_id, amount, reason_code, note, forced, balance_before, balance_after)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id, created_at
+`
+
+// GetUserBalanceAdjustments is used to retrieve the adjustments of an user, latest first
+const GetUserBalanceAdjustments = `
+	SELECT id, user_id, actor_id, amount, reason_code, note, forced, balance_before, balance_after, created_at
+	FROM balance_adjustments
+	WHERE user_id = $1
+	ORDER BY created_at DESC
+`
@@ -0,0 +1,43 @@
+package queries
+
+// GetLoginAttempts is used to retrieve the failed sign-ins of a login or IP key
+const GetLoginAttempts = `
+	SELECT key, failures, last_failed_at, locked_until
+	FROM login_attempts
+	WHERE key = $1
+`
+
+// RecordLoginFailure is used to count a failed sign-in, failures older than the window start are forgotten
+const RecordLoginFailure = `
+	INSERT INTO login_attempts (key, failures, last_failed_at)
+	VALUES ($1, 1, $2)
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE
+			WHEN login_attempts.last_failed_at < $3 THEN 1
+			ELSE login_attempts.failures + 1
+		END,
+		last_failed_at = EXCLUDED.last_failed_at
+	RETURNING key, failures, last_failed_at, locked_until
+`
+
+// LockLogin is used to block sign-ins for a key until the given time
+const LockLogin = `
+	UPDATE login_attempts
+		SET locked_until = $2
+		WHERE key = $1
+`
+
+// DeleteLoginAttempts is used to reset the failed sign-ins of a key
+const DeleteLoginAttempts = `
+	DELETE FROM login_attempts
+		WHERE key = $1
+`
+
+// DeleteStaleLoginAttempts is used to purge keys starting with one of the prefixes that are
+// neither locked nor within the failure window
+const DeleteStaleLoginAttempts = `
+	DELETE FROM login_attempts
+		WHERE last_failed_at < $1
+		AND (locked_until IS NULL OR locked_until < NOW())
+		AND (starts_with(key, $2) OR starts_with(key, $3))
+`
@@ -0,0 +1,34 @@
+package queries
+
+// DeleteExpiredOIDCStates is used to drop the sign-ins that were never completed
+const DeleteExpiredOIDCStates = `
+	DELETE FROM oidc_states
+		WHERE expires_at <= NOW()
+`
+
+// InsertOIDCState is used to remember a sign-in started at the provider
+const InsertOIDCState = `
+	INSERT INTO oidc_states (state_hash, code_verifier, nonce, link_user_id, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+`
+
+// ConsumeOIDCState is used to make a sign-in state single-use
+const ConsumeOIDCState = `
+	DELETE FROM oidc_states
+		WHERE state_hash = $1 AND expires_at > NOW()
+		RETURNING code_verifier, nonce, COALESCE(link_user_id::text, ''), expires_at
+`
+
+// GetUserIdentity is used to find the user an identity of the provider is linked to
+const GetUserIdentity = `
+	SELECT id, user_id, issuer, subject, email, created_at
+		FROM user_identities
+		WHERE issuer = $1 AND subject = $2
+`
+
+// InsertUserIdentity is used to link an identity of the provider to a user
+const InsertUserIdentity = `
+	INSERT INTO user_identities (user_id, issuer, subject, email)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at
+`
@@ -0,0 +1,29 @@
+package queries
+
+// InsertOrderStatusHistoryRecord is used to record an order status transition
+const InsertOrderStatusHistoryRecord = `
+	INSERT INTO order_status_history(order_number, old_status, new_status, accrual, source)
+	VALUES($1, $2, $3, $4, $5)
+	RETURNING id, created_at
+`
+
+// GetOrderStatusHistory is used to retrieve all status transitions of an order
+const GetOrderStatusHistory = `
+	SELECT id, order_number, old_status, new_status, accrual, source, created_at
+	FROM order_status_history
+	WHERE order_number = $1
+	ORDER BY created_at ASC, id ASC
+`
+
+// GetUserOrderStatusHistorySince is used to retrieve the status transitions of all user orders
+// recorded after the given history record
+const GetUserOrderStatusHistorySince = `
+	SELECT h.id, h.order_number, h.old_status, h.new_status, h.accrual, h.source, h.created_at
+	FROM order_status_history h
+	JOIN orders o ON o.order_number = h.order_number
+	JOIN order_status_history since ON since.id::text = $2
+	WHERE
+		o.user_id = $1
+		AND (h.created_at, h.id) > (since.created_at, since.id)
+	ORDER BY h.created_at ASC, h.id ASC
+`
@@ -7,23 +7,75 @@ const GetOrderByOrderNumber = `
 	WHERE order_number = $1
 `
 
-// GetUnfinishedOrders is used to retrive all unfinished (new, processing) orders
+// UserOrderExists is used to check that an order belongs to the user
+const UserOrderExists = `
+	SELECT EXISTS (
+		SELECT 1 FROM orders WHERE order_number = $1 AND user_id = $2
+	)
+`
+
+// GetOrderStatusForUpdate is used to lock an order and retrive its current status
+const GetOrderStatusForUpdate = `
+	SELECT order_status
+	FROM orders
+	WHERE order_number = $1
+	FOR UPDATE
+`
+
+// GetUnfinishedOrders is used to lease all unfinished (new, processing) orders which are not
+// already leased, the lease duration is given in milliseconds
 const GetUnfinishedOrders = `
-	SELECT order_number, order_status, accrual
-	FROM 
-		orders
-	WHERE 
-		order_status IN ($1, $2)
+	UPDATE orders
+	SET leased_until = NOW() + $3 * INTERVAL '1 millisecond'
+	WHERE order_number IN (
+		SELECT order_number
+		FROM 
+			orders
+		WHERE 
+			order_status IN ($1, $2)
+			AND (leased_until IS NULL OR leased_until < NOW())
+		ORDER BY created_at ASC
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING order_number, order_status, accrual
+`
+
+// ReleaseOrderLease is used to release the lease taken on an order
+const ReleaseOrderLease = `
+	UPDATE orders
+	SET leased_until = NULL
+	WHERE order_number = $1
+`
+
+// CancelUserOrder is used to cancel an order of the user which is still new and not leased
+const CancelUserOrder = `
+	UPDATE orders
+	SET
+		order_status = $3,
+		leased_until = NULL
+	WHERE
+		order_number = $1
+		AND user_id = $2
+		AND order_status = $4
+		AND (leased_until IS NULL OR leased_until < NOW())
+	RETURNING accrual
 `
 
 // GetUserOrders is used to retrieve all orders by user_id
 const GetUserOrders = `
-	SELECT order_number, created_at, order_status, accrual
+	SELECT order_number, created_at, order_status, accrual, updated_at
 	FROM orders
 	WHERE user_id = $1
 	ORDER BY created_at DESC
 `
 
+// GetUserOrder is used to retrieve a single order by order_number and user_id
+const GetUserOrder = `
+	SELECT order_number, created_at, order_status, accrual
+	FROM orders
+	WHERE order_number = $1 AND user_id = $2
+`
+
 // InsertOrderRecord is used to insert new order records in the orders table
 const InsertOrderRecord = `
 	INSERT INTO orders(user_id, order_number, order_status)
@@ -37,7 +89,8 @@ const UpdateOrderStatusAndAccrualPoints = `
 	UPDATE orders
 	SET
 		order_status = $1,
-		accrual = $2
+		accrual = $2,
+		leased_until = NULL
 	WHERE
 		order_number = $3
 	RETURNING user_id
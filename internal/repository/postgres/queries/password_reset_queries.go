@@ -0,0 +1,35 @@
+package queries
+
+// DeleteUnusedPasswordResetTokens is used to invalidate the pending reset tokens of a user
+const DeleteUnusedPasswordResetTokens = `
+	DELETE FROM password_reset_tokens
+		WHERE user_id = $1 AND used_at IS NULL
+`
+
+// InsertPasswordResetToken is used to store the hash of a new reset token
+const InsertPasswordResetToken = `
+	INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+	VALUES ($1, $2, $3)
+`
+
+// GetPasswordResetTokenForUpdate is used to lock a usable reset token while it is consumed
+const GetPasswordResetTokenForUpdate = `
+	SELECT id, user_id
+	FROM password_reset_tokens
+	WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+	FOR UPDATE
+`
+
+// MarkPasswordResetTokenUsed is used to make a reset token single-use
+const MarkPasswordResetTokenUsed = `
+	UPDATE password_reset_tokens
+		SET used_at = $2
+		WHERE id = $1
+`
+
+// ResetUserPassword is used to set a new password regardless of the user version
+const ResetUserPassword = `
+	UPDATE users
+		SET password_hash = $1, version = version + 1
+		WHERE id = $2
+`
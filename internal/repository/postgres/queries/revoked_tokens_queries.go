@@ -0,0 +1,20 @@
+package queries
+
+// InsertTokenRevocation is used to revoke access tokens by jti, session or user
+const InsertTokenRevocation = `
+	INSERT INTO revoked_tokens (jti, session_id, user_id, revoked_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+`
+
+// GetActiveTokenRevocations is used to load the revocations that still cover unexpired tokens
+const GetActiveTokenRevocations = `
+	SELECT jti, session_id, user_id, revoked_at, expires_at
+	FROM revoked_tokens
+	WHERE expires_at > NOW()
+`
+
+// DeleteExpiredTokenRevocations is used to purge revocations of tokens that have expired anyway
+const DeleteExpiredTokenRevocations = `
+	DELETE FROM revoked_tokens
+		WHERE expires_at <= NOW()
+`
@@ -1,13 +1,103 @@
 package queries
 
-// DeleteUserSession is used to delete an existing session
-const DeleteUserSession = `
-	DELETE FROM session_tokens 
-		WHERE user_id = $1
+// DeleteUserDeviceSessions is used to drop the previous sessions of a device before logging it in again
+// and returns their token families, sessions without a device ID are never matched
+const DeleteUserDeviceSessions = `
+	WITH deleted AS (
+		DELETE FROM session_tokens
+			WHERE user_id = $1 AND device_id = $2
+			RETURNING family_id
+	)
+	SELECT DISTINCT family_id FROM deleted
 `
 
-// DeleteUserSession is used to create a new user session
+// RevokeExcessUserSessions is used to revoke the least recently refreshed session families of a user
+// beyond the first $2 ones and returns them
+const RevokeExcessUserSessions = `
+	WITH revoked AS (
+		UPDATE session_tokens
+			SET revoked_at = NOW()
+			WHERE user_id = $1 AND revoked_at IS NULL AND family_id IN (
+				SELECT family_id
+				FROM session_tokens
+				WHERE user_id = $1
+					AND used_at IS NULL
+					AND revoked_at IS NULL
+					AND expires_at > NOW()
+				ORDER BY created_at DESC
+				OFFSET $2
+			)
+			RETURNING family_id
+	)
+	SELECT DISTINCT family_id FROM revoked
+`
+
+// CreateNewUserSession is used to create a new user session
 const CreateNewUserSession = `
-	INSERT INTO session_tokens (user_id, token, expires_at)
-	VALUES ($1, $2, $3)
+	INSERT INTO session_tokens (user_id, token_hash, expires_at, device_id, device_info, ip_address)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING family_id
+`
+
+// CreateRotatedUserSession is used to create a session that continues an existing token family
+const CreateRotatedUserSession = `
+	INSERT INTO session_tokens (user_id, token_hash, expires_at, family_id, parent_id, device_id, device_info,
+		ip_address)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+`
+
+// GetSessionByToken is used to retrieve a session by the hash of its refresh token
+const GetSessionByToken = `
+	SELECT id, user_id, token_hash, expires_at, created_at, family_id, parent_id, used_at, revoked_at
+	FROM session_tokens
+	WHERE token_hash = $1
+`
+
+// GetSessionByTokenForUpdate is used to lock a session while its refresh token is rotated
+const GetSessionByTokenForUpdate = `
+	SELECT id, family_id, device_id, used_at, revoked_at
+	FROM session_tokens
+	WHERE token_hash = $1
+	FOR UPDATE
+`
+
+// MarkSessionUsed is used to flag a refresh token as rotated
+const MarkSessionUsed = `
+	UPDATE session_tokens
+		SET used_at = NOW()
+		WHERE id = $1
+`
+
+// RevokeSessionFamily is used to revoke every session descending from the same login
+const RevokeSessionFamily = `
+	UPDATE session_tokens
+		SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+`
+
+// GetUserActiveSessions is used to list the live token of every session family of a user
+const GetUserActiveSessions = `
+	SELECT s.family_id, s.device_info, s.ip_address,
+		(SELECT MIN(f.created_at) FROM session_tokens f WHERE f.family_id = s.family_id),
+		s.created_at, s.expires_at
+	FROM session_tokens s
+	WHERE s.user_id = $1
+		AND s.used_at IS NULL
+		AND s.revoked_at IS NULL
+		AND s.expires_at > $2
+	ORDER BY s.created_at DESC
+`
+
+// RevokeUserSession is used to revoke a single session family owned by the user
+const RevokeUserSession = `
+	UPDATE session_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL
+`
+
+// RevokeUserSessions is used to revoke every session of the user
+const RevokeUserSessions = `
+	UPDATE session_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
 `
@@ -0,0 +1,74 @@
+package queries
+
+// GetUserTwoFactor is used to read the TOTP state of a user
+const GetUserTwoFactor = `
+	SELECT id, totp_secret, totp_pending_secret, totp_enabled_at, totp_last_step
+		FROM users
+		WHERE id = $1
+`
+
+// SetPendingTOTPSecret is used to start an enrollment, the secret is only used once confirmed
+const SetPendingTOTPSecret = `
+	UPDATE users
+		SET totp_pending_secret = $2
+		WHERE id = $1 AND totp_enabled_at IS NULL
+`
+
+// EnableTOTP is used to promote the pending secret once a code generated from it was confirmed
+const EnableTOTP = `
+	UPDATE users
+		SET totp_secret = totp_pending_secret,
+			totp_pending_secret = NULL,
+			totp_enabled_at = NOW(),
+			totp_last_step = $2
+		WHERE id = $1 AND totp_enabled_at IS NULL AND totp_pending_secret IS NOT NULL
+`
+
+// DisableTOTP is used to turn the two-factor authentication off
+const DisableTOTP = `
+	UPDATE users
+		SET totp_secret = NULL,
+			totp_pending_secret = NULL,
+			totp_enabled_at = NULL,
+			totp_last_step = 0
+		WHERE id = $1
+`
+
+// UseTOTPStep is used to accept a code only once, a step not past the last used one is rejected
+const UseTOTPStep = `
+	UPDATE users
+		SET totp_last_step = $2
+		WHERE id = $1 AND totp_enabled_at IS NOT NULL AND totp_last_step < $2
+`
+
+// DeleteRecoveryCodes is used to drop all the recovery codes of a user
+const DeleteRecoveryCodes = `
+	DELETE FROM recovery_codes
+		WHERE user_id = $1
+`
+
+// InsertRecoveryCode is used to store the hash of a new recovery code
+const InsertRecoveryCode = `
+	INSERT INTO recovery_codes (user_id, code_hash)
+	VALUES ($1, $2)
+`
+
+// UseRecoveryCode is used to consume an unused recovery code
+const UseRecoveryCode = `
+	UPDATE recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+`
+
+// DeleteExpiredTwoFactorChallenges is used to forget the used challenges once they expired
+const DeleteExpiredTwoFactorChallenges = `
+	DELETE FROM used_two_factor_challenges
+		WHERE expires_at < $1
+`
+
+// InsertUsedTwoFactorChallenge is used to consume a challenge, a used one is left as is
+const InsertUsedTwoFactorChallenge = `
+	INSERT INTO used_two_factor_challenges (id, expires_at)
+	VALUES ($1, $2)
+	ON CONFLICT (id) DO NOTHING
+`
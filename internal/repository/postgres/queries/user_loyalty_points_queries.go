@@ -2,7 +2,7 @@ package queries
 
 // GetUserBalance is used to get the balance of an user by user id
 const GetUserBalance = `
-	SELECT current, withdrawn
+	SELECT current, withdrawn, updated_at
 	FROM user_loyalty_points
 	WHERE user_id = $1
 `
@@ -16,14 +16,15 @@ const UpdateUserLoyaltyPoints = `
 		user_id = $2
 `
 
-// UpdateUserBalance is used to update the balance of an user
-const UpdateUserBalance = `
+// WithdrawUserPoints is used to take points off the balance of an user, relative to the stored balance
+// so that concurrent updates are not lost, no row is updated when the balance is too low
+const WithdrawUserPoints = `
 	UPDATE user_loyalty_points
-	SET 
-		current = $1,
-		withdrawn = $2
-	WHERE 
-		user_id = $3;
+	SET
+		current = current - $1,
+		withdrawn = withdrawn + $1
+	WHERE
+		user_id = $2 AND current >= $1
 `
 
 const CreateUserBalanceRecord = `
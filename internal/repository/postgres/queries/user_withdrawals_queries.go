@@ -4,12 +4,12 @@ package queries
 const CreateWithdrawalPointsRecord = `
 		INSERT INTO user_withdrawals(user_id, order_number, sum)
 		VALUES($1,$2,$3)
-		RETURNING id
+		RETURNING id, created_at
 	`
 
 // GetUserWithdrawals is used to get all user withdrawals records
 const GetUserWithdrawals = `
-	SELECT order_number, sum, created_at
+	SELECT order_number, sum, created_at, updated_at
 	FROM user_withdrawals
 	WHERE user_id = $1
 	ORDER BY created_at ASC
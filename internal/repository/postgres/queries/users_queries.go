@@ -7,13 +7,86 @@ const InsertNewUser = `
 `
 
 const GetUserByLogin = `
-	SELECT id, login, password_hash, created_at, version
+	SELECT id, login, password_hash, created_at, version, role, suspended_at, totp_enabled_at IS NOT NULL,
+		email, email_verified_at
 		FROM users
-		WHERE login = $1
+		WHERE login = $1 AND deleted_at IS NULL
 `
 
 const GetUserByID = `
-	SELECT id, login, version, created_at, updated_at
+	SELECT id, login, password_hash, version, created_at, updated_at, role, suspended_at,
+		totp_enabled_at IS NOT NULL, display_name, email, email_verified_at, locale, timezone, marketing_consent
 		FROM users
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
+`
+
+// UpdateUserPassword is used to change the password guarded by the version the caller has read
+const UpdateUserPassword = `
+	UPDATE users
+		SET password_hash = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING version
+`
+
+// RehashUserPassword is used to upgrade the password hash, it is guarded by the old
+// hash so that a concurrent password change wins, and leaves the version as is
+const RehashUserPassword = `
+	UPDATE users
+		SET password_hash = $3
+		WHERE id = $1 AND password_hash = $2 AND deleted_at IS NULL
+`
+
+// UpdateUserProfile is used to update the profile guarded by the version the caller has read,
+// a changed email has to be verified again
+const UpdateUserProfile = `
+	UPDATE users
+		SET display_name = $3,
+			email = $4,
+			email_verified_at = CASE WHEN email = $4 THEN email_verified_at END,
+			locale = $5,
+			timezone = $6,
+			marketing_consent = $7,
+			version = version + 1
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+		RETURNING version, updated_at, email_verified_at
+`
+
+// VerifyUserEmail is used to confirm the email, only while it is the one the link was sent to
+const VerifyUserEmail = `
+	UPDATE users
+		SET email_verified_at = NOW(), version = version + 1
+		WHERE id = $1 AND email = $2 AND email <> '' AND email_verified_at IS NULL AND deleted_at IS NULL
+`
+
+// SearchUsers is used by the admin search, the login is matched as a case insensitive substring,
+// the caller escapes the wildcards of $1 with a backslash
+const SearchUsers = `
+	SELECT id, login, role, suspended_at, created_at, updated_at,
+		display_name, email, locale, timezone, marketing_consent
+		FROM users
+		WHERE ($1 = '' OR login ILIKE '%' || $1 || '%' ESCAPE '\') AND ($2 = '' OR role = $2)
+			AND deleted_at IS NULL
+		ORDER BY created_at ASC
+		LIMIT $3 OFFSET $4
+`
+
+// SuspendUser is used to suspend an account, the first suspension time is kept
+const SuspendUser = `
+	UPDATE users
+		SET suspended_at = COALESCE(suspended_at, NOW()), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
+`
+
+// UnsuspendUser is used to lift the suspension of an account
+const UnsuspendUser = `
+	UPDATE users
+		SET suspended_at = NULL, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
+`
+
+// SetUserRole is used to grant a role to an user
+const SetUserRole = `
+	UPDATE users
+		SET role = $2, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
 `
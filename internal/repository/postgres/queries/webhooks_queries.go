@@ -0,0 +1,117 @@
+package queries
+
+// InsertWebhook is used to register a new user webhook
+const InsertWebhook = `
+	INSERT INTO user_webhooks (user_id, url, secret, events)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, is_active, consecutive_failures, created_at, updated_at
+`
+
+// GetUserWebhooks is used to retrieve all the webhooks of an user, without their secrets
+const GetUserWebhooks = `
+	SELECT id, user_id, url, events, is_active, consecutive_failures, disabled_at, created_at, updated_at
+	FROM user_webhooks
+	WHERE user_id = $1
+	ORDER BY created_at ASC
+`
+
+// UserWebhookExists is used to check that a webhook belongs to the user
+const UserWebhookExists = `
+	SELECT EXISTS (
+		SELECT 1 FROM user_webhooks WHERE id = $1 AND user_id = $2
+	)
+`
+
+// DeleteUserWebhook is used to delete a webhook of an user
+const DeleteUserWebhook = `
+	DELETE FROM user_webhooks
+	WHERE id = $1 AND user_id = $2
+`
+
+// InsertWebhookDeliveries is used to queue an event for all the active user webhooks subscribed to it
+const InsertWebhookDeliveries = `
+	INSERT INTO webhook_deliveries (webhook_id, event_type, payload)
+	SELECT id, $2, $3
+	FROM user_webhooks
+	WHERE user_id = $1 AND is_active AND $2 = ANY(events)
+`
+
+// GetWebhookDeliveries is used to retrieve the latest deliveries of a webhook
+const GetWebhookDeliveries = `
+	SELECT id, webhook_id, event_type, status, attempts, next_attempt_at, delivered_at, created_at
+	FROM webhook_deliveries
+	WHERE webhook_id = $1
+	ORDER BY created_at DESC
+	LIMIT $2
+`
+
+// GetWebhookDeliveryAttempts is used to retrieve the delivery log of the given deliveries
+const GetWebhookDeliveryAttempts = `
+	SELECT id, delivery_id, response_status, error, duration_ms, created_at
+	FROM webhook_delivery_attempts
+	WHERE delivery_id = ANY($1)
+	ORDER BY created_at ASC
+`
+
+// LeasePendingWebhookDeliveries is used to pick the due deliveries and postpone their next attempt
+// for the lease duration (in milliseconds) so that concurrent dispatchers do not pick them as well
+const LeasePendingWebhookDeliveries = `
+	UPDATE webhook_deliveries d
+	SET next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond'
+	FROM user_webhooks w
+	WHERE
+		w.id = d.webhook_id
+		AND d.id IN (
+			SELECT pd.id
+			FROM webhook_deliveries pd
+			JOIN user_webhooks pw ON pw.id = pd.webhook_id
+			WHERE pd.status = $3 AND pd.next_attempt_at <= NOW() AND pw.is_active
+			ORDER BY pd.next_attempt_at ASC
+			LIMIT $1
+			FOR UPDATE OF pd SKIP LOCKED
+		)
+	RETURNING d.id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts, d.created_at, w.url, w.secret
+`
+
+// UpdateWebhookDelivery is used to store the outcome of a delivery attempt
+const UpdateWebhookDelivery = `
+	UPDATE webhook_deliveries
+	SET
+		status = $2,
+		attempts = $3,
+		next_attempt_at = $4,
+		delivered_at = $5
+	WHERE id = $1
+`
+
+// InsertWebhookDeliveryAttempt is used to log a delivery attempt
+const InsertWebhookDeliveryAttempt = `
+	INSERT INTO webhook_delivery_attempts (delivery_id, response_status, error, duration_ms)
+	VALUES ($1, $2, $3, $4)
+`
+
+// ResetWebhookFailures is used to reset the consecutive failures of a webhook after a successful delivery
+const ResetWebhookFailures = `
+	UPDATE user_webhooks
+	SET consecutive_failures = 0
+	WHERE id = $1
+`
+
+// IncrementWebhookFailures is used to count a failed delivery and disable the webhook
+// once the consecutive failures threshold is reached
+const IncrementWebhookFailures = `
+	UPDATE user_webhooks
+	SET
+		consecutive_failures = consecutive_failures + 1,
+		is_active = consecutive_failures + 1 < $2,
+		disabled_at = CASE WHEN consecutive_failures + 1 >= $2 THEN NOW() ELSE disabled_at END
+	WHERE id = $1
+	RETURNING is_active
+`
+
+// FailWebhookDeliveries is used to give up on the pending deliveries of a disabled webhook
+const FailWebhookDeliveries = `
+	UPDATE webhook_deliveries
+	SET status = $2
+	WHERE webhook_id = $1 AND status = $3
+`
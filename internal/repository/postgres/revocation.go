@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres/queries"
+)
+
+type revocationRepository struct {
+	db *sqlx.DB
+}
+
+func NewRevocationRepository(db *sqlx.DB) (*revocationRepository, error) {
+	return &revocationRepository{
+		db: db,
+	}, nil
+}
+
+func (rr *revocationRepository) RevokeTokens(ctx context.Context, revocation domain.TokenRevocation) error {
+	_, err := rr.db.ExecContext(ctx, queries.InsertTokenRevocation,
+		revocation.JTI,
+		revocation.SessionID,
+		revocation.UserID,
+		revocation.RevokedAt,
+		revocation.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error inserting token revocation: %w", err)
+	}
+
+	return nil
+}
+
+func (rr *revocationRepository) GetTokenRevocations(ctx context.Context) ([]domain.TokenRevocation, error) {
+	rows, err := rr.db.QueryContext(ctx, queries.GetActiveTokenRevocations)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving token revocations: %w", err)
+	}
+	defer rows.Close()
+
+	revocations := []domain.TokenRevocation{}
+	for rows.Next() {
+		var r domain.TokenRevocation
+		if err := rows.Scan(&r.JTI, &r.SessionID, &r.UserID, &r.RevokedAt, &r.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("error scanning token revocation: %w", err)
+		}
+
+		revocations = append(revocations, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revocations, nil
+}
+
+func (rr *revocationRepository) DeleteExpiredTokenRevocations(ctx context.Context) error {
+	if _, err := rr.db.ExecContext(ctx, queries.DeleteExpiredTokenRevocations); err != nil {
+		return fmt.Errorf("error deleting expired token revocations: %w", err)
+	}
+
+	return nil
+}
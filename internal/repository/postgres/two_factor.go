@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres/queries"
+)
+
+type twoFactorRepository struct {
+	db *sqlx.DB
+}
+
+func NewTwoFactorRepository(db *sqlx.DB) (*twoFactorRepository, error) {
+	return &twoFactorRepository{
+		db: db,
+	}, nil
+}
+
+func (tr *twoFactorRepository) GetTwoFactor(ctx context.Context, userID string) (domain.TwoFactor, error) {
+	var tf domain.TwoFactor
+
+	err := tr.db.QueryRowContext(ctx, queries.GetUserTwoFactor, userID).Scan(
+		&tf.UserID,
+		&tf.Secret,
+		&tf.PendingSecret,
+		&tf.EnabledAt,
+		&tf.LastStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.TwoFactor{}, ErrNoRowsFound
+		}
+
+		return domain.TwoFactor{}, err
+	}
+
+	return tf, nil
+}
+
+// SetPendingTOTPSecret replaces the secret of an enrollment in progress, it fails
+// with ErrNoRowsFound when the two-factor authentication is already enabled.
+func (tr *twoFactorRepository) SetPendingTOTPSecret(ctx context.Context, userID, secret string) error {
+	res, err := tr.db.ExecContext(ctx, queries.SetPendingTOTPSecret, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+// EnableTOTP activates the pending secret with step as the last used one and
+// replaces the recovery codes of the user.
+func (tr *twoFactorRepository) EnableTOTP(ctx context.Context,
+	userID string,
+	step int64,
+	recoveryCodeHashes []string) error {
+	tx, err := tr.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	res, err := tx.ExecContext(ctx, queries.EnableTOTP, userID, step)
+	if err != nil {
+		return fmt.Errorf("error enabling totp: %w", err)
+	}
+
+	if err = expectAffected(res); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, queries.DeleteRecoveryCodes, userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+
+	for _, h := range recoveryCodeHashes {
+		if _, err = tx.ExecContext(ctx, queries.InsertRecoveryCode, userID, h); err != nil {
+			return fmt.Errorf("error inserting recovery code: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DisableTOTP clears the secret and the recovery codes of the user.
+func (tr *twoFactorRepository) DisableTOTP(ctx context.Context, userID string) error {
+	tx, err := tr.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, queries.DisableTOTP, userID); err != nil {
+		return fmt.Errorf("error disabling totp: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, queries.DeleteRecoveryCodes, userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UseTOTPStep records step as the last used one, it fails with ErrNoRowsFound
+// when a code of the same or a later step was already accepted.
+func (tr *twoFactorRepository) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	res, err := tr.db.ExecContext(ctx, queries.UseTOTPStep, userID, step)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+// UseRecoveryCode consumes the recovery code, it fails with ErrNoRowsFound when
+// the code is unknown or was already used.
+func (tr *twoFactorRepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	res, err := tr.db.ExecContext(ctx, queries.UseRecoveryCode, userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(res)
+}
+
+// UseChallenge consumes the two-factor challenge, it fails with ErrNoRowsFound when
+// the challenge was already used. The expired challenges are forgotten on the way.
+func (tr *twoFactorRepository) UseChallenge(ctx context.Context, challengeID string, expiresAt time.Time) error {
+	if _, err := tr.db.ExecContext(ctx, queries.DeleteExpiredTwoFactorChallenges, time.Now().UTC()); err != nil {
+		return fmt.Errorf("error deleting expired challenges: %w", err)
+	}
+
+	res, err := tr.db.ExecContext(ctx, queries.InsertUsedTwoFactorChallenge, challengeID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error consuming challenge: %w", err)
+	}
+
+	return expectAffected(res)
+}
+
+func expectAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNoRowsFound
+	}
+
+	return nil
+}
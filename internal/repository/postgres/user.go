@@ -60,17 +60,214 @@ func (u *userRepository) Create(ctx context.Context, user domain.User) (string,
 	return userID, nil
 }
 
-func (u *userRepository) SetSessionToken(ctx context.Context, st domain.Session) error {
-	_, err := u.db.ExecContext(ctx, queries.DeleteUserSession, st.UserID)
+// SetSessionToken stores a new session, replacing any previous session with the same device ID and
+// revoking the oldest sessions beyond domain.MaxUserSessions. It returns the ID of the token family
+// it starts and the families it ended, whose access tokens are still valid.
+func (u *userRepository) SetSessionToken(ctx context.Context, st domain.Session) (string, []string, error) {
+	tx, err := u.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return "", nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	ended, err := queryFamilyIDs(ctx, tx, queries.DeleteUserDeviceSessions, st.UserID, st.DeviceID)
 	if err != nil {
-		return fmt.Errorf("error deleting old token: %w", err)
+		return "", nil, fmt.Errorf("error deleting old token: %w", err)
 	}
 
-	_, err = u.db.ExecContext(ctx, queries.CreateNewUserSession, st.UserID, st.Token, st.ExpiresAt)
+	var familyID string
+	err = tx.QueryRowContext(ctx, queries.CreateNewUserSession,
+		st.UserID, st.TokenHash, st.ExpiresAt, st.DeviceID, st.DeviceInfo, st.IPAddress).Scan(&familyID)
+	if err != nil {
+		return "", nil, fmt.Errorf("error inserting new token: %w", err)
+	}
+
+	pruned, err := queryFamilyIDs(ctx, tx, queries.RevokeExcessUserSessions, st.UserID, domain.MaxUserSessions)
+	if err != nil {
+		return "", nil, fmt.Errorf("error revoking excess sessions: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", nil, err
+	}
+
+	return familyID, append(ended, pruned...), nil
+}
+
+func queryFamilyIDs(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var familyIDs []string
+	for rows.Next() {
+		var familyID string
+		if err := rows.Scan(&familyID); err != nil {
+			return nil, err
+		}
+
+		familyIDs = append(familyIDs, familyID)
+	}
+
+	return familyIDs, rows.Err()
+}
+
+func (u *userRepository) GetSessionByToken(ctx context.Context, tokenHash string) (domain.Session, error) {
+	var st domain.Session
+
+	err := u.db.QueryRowContext(ctx, queries.GetSessionByToken, tokenHash).Scan(
+		&st.ID,
+		&st.UserID,
+		&st.TokenHash,
+		&st.ExpiresAt,
+		&st.CreatedAt,
+		&st.FamilyID,
+		&st.ParentID,
+		&st.UsedAt,
+		&st.RevokedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return st, ErrNoRowsFound
+		}
+
+		return st, fmt.Errorf("error retrieving session: %w", err)
+	}
+
+	return st, nil
+}
+
+// RotateSessionToken marks the old refresh token as used and stores the new session in
+// the same token family. Presenting a token that was already rotated revokes the whole
+// family and fails with ErrRefreshTokenReused.
+func (u *userRepository) RotateSessionToken(ctx context.Context, oldTokenHash string, st domain.Session) error {
+	tx, err := u.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var old domain.Session
+	err = tx.QueryRowContext(ctx, queries.GetSessionByTokenForUpdate, oldTokenHash).Scan(
+		&old.ID,
+		&old.FamilyID,
+		&old.DeviceID,
+		&old.UsedAt,
+		&old.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrNoRowsFound
+			return err
+		}
+
+		return fmt.Errorf("error retrieving session: %w", err)
+	}
+
+	// a logged out session is simply no longer valid
+	if old.RevokedAt != nil {
+		err = ErrNoRowsFound
+		return err
+	}
+
+	if old.UsedAt != nil {
+		if _, err = tx.ExecContext(ctx, queries.RevokeSessionFamily, old.FamilyID); err != nil {
+			return fmt.Errorf("error revoking session family: %w", err)
+		}
+
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+
+		return ErrRefreshTokenReused
+	}
+
+	if _, err = tx.ExecContext(ctx, queries.MarkSessionUsed, old.ID); err != nil {
+		return fmt.Errorf("error marking old token as used: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, queries.CreateRotatedUserSession,
+		st.UserID, st.TokenHash, st.ExpiresAt, old.FamilyID, old.ID, old.DeviceID, st.DeviceInfo, st.IPAddress)
 	if err != nil {
 		return fmt.Errorf("error inserting new token: %w", err)
 	}
 
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (u *userRepository) GetUserSessions(ctx context.Context, userID string) ([]domain.UserSession, error) {
+	rows, err := u.db.QueryContext(ctx, queries.GetUserActiveSessions, userID, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []domain.UserSession{}
+	for rows.Next() {
+		var session domain.UserSession
+		err := rows.Scan(
+			&session.ID,
+			&session.DeviceInfo,
+			&session.IPAddress,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning session: %w", err)
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (u *userRepository) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	res, err := u.db.ExecContext(ctx, queries.RevokeUserSession, userID, sessionID)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+
+	ar, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if ar == 0 {
+		return ErrNoRowsFound
+	}
+
+	return nil
+}
+
+func (u *userRepository) RevokeAllSessions(ctx context.Context, userID string) error {
+	if _, err := u.db.ExecContext(ctx, queries.RevokeUserSessions, userID); err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+
 	return nil
 }
 
@@ -87,14 +284,19 @@ func (u *userRepository) GetUserByLogin(ctx context.Context, login string) (doma
 		&user.Login,
 		&user.Password.Hash,
 		&user.CreatedAt,
-		&user.Version)
+		&user.Version,
+		&user.Role,
+		&user.SuspendedAt,
+		&user.TwoFactorEnabled,
+		&user.Email,
+		&user.EmailVerifiedAt)
 
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return domain.User{}, ErrNoRowsFound
 		default:
-			return domain.User{}, nil
+			return domain.User{}, err
 		}
 	}
 
@@ -112,18 +314,107 @@ func (u *userRepository) GetUserByID(ctx context.Context, id string) (domain.Use
 	err := row.Scan(
 		&user.ID,
 		&user.Login,
+		&user.Password.Hash,
 		&user.Version,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.Role,
+		&user.SuspendedAt,
+		&user.TwoFactorEnabled,
+		&user.DisplayName,
+		&user.Email,
+		&user.EmailVerifiedAt,
+		&user.Locale,
+		&user.Timezone,
+		&user.MarketingConsent,
 	)
 
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, ErrNoRowsFound
+		}
+
 		return user, err
 	}
 
 	return user, nil
 }
 
+// UpdateProfile stores the profile of the user and returns it with the new version,
+// it fails with ErrEditConflict when the user was modified since it was read.
+func (u *userRepository) UpdateProfile(ctx context.Context, user domain.User) (domain.User, error) {
+	err := u.db.QueryRowContext(ctx, queries.UpdateUserProfile,
+		user.ID,
+		user.Version,
+		user.DisplayName,
+		user.Email,
+		user.Locale,
+		user.Timezone,
+		user.MarketingConsent,
+	).Scan(
+		&user.Version,
+		&user.UpdatedAt,
+		&user.EmailVerifiedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.User{}, ErrEditConflict
+		}
+
+		return domain.User{}, fmt.Errorf("error updating profile: %w", err)
+	}
+
+	return user, nil
+}
+
+// VerifyEmail marks the email of the user as verified, it fails with ErrNoRowsFound
+// when the user has another email by now or it is verified already.
+func (u *userRepository) VerifyEmail(ctx context.Context, userID, email string) error {
+	res, err := u.db.ExecContext(ctx, queries.VerifyUserEmail, userID, email)
+	if err != nil {
+		return fmt.Errorf("error verifying email: %w", err)
+	}
+
+	return expectAffected(res)
+}
+
+// UpdatePassword stores the new password hash, it fails with ErrEditConflict when
+// the user was modified since it was read.
+func (u *userRepository) UpdatePassword(ctx context.Context, user domain.User) (int, error) {
+	var version int
+
+	err := u.db.QueryRowContext(ctx, queries.UpdateUserPassword,
+		user.Password.Hash, user.ID, user.Version).Scan(&version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrEditConflict
+		}
+
+		return 0, fmt.Errorf("error updating password: %w", err)
+	}
+
+	return version, nil
+}
+
+// RehashPassword replaces the password hash with an upgraded hash of the same
+// password, it fails with ErrEditConflict when the hash was changed meanwhile.
+func (u *userRepository) RehashPassword(ctx context.Context, userID string, oldHash, newHash []byte) error {
+	res, err := u.db.ExecContext(ctx, queries.RehashUserPassword, userID, oldHash, newHash)
+	if err != nil {
+		return fmt.Errorf("error rehashing password: %w", err)
+	}
+
+	if err := expectAffected(res); err != nil {
+		if errors.Is(err, ErrNoRowsFound) {
+			return ErrEditConflict
+		}
+
+		return err
+	}
+
+	return nil
+}
+
 func (u *userRepository) RegisterOrder(ctx context.Context, order domain.Order) (domain.Order, error) {
 	tx, err := u.db.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
@@ -156,6 +447,10 @@ func (u *userRepository) RegisterOrder(ctx context.Context, order domain.Order)
 				return existingOrder, ErrOrderAlreadyAccepted
 			}
 
+			if existingOrder.OrderStatus == domain.OrderStatusCancelled {
+				return existingOrder, ErrOrderCancelled
+			}
+
 			return existingOrder, ErrOrderAlreadyExistsSameUser
 		}
 	}
@@ -174,6 +469,17 @@ func (u *userRepository) RegisterOrder(ctx context.Context, order domain.Order)
 		return domain.Order{}, fmt.Errorf("error inserting new order: %w", err)
 	}
 
+	_, err = insertOrderStatusChange(ctx, tx, domain.OrderStatusChange{
+		OrderNumber: insertedOrder.OrderNumber,
+		NewStatus:   insertedOrder.OrderStatus,
+		Accrual:     insertedOrder.Accrual,
+		Source:      domain.OrderStatusSourceUser,
+	})
+
+	if err != nil {
+		return domain.Order{}, err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return domain.Order{}, err
 	}
@@ -199,6 +505,7 @@ func (u *userRepository) GetUserOrders(ctx context.Context, userID string) ([]do
 			&createdAt,
 			&order.Status,
 			&order.Accrual,
+			&order.UpdatedAt,
 		)
 
 		if err != nil {
@@ -217,24 +524,94 @@ func (u *userRepository) GetUserOrders(ctx context.Context, userID string) ([]do
 	return orders, nil
 }
 
-func (u *userRepository) GetUserBalance(ctx context.Context, userID string) (domain.UserBalance, error) {
-	return u.getUserBalance(ctx, userID)
+func (u *userRepository) GetUserOrder(ctx context.Context, userID, orderNumber string) (domain.UserOrderDetails, error) {
+	var order domain.UserOrderDetails
+	var createdAt time.Time
+
+	err := u.db.QueryRowContext(ctx, queries.GetUserOrder, orderNumber, userID).Scan(
+		&order.Number,
+		&createdAt,
+		&order.Status,
+		&order.Accrual,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return order, ErrNoRowsFound
+		}
+
+		return order, fmt.Errorf("error retrieving order: %w", err)
+	}
+
+	order.UploadedAt = createdAt.Format(time.RFC3339)
+
+	order.History, err = u.getOrderStatusHistory(ctx, orderNumber)
+	if err != nil {
+		return order, err
+	}
+
+	return order, nil
 }
 
-func (u *userRepository) WithdrawalPoints(ctx context.Context, wp domain.Withdrawal) (string, error) {
-	var id string
+func (u *userRepository) GetUserOrderStatusChanges(ctx context.Context,
+	userID, sinceID string) ([]domain.OrderStatusChange, error) {
+	rows, err := u.db.QueryContext(ctx, queries.GetUserOrderStatusHistorySince, userID, sinceID)
+	if err != nil {
+		return nil, err
+	}
 
-	// Get the current user balance
-	balance, err := u.getUserBalance(ctx, wp.UserID)
+	return scanOrderStatusHistory(rows)
+}
+
+func (u *userRepository) getOrderStatusHistory(ctx context.Context, orderNumber string) ([]domain.OrderStatusChange, error) {
+	rows, err := u.db.QueryContext(ctx, queries.GetOrderStatusHistory, orderNumber)
 	if err != nil {
-		return id, err
+		return nil, err
+	}
+
+	return scanOrderStatusHistory(rows)
+}
+
+func scanOrderStatusHistory(rows *sql.Rows) ([]domain.OrderStatusChange, error) {
+	defer rows.Close()
+
+	history := []domain.OrderStatusChange{}
+	for rows.Next() {
+		var change domain.OrderStatusChange
+
+		err := rows.Scan(
+			&change.ID,
+			&change.OrderNumber,
+			&change.OldStatus,
+			&change.NewStatus,
+			&change.Accrual,
+			&change.Source,
+			&change.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("error scanning order history row: %w", err)
+		}
+
+		change.ChangedAt = change.CreatedAt.Format(time.RFC3339)
+
+		history = append(history, change)
 	}
 
-	// Check if the user has sufficient points
-	if balance.Current < wp.Sum {
-		return id, ErrInsufficientPoints
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after reading rows: %w", err)
 	}
 
+	return history, nil
+}
+
+func (u *userRepository) GetUserBalance(ctx context.Context, userID string) (domain.UserBalance, error) {
+	return u.getUserBalance(ctx, userID)
+}
+
+func (u *userRepository) WithdrawalPoints(ctx context.Context, wp domain.Withdrawal) (string, error) {
+	var id string
+
 	// Begin a transaction
 	tx, err := u.db.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
@@ -248,18 +625,33 @@ func (u *userRepository) WithdrawalPoints(ctx context.Context, wp domain.Withdra
 		}
 	}()
 
-	// Update the user's balance
-	balance.Withdrawn += wp.Sum
-	balance.Current -= wp.Sum
+	// Take the points off the stored balance, the row lock serializes it with the
+	// other balance updates and no row is updated when the points are not sufficient
+	res, err := tx.ExecContext(ctx, queries.WithdrawUserPoints, wp.Sum, wp.UserID)
+	if err != nil {
+		return id, err
+	}
 
-	// Update the user balance in the database
-	_, err = tx.ExecContext(ctx, queries.UpdateUserBalance, balance.Current, balance.Withdrawn, wp.UserID)
+	updated, err := res.RowsAffected()
 	if err != nil {
 		return id, err
 	}
 
+	if updated == 0 {
+		err = ErrInsufficientPoints
+		return id, err
+	}
+
 	// Create the withdrawal points record
-	err = tx.QueryRowContext(ctx, queries.CreateWithdrawalPointsRecord, wp.UserID, wp.Order, wp.Sum).Scan(&id)
+	err = tx.QueryRowContext(ctx, queries.CreateWithdrawalPointsRecord, wp.UserID, wp.Order, wp.Sum).Scan(
+		&id,
+		&wp.CreatedAt)
+	if err != nil {
+		return id, err
+	}
+
+	wp.ProcessedAt = wp.CreatedAt.Format(time.RFC3339)
+	err = enqueueWebhookDeliveries(ctx, tx, wp.UserID, domain.WebhookEventWithdrawalCreated, wp)
 	if err != nil {
 		return id, err
 	}
@@ -279,7 +671,7 @@ func (u *userRepository) getUserBalance(ctx context.Context, userID string) (dom
 	row := u.db.QueryRowContext(ctx, queries.GetUserBalance, userID)
 
 	// Scan the result into the balance struct
-	if err := row.Scan(&balance.Current, &balance.Withdrawn); err != nil {
+	if err := row.Scan(&balance.Current, &balance.Withdrawn, &balance.UpdatedAt); err != nil {
 		return balance, err
 	}
 
@@ -306,6 +698,7 @@ func (u *userRepository) GetWithdrawals(ctx context.Context, userID string) ([]d
 			&withdrawal.Order,
 			&withdrawal.Sum,
 			&createdAt,
+			&withdrawal.UpdatedAt,
 		); err != nil {
 			return withdrawals, err
 		}
@@ -323,7 +716,7 @@ func (u *userRepository) GetWithdrawals(ctx context.Context, userID string) ([]d
 	return withdrawals, nil
 }
 
-func (u *userRepository) GetUnfinishedOrders(ctx context.Context) ([]domain.Order, error) {
+func (u *userRepository) GetUnfinishedOrders(ctx context.Context, lease time.Duration) ([]domain.Order, error) {
 	var orders []domain.Order
 
 	tx, err := u.db.BeginTx(ctx, &sql.TxOptions{})
@@ -337,7 +730,8 @@ func (u *userRepository) GetUnfinishedOrders(ctx context.Context) ([]domain.Orde
 		}
 	}()
 
-	rows, err := tx.QueryContext(ctx, queries.GetUnfinishedOrders, domain.OrderStatusNew, domain.OrderStatusProcessed)
+	rows, err := tx.QueryContext(ctx, queries.GetUnfinishedOrders,
+		domain.OrderStatusNew, domain.OrderStatusProcessing, lease.Milliseconds())
 
 	if err != nil {
 		return orders, err
@@ -370,10 +764,12 @@ func (u *userRepository) GetUnfinishedOrders(ctx context.Context) ([]domain.Orde
 	return orders, nil
 }
 
-func (u *userRepository) UpdateOrder(ctx context.Context, order domain.Order) error {
+func (u *userRepository) UpdateOrder(ctx context.Context, order domain.Order) (domain.OrderStatusChange, error) {
+	var change domain.OrderStatusChange
+
 	tx, err := u.db.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
-		return err
+		return change, err
 	}
 
 	defer func() {
@@ -382,13 +778,38 @@ func (u *userRepository) UpdateOrder(ctx context.Context, order domain.Order) er
 		}
 	}()
 
+	var oldStatus string
+	err = tx.QueryRowContext(ctx, queries.GetOrderStatusForUpdate, order.OrderNumber).Scan(&oldStatus)
+	if err != nil {
+		return change, err
+	}
+
+	// the order might have been cancelled after its lease expired
+	if oldStatus == domain.OrderStatusCancelled {
+		err = ErrOrderCancelled
+		return change, err
+	}
+
 	err = tx.QueryRowContext(ctx, queries.UpdateOrderStatusAndAccrualPoints,
 		order.OrderStatus, order.Accrual, order.OrderNumber).Scan(
 		&order.UserID,
 	)
 
 	if err != nil {
-		return err
+		return change, err
+	}
+
+	change, err = insertOrderStatusChange(ctx, tx, domain.OrderStatusChange{
+		OrderNumber: order.OrderNumber,
+		OldStatus:   &oldStatus,
+		NewStatus:   order.OrderStatus,
+		Accrual:     order.Accrual,
+		Source:      order.StatusSource,
+		UserID:      order.UserID,
+	})
+
+	if err != nil {
+		return change, err
 	}
 
 	logger.Log.InfoContext(ctx,
@@ -399,12 +820,13 @@ func (u *userRepository) UpdateOrder(ctx context.Context, order domain.Order) er
 	res, err := tx.ExecContext(ctx, queries.UpdateUserLoyaltyPoints, order.Accrual, order.UserID)
 
 	if err != nil {
-		return err
+		return change, err
 	}
 
 	ar, err := res.RowsAffected()
 	if err != nil || ar != 1 {
-		return fmt.Errorf("user loyalty points not updated %w", err)
+		err = fmt.Errorf("user loyalty points not updated %w", err)
+		return change, err
 	}
 
 	logger.Log.InfoContext(ctx,
@@ -412,9 +834,103 @@ func (u *userRepository) UpdateOrder(ctx context.Context, order domain.Order) er
 		slog.String("order", order.OrderNumber),
 		slog.String("userID", order.UserID))
 
+	if event, ok := domain.OrderWebhookEvent(change.NewStatus); ok {
+		if err = enqueueWebhookDeliveries(ctx, tx, change.UserID, event, change); err != nil {
+			return change, err
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
-		return err
+		return change, err
 	}
 
-	return nil
+	return change, nil
+}
+
+func (u *userRepository) ReleaseOrderLease(ctx context.Context, orderNumber string) error {
+	_, err := u.db.ExecContext(ctx, queries.ReleaseOrderLease, orderNumber)
+	return err
+}
+
+// CancelOrder cancels an order which is still new and not leased by the poller. Cancelling is
+// final, the order keeps its number so that it can not be uploaded again, by any user.
+func (u *userRepository) CancelOrder(ctx context.Context, userID, orderNumber string) (domain.OrderStatusChange, error) {
+	var change domain.OrderStatusChange
+
+	tx, err := u.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return change, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// the update only matches a new order which is not leased by the poller, the row lock
+	// taken by the update makes it race free against the poller leasing the order
+	var accrual float64
+	err = tx.QueryRowContext(ctx, queries.CancelUserOrder,
+		orderNumber, userID, domain.OrderStatusCancelled, domain.OrderStatusNew).Scan(&accrual)
+
+	// the orders of other users are reported as not found, so that their numbers
+	// can not be probed
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		err = tx.QueryRowContext(ctx, queries.UserOrderExists, orderNumber, userID).Scan(&exists)
+		if err != nil {
+			return change, fmt.Errorf("error checking existing order: %w", err)
+		}
+
+		if !exists {
+			err = ErrNoRowsFound
+			return change, err
+		}
+
+		err = ErrOrderNotCancellable
+		return change, err
+	}
+
+	if err != nil {
+		return change, fmt.Errorf("error cancelling order: %w", err)
+	}
+
+	oldStatus := domain.OrderStatusNew
+	change, err = insertOrderStatusChange(ctx, tx, domain.OrderStatusChange{
+		OrderNumber: orderNumber,
+		UserID:      userID,
+		OldStatus:   &oldStatus,
+		NewStatus:   domain.OrderStatusCancelled,
+		Accrual:     accrual,
+		Source:      domain.OrderStatusSourceUser,
+	})
+
+	if err != nil {
+		return change, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return change, err
+	}
+
+	return change, nil
+}
+
+func insertOrderStatusChange(ctx context.Context, tx *sql.Tx, change domain.OrderStatusChange) (domain.OrderStatusChange, error) {
+	err := tx.QueryRowContext(ctx, queries.InsertOrderStatusHistoryRecord,
+		change.OrderNumber,
+		change.OldStatus,
+		change.NewStatus,
+		change.Accrual,
+		change.Source,
+	).Scan(&change.ID, &change.CreatedAt)
+
+	if err != nil {
+		return change, fmt.Errorf("error inserting order status history: %w", err)
+	}
+
+	change.ChangedAt = change.CreatedAt.Format(time.RFC3339)
+
+	return change, nil
 }
@@ -0,0 +1,170 @@
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+)
+
+func TestUserRepository_GetUserByIDTwoFactor(t *testing.T) {
+	columns := []string{"id", "login", "password_hash", "version", "created_at", "updated_at", "role",
+		"suspended_at", "two_factor_enabled", "display_name", "email", "email_verified_at", "locale", "timezone",
+		"marketing_consent"}
+
+	tests := []struct {
+		name    string
+		enabled bool
+	}{
+		{name: "two-factor enabled", enabled: true},
+		{name: "two-factor disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			db, _ := newFakeDB(t, fakeResult{
+				match:   "WHERE id = $1",
+				columns: columns,
+				rows: [][]driver.Value{{"user-1", "alice", []byte("hash"), int64(1), now, now, "user", nil, tt.enabled,
+					"Alice", "", nil, "en", "UTC", false}},
+			})
+
+			repo, _ := NewUserRepository(db)
+
+			user, err := repo.GetUserByID(context.Background(), "user-1")
+			if err != nil {
+				t.Fatalf("GetUserByID() error = %v", err)
+			}
+
+			if user.TwoFactorEnabled != tt.enabled {
+				t.Errorf("TwoFactorEnabled = %v, want %v", user.TwoFactorEnabled, tt.enabled)
+			}
+		})
+	}
+}
+
+func TestUserRepository_SetSessionTokenEndedFamilies(t *testing.T) {
+	db, fdb := newFakeDB(t,
+		fakeResult{match: "DELETE FROM session_tokens", columns: []string{"family_id"},
+			rows: [][]driver.Value{{"family-phone"}}},
+		fakeResult{match: "INSERT INTO session_tokens", columns: []string{"family_id"},
+			rows: [][]driver.Value{{"family-new"}}},
+		fakeResult{match: "OFFSET $2", columns: []string{"family_id"}, rows: [][]driver.Value{{"family-oldest"}}},
+	)
+
+	repo, _ := NewUserRepository(db)
+
+	deviceID := "phone"
+	familyID, ended, err := repo.SetSessionToken(context.Background(), domain.Session{
+		UserID:    "user-1",
+		TokenHash: "hash",
+		ExpiresAt: time.Now().Add(time.Hour),
+		DeviceID:  &deviceID,
+	})
+	if err != nil {
+		t.Fatalf("SetSessionToken() error = %v", err)
+	}
+
+	if familyID != "family-new" {
+		t.Errorf("family ID = %q, want %q", familyID, "family-new")
+	}
+
+	if want := []string{"family-phone", "family-oldest"}; !slices.Equal(ended, want) {
+		t.Errorf("ended families = %v, want %v", ended, want)
+	}
+
+	pruned := fdb.ran("OFFSET $2")
+	if len(pruned) != 1 || pruned[0].args[1].Value != int64(domain.MaxUserSessions) {
+		t.Errorf("pruning statements = %+v, want one keeping %d sessions", pruned, domain.MaxUserSessions)
+	}
+}
+
+func TestUserRepository_WithdrawalPoints(t *testing.T) {
+	tests := []struct {
+		name string
+		// updated is the number of balance rows the withdrawal updated
+		updated     int64
+		wantErr     error
+		wantRecords int
+	}{
+		{name: "sufficient points", updated: 1, wantRecords: 1},
+		{name: "insufficient points", updated: 0, wantErr: ErrInsufficientPoints},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fdb := newFakeDB(t,
+				fakeResult{match: "UPDATE user_loyalty_points", affected: tt.updated},
+				fakeResult{match: "INSERT INTO user_withdrawals", columns: []string{"id", "created_at"},
+					rows: [][]driver.Value{{"withdrawal-1", time.Now()}}},
+				fakeResult{match: "webhook_deliveries", affected: 1},
+			)
+
+			repo, _ := NewUserRepository(db)
+
+			_, err := repo.WithdrawalPoints(context.Background(),
+				domain.Withdrawal{UserID: "user-1", Order: "2377225624", Sum: 500})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("WithdrawalPoints() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// the balance is updated relative to the stored one, it is never read first
+			if reads := fdb.ran("SELECT current"); len(reads) != 0 {
+				t.Errorf("the balance was read before the update: %+v", reads)
+			}
+
+			if records := fdb.ran("INSERT INTO user_withdrawals"); len(records) != tt.wantRecords {
+				t.Errorf("got %d withdrawal records, want %d", len(records), tt.wantRecords)
+			}
+		})
+	}
+}
+
+func TestUserRepository_RegisterOrderExisting(t *testing.T) {
+	tests := []struct {
+		name    string
+		ownerID string
+		status  string
+		wantErr error
+	}{
+		{name: "uploaded by the user", ownerID: "user-1", status: domain.OrderStatusNew,
+			wantErr: ErrOrderAlreadyExistsSameUser},
+		{name: "uploaded by another user", ownerID: "user-2", status: domain.OrderStatusNew,
+			wantErr: ErrOrderAlreadyExistsDifferentUser},
+		{name: "cancelled by the user", ownerID: "user-1", status: domain.OrderStatusCancelled,
+			wantErr: ErrOrderCancelled},
+		{name: "cancelled by another user", ownerID: "user-2", status: domain.OrderStatusCancelled,
+			wantErr: ErrOrderAlreadyExistsDifferentUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fdb := newFakeDB(t, fakeResult{
+				match:   "FROM orders",
+				columns: []string{"order_number", "user_id", "order_status"},
+				rows:    [][]driver.Value{{"12345678903", tt.ownerID, tt.status}},
+			})
+
+			repo, _ := NewUserRepository(db)
+
+			_, err := repo.RegisterOrder(context.Background(), domain.Order{
+				OrderNumber: "12345678903",
+				UserID:      "user-1",
+				OrderStatus: domain.OrderStatusNew,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RegisterOrder() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// cancelling is final, the number is never uploaded again
+			if inserts := fdb.ran("INSERT INTO orders"); len(inserts) != 0 {
+				t.Errorf("the order was inserted again: %+v", inserts)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres/queries"
+)
+
+const webhookDeliveriesLogLimit = 50
+
+type webhookRepository struct {
+	db *sqlx.DB
+}
+
+func NewWebhookRepository(db *sqlx.DB) (*webhookRepository, error) {
+	return &webhookRepository{
+		db: db,
+	}, nil
+}
+
+func (wr *webhookRepository) CreateWebhook(ctx context.Context, webhook domain.Webhook) (domain.Webhook, error) {
+	err := wr.db.QueryRowContext(ctx, queries.InsertWebhook,
+		webhook.UserID,
+		webhook.URL,
+		webhook.Secret,
+		pq.Array(webhook.Events),
+	).Scan(
+		&webhook.ID,
+		&webhook.IsActive,
+		&webhook.ConsecutiveFailures,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+
+	if err != nil {
+		return domain.Webhook{}, fmt.Errorf("error inserting webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+func (wr *webhookRepository) GetWebhooks(ctx context.Context, userID string) ([]domain.Webhook, error) {
+	rows, err := wr.db.QueryContext(ctx, queries.GetUserWebhooks, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	webhooks := []domain.Webhook{}
+	for rows.Next() {
+		var webhook domain.Webhook
+
+		err := rows.Scan(
+			&webhook.ID,
+			&webhook.UserID,
+			&webhook.URL,
+			pq.Array(&webhook.Events),
+			&webhook.IsActive,
+			&webhook.ConsecutiveFailures,
+			&webhook.DisabledAt,
+			&webhook.CreatedAt,
+			&webhook.UpdatedAt,
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook row: %w", err)
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after reading rows: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+func (wr *webhookRepository) DeleteWebhook(ctx context.Context, userID, webhookID string) error {
+	res, err := wr.db.ExecContext(ctx, queries.DeleteUserWebhook, webhookID, userID)
+	if err != nil {
+		return err
+	}
+
+	ar, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if ar == 0 {
+		return ErrNoRowsFound
+	}
+
+	return nil
+}
+
+func (wr *webhookRepository) GetWebhookDeliveries(ctx context.Context,
+	userID, webhookID string) ([]domain.WebhookDelivery, error) {
+	var exists bool
+	if err := wr.db.QueryRowContext(ctx, queries.UserWebhookExists, webhookID, userID).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, ErrNoRowsFound
+	}
+
+	rows, err := wr.db.QueryContext(ctx, queries.GetWebhookDeliveries, webhookID, webhookDeliveriesLogLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	deliveries := []domain.WebhookDelivery{}
+	positions := make(map[string]int)
+	ids := []string{}
+	for rows.Next() {
+		delivery := domain.WebhookDelivery{Log: []domain.WebhookDeliveryAttempt{}}
+
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.EventType,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.DeliveredAt,
+			&delivery.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery row: %w", err)
+		}
+
+		positions[delivery.ID] = len(deliveries)
+		ids = append(ids, delivery.ID)
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after reading rows: %w", err)
+	}
+
+	if len(ids) == 0 {
+		return deliveries, nil
+	}
+
+	attempts, err := wr.db.QueryContext(ctx, queries.GetWebhookDeliveryAttempts, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	defer attempts.Close()
+
+	for attempts.Next() {
+		var attempt domain.WebhookDeliveryAttempt
+
+		err := attempts.Scan(
+			&attempt.ID,
+			&attempt.DeliveryID,
+			&attempt.ResponseStatus,
+			&attempt.Error,
+			&attempt.DurationMS,
+			&attempt.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery attempt row: %w", err)
+		}
+
+		i := positions[attempt.DeliveryID]
+		deliveries[i].Log = append(deliveries[i].Log, attempt)
+	}
+
+	if err := attempts.Err(); err != nil {
+		return nil, fmt.Errorf("error after reading rows: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// enqueueWebhookDeliveries queues the event for the user webhooks subscribed to it
+// in the transaction of the change it is about, so that the event is stored if
+// and only if the change is.
+func enqueueWebhookDeliveries(ctx context.Context, tx *sql.Tx, userID, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, queries.InsertWebhookDeliveries, userID, eventType, payload)
+	if err != nil {
+		return fmt.Errorf("error queueing webhook deliveries: %w", err)
+	}
+
+	return nil
+}
+
+func (wr *webhookRepository) LeasePendingWebhookDeliveries(ctx context.Context,
+	limit int, lease time.Duration) ([]domain.WebhookDelivery, error) {
+	rows, err := wr.db.QueryContext(ctx, queries.LeasePendingWebhookDeliveries,
+		limit, lease.Milliseconds(), domain.WebhookDeliveryStatusPending)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var deliveries []domain.WebhookDelivery
+	for rows.Next() {
+		var delivery domain.WebhookDelivery
+
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.EventType,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.CreatedAt,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery row: %w", err)
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after reading rows: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+func (wr *webhookRepository) RecordWebhookDeliveryAttempt(ctx context.Context,
+	delivery domain.WebhookDelivery,
+	attempt domain.WebhookDeliveryAttempt,
+	disableAfter int) (bool, error) {
+	tx, err := wr.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, queries.InsertWebhookDeliveryAttempt,
+		delivery.ID, attempt.ResponseStatus, attempt.Error, attempt.DurationMS)
+	if err != nil {
+		return false, fmt.Errorf("error inserting webhook delivery attempt: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, queries.UpdateWebhookDelivery,
+		delivery.ID, delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.DeliveredAt)
+	if err != nil {
+		return false, fmt.Errorf("error updating webhook delivery: %w", err)
+	}
+
+	disabled := false
+	if attempt.Error == nil {
+		_, err = tx.ExecContext(ctx, queries.ResetWebhookFailures, delivery.WebhookID)
+		if err != nil {
+			return false, fmt.Errorf("error resetting webhook failures: %w", err)
+		}
+	} else {
+		var active bool
+		err = tx.QueryRowContext(ctx, queries.IncrementWebhookFailures, delivery.WebhookID, disableAfter).Scan(&active)
+		if err != nil {
+			return false, fmt.Errorf("error counting webhook failure: %w", err)
+		}
+
+		if !active {
+			disabled = true
+			_, err = tx.ExecContext(ctx, queries.FailWebhookDeliveries, delivery.WebhookID,
+				domain.WebhookDeliveryStatusFailed, domain.WebhookDeliveryStatusPending)
+			if err != nil {
+				return false, fmt.Errorf("error failing pending webhook deliveries: %w", err)
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return disabled, nil
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"embed"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/mihailtudos/gophermart/internal/config"
@@ -27,28 +28,123 @@ type BalanceHandler interface {
 type OrdersHandler interface {
 	RegisterOrder(ctx context.Context, order domain.Order) (domain.Order, error)
 	GetUserOrders(ctx context.Context, userID string) ([]domain.UserOrder, error)
-	GetUnfinishedOrders(ctx context.Context) ([]domain.Order, error)
-	UpdateOrder(ctx context.Context, updatedOrder domain.Order) error
+	GetUserOrder(ctx context.Context, userID, orderNumber string) (domain.UserOrderDetails, error)
+	GetUnfinishedOrders(ctx context.Context, lease time.Duration) ([]domain.Order, error)
+	ReleaseOrderLease(ctx context.Context, orderNumber string) error
+	CancelOrder(ctx context.Context, userID, orderNumber string) (domain.OrderStatusChange, error)
+	UpdateOrder(ctx context.Context, updatedOrder domain.Order) (domain.OrderStatusChange, error)
+	GetUserOrderStatusChanges(ctx context.Context, userID, sinceID string) ([]domain.OrderStatusChange, error)
 }
 
 type UserRepo interface {
 	Create(ctx context.Context, user domain.User) (string, error)
 	GetUserByLogin(ctx context.Context, login string) (domain.User, error)
 	GetUserByID(ctx context.Context, id string) (domain.User, error)
-	SetSessionToken(ctx context.Context, st domain.Session) error
+	UpdatePassword(ctx context.Context, user domain.User) (int, error)
+	RehashPassword(ctx context.Context, userID string, oldHash, newHash []byte) error
+	SetSessionToken(ctx context.Context, st domain.Session) (string, []string, error)
+	GetSessionByToken(ctx context.Context, tokenHash string) (domain.Session, error)
+	RotateSessionToken(ctx context.Context, oldTokenHash string, st domain.Session) error
+	GetUserSessions(ctx context.Context, userID string) ([]domain.UserSession, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	RevokeAllSessions(ctx context.Context, userID string) error
 	UserBalance
 	BalanceHandler
 	OrdersHandler
 }
 
+type AdminRepo interface {
+	SearchUsers(ctx context.Context, filter domain.UserFilter) ([]domain.User, error)
+	SetUserSuspended(ctx context.Context, userID string, suspended bool) error
+	SetUserRole(ctx context.Context, userID, role string) error
+	AdjustBalance(ctx context.Context, adj domain.BalanceAdjustment) (domain.BalanceAdjustment, error)
+	GetBalanceAdjustments(ctx context.Context, userID string) ([]domain.BalanceAdjustment, error)
+}
+
 type OrderRepo interface {
 	Create(ctx context.Context, number string) (int, error)
 }
 
+type WebhookRepo interface {
+	CreateWebhook(ctx context.Context, webhook domain.Webhook) (domain.Webhook, error)
+	GetWebhooks(ctx context.Context, userID string) ([]domain.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID, webhookID string) error
+	GetWebhookDeliveries(ctx context.Context, userID, webhookID string) ([]domain.WebhookDelivery, error)
+	LeasePendingWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]domain.WebhookDelivery, error)
+	RecordWebhookDeliveryAttempt(ctx context.Context,
+		delivery domain.WebhookDelivery,
+		attempt domain.WebhookDeliveryAttempt,
+		disableAfter int) (bool, error)
+}
+
+type RevocationRepo interface {
+	RevokeTokens(ctx context.Context, revocation domain.TokenRevocation) error
+	GetTokenRevocations(ctx context.Context) ([]domain.TokenRevocation, error)
+	DeleteExpiredTokenRevocations(ctx context.Context) error
+}
+
+type LoginAttemptsRepo interface {
+	GetLoginAttempts(ctx context.Context, key string) (domain.LoginAttempts, error)
+	RecordLoginFailure(ctx context.Context, key string, failedAt, windowStart time.Time) (domain.LoginAttempts, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+	DeleteStaleLoginAttempts(ctx context.Context, loginPrefix, ipPrefix string, before time.Time) error
+}
+
+type PasswordResetRepo interface {
+	CreatePasswordResetToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error
+	ResetPassword(ctx context.Context, tokenHash string, passwordHash []byte, now time.Time) (string, error)
+}
+
+type TwoFactorRepo interface {
+	GetTwoFactor(ctx context.Context, userID string) (domain.TwoFactor, error)
+	SetPendingTOTPSecret(ctx context.Context, userID, secret string) error
+	EnableTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) error
+	DisableTOTP(ctx context.Context, userID string) error
+	UseTOTPStep(ctx context.Context, userID string, step int64) error
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) error
+	UseChallenge(ctx context.Context, challengeID string, expiresAt time.Time) error
+}
+
+type APIKeyRepo interface {
+	CreateAPIKey(ctx context.Context, key domain.APIKey) (domain.APIKey, error)
+	GetAPIKeys(ctx context.Context, userID string) ([]domain.APIKey, error)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (domain.APIKey, error)
+	DeleteAPIKey(ctx context.Context, userID, keyID string) error
+	TouchAPIKey(ctx context.Context, keyID string) error
+}
+
+type AccountRepo interface {
+	UpdateProfile(ctx context.Context, user domain.User) (domain.User, error)
+	DeleteAccount(ctx context.Context, userID string, version int) error
+	GetBalanceAdjustments(ctx context.Context, userID string) ([]domain.BalanceAdjustment, error)
+}
+
+type EmailVerificationRepo interface {
+	VerifyEmail(ctx context.Context, userID, email string) error
+}
+
+type OIDCRepo interface {
+	CreateOIDCState(ctx context.Context, state domain.OIDCState) error
+	ConsumeOIDCState(ctx context.Context, stateHash string) (domain.OIDCState, error)
+	GetUserIdentity(ctx context.Context, issuer, subject string) (domain.UserIdentity, error)
+	CreateUserIdentity(ctx context.Context, identity domain.UserIdentity) (domain.UserIdentity, error)
+}
+
 type Repositories struct {
 	DB *sqlx.DB
 	UserRepo
 	OrderRepo
+	WebhookRepo
+	RevocationRepo
+	LoginAttemptsRepo
+	PasswordResetRepo
+	TwoFactorRepo
+	APIKeyRepo
+	AdminRepo
+	AccountRepo
+	EmailVerificationRepo
+	OIDCRepo
 }
 
 func NewRepository(ctx context.Context, dbConfig config.DBConfig) (*Repositories, error) {
@@ -71,10 +167,55 @@ func NewRepository(ctx context.Context, dbConfig config.DBConfig) (*Repositories
 		return nil, err
 	}
 
+	webhookRepo, err := postgres.NewWebhookRepository(db)
+	if err != nil {
+		return nil, err
+	}
+
+	revocationRepo, err := postgres.NewRevocationRepository(db)
+	if err != nil {
+		return nil, err
+	}
+
+	loginAttemptsRepo, err := postgres.NewLoginAttemptsRepository(db)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordResetRepo, err := postgres.NewPasswordResetRepository(db)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactorRepo, err := postgres.NewTwoFactorRepository(db)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeyRepo, err := postgres.NewAPIKeyRepository(db)
+	if err != nil {
+		return nil, err
+	}
+
+	oidcRepo, err := postgres.NewOIDCRepository(db)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Repositories{
-		UserRepo:  userRepo,
-		OrderRepo: orderRepo,
-		DB:        db,
+		UserRepo:              userRepo,
+		OrderRepo:             orderRepo,
+		WebhookRepo:           webhookRepo,
+		RevocationRepo:        revocationRepo,
+		LoginAttemptsRepo:     loginAttemptsRepo,
+		PasswordResetRepo:     passwordResetRepo,
+		TwoFactorRepo:         twoFactorRepo,
+		APIKeyRepo:            apiKeyRepo,
+		AdminRepo:             userRepo,
+		AccountRepo:           userRepo,
+		EmailVerificationRepo: userRepo,
+		OIDCRepo:              oidcRepo,
+		DB:                    db,
 	}, nil
 }
 
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/repository"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+)
+
+type AccountUsers interface {
+	Login(ctx context.Context, input domain.UserAuthInput, client domain.SessionClient) (domain.User, error)
+	GetUserByID(ctx context.Context, userID string) (domain.User, error)
+	GetUserBalance(ctx context.Context, userID string) (domain.UserBalance, error)
+	GetUserOrders(ctx context.Context, userID string) ([]domain.UserOrder, error)
+	GetUserOrder(ctx context.Context, userID, orderNumber string) (domain.UserOrderDetails, error)
+	GetWithdrawals(ctx context.Context, userID string) ([]domain.Withdrawal, error)
+	GetUserSessions(ctx context.Context, userID string) ([]domain.UserSession, error)
+	RevokeAllSessions(ctx context.Context, userID string) error
+}
+
+// EmailVerifier confirms the emails users attach to their profile.
+type EmailVerifier interface {
+	SendVerificationLink(ctx context.Context, user domain.User)
+}
+
+// AccountService implements the self-service profile, data export and account deletion.
+type AccountService struct {
+	repo   repository.AccountRepo
+	users  AccountUsers
+	emails EmailVerifier
+}
+
+func NewAccountService(repo repository.AccountRepo,
+	users AccountUsers,
+	emails EmailVerifier) (*AccountService, error) {
+	return &AccountService{
+		repo:   repo,
+		users:  users,
+		emails: emails,
+	}, nil
+}
+
+func (as *AccountService) GetProfile(ctx context.Context, userID string) (domain.User, error) {
+	return as.users.GetUserByID(ctx, userID)
+}
+
+// UpdateProfile applies the partial update on top of the version of the user the
+// client has read, it fails with ErrEditConflict when that is not the current one.
+// With AnyProfileVersion the update applies to the current version. A new email is
+// sent a verification link.
+func (as *AccountService) UpdateProfile(ctx context.Context,
+	userID string,
+	version int,
+	input domain.UserProfileInput) (domain.User, error) {
+	user, err := as.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	// the update is guarded by the version again, this only spares the query
+	if version != domain.AnyProfileVersion && user.Version != version {
+		return domain.User{}, postgres.ErrEditConflict
+	}
+
+	previousEmail := user.Email
+	user.UserProfile.Apply(input)
+
+	updated, err := as.repo.UpdateProfile(ctx, user)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	if updated.Email != "" && updated.Email != previousEmail {
+		as.emails.SendVerificationLink(ctx, updated)
+	}
+
+	return updated, nil
+}
+
+// ExportUserData collects the personal data held about the user.
+func (as *AccountService) ExportUserData(ctx context.Context, userID string) (domain.UserExport, error) {
+	user, err := as.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return domain.UserExport{}, err
+	}
+
+	balance, err := as.users.GetUserBalance(ctx, userID)
+	if err != nil {
+		return domain.UserExport{}, err
+	}
+
+	orders, err := as.users.GetUserOrders(ctx, userID)
+	if err != nil {
+		return domain.UserExport{}, err
+	}
+
+	// the details carry the status history with the accruals of each order
+	details := make([]domain.UserOrderDetails, 0, len(orders))
+	for _, order := range orders {
+		d, err := as.users.GetUserOrder(ctx, userID, order.Number)
+		if err != nil {
+			return domain.UserExport{}, fmt.Errorf("failed to get order %s: %w", order.Number, err)
+		}
+
+		details = append(details, d)
+	}
+
+	withdrawals, err := as.users.GetWithdrawals(ctx, userID)
+	if err != nil {
+		return domain.UserExport{}, err
+	}
+
+	adjustments, err := as.repo.GetBalanceAdjustments(ctx, userID)
+	if err != nil {
+		return domain.UserExport{}, err
+	}
+
+	sessions, err := as.users.GetUserSessions(ctx, userID)
+	if err != nil {
+		return domain.UserExport{}, err
+	}
+
+	if withdrawals == nil {
+		withdrawals = []domain.Withdrawal{}
+	}
+
+	if sessions == nil {
+		sessions = []domain.UserSession{}
+	}
+
+	return domain.UserExport{
+		ExportedAt:  time.Now().UTC(),
+		Profile:     user,
+		Balance:     balance,
+		Orders:      details,
+		Withdrawals: withdrawals,
+		Adjustments: adjustments,
+		Sessions:    sessions,
+	}, nil
+}
+
+// DeleteAccount re-authenticates the user with the password, then anonymises the
+// account and ends all of its sessions. The financial records are retained.
+func (as *AccountService) DeleteAccount(ctx context.Context,
+	userID string,
+	input domain.DeleteAccountInput,
+	client domain.SessionClient) error {
+	user, err := as.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// the sign-in checks the password with the brute-force protection
+	_, err = as.users.Login(ctx, domain.UserAuthInput{Login: user.Login, Password: input.Password}, client)
+	if err != nil {
+		return err
+	}
+
+	if err := as.repo.DeleteAccount(ctx, userID, user.Version); err != nil {
+		return err
+	}
+
+	logger.Log.InfoContext(ctx, "account deleted", slog.String("user_id", userID))
+
+	if err := as.users.RevokeAllSessions(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return nil
+}
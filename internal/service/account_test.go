@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+)
+
+type fakeAccountRepo struct {
+	deletedVersion int
+	updated        *domain.User
+}
+
+func (f *fakeAccountRepo) UpdateProfile(_ context.Context, user domain.User) (domain.User, error) {
+	f.updated = &user
+	user.Version++
+	return user, nil
+}
+
+func (f *fakeAccountRepo) DeleteAccount(_ context.Context, _ string, version int) error {
+	f.deletedVersion = version
+	return nil
+}
+
+func (f *fakeAccountRepo) GetBalanceAdjustments(_ context.Context, _ string) ([]domain.BalanceAdjustment, error) {
+	return []domain.BalanceAdjustment{}, nil
+}
+
+type fakeAccountUsers struct {
+	revoked bool
+}
+
+func (f *fakeAccountUsers) Login(_ context.Context,
+	input domain.UserAuthInput,
+	_ domain.SessionClient) (domain.User, error) {
+	if input.Login != "alice" || input.Password != "secret-password" {
+		return domain.User{}, auth.ErrInvalidCredentials
+	}
+
+	return domain.User{ID: "user-1", Login: "alice"}, nil
+}
+
+func (f *fakeAccountUsers) GetUserByID(_ context.Context, userID string) (domain.User, error) {
+	return domain.User{ID: userID, Login: "alice", Version: 3, UserProfile: domain.UserProfile{
+		DisplayName: "Alice",
+		Locale:      "en",
+		Timezone:    "UTC",
+	}}, nil
+}
+
+func (f *fakeAccountUsers) GetUserBalance(_ context.Context, _ string) (domain.UserBalance, error) {
+	return domain.UserBalance{Current: 10}, nil
+}
+
+func (f *fakeAccountUsers) GetUserOrders(_ context.Context, _ string) ([]domain.UserOrder, error) {
+	return []domain.UserOrder{{Number: "12345678903"}, {Number: "9278923470"}}, nil
+}
+
+func (f *fakeAccountUsers) GetUserOrder(_ context.Context,
+	_, orderNumber string) (domain.UserOrderDetails, error) {
+	return domain.UserOrderDetails{
+		UserOrder: domain.UserOrder{Number: orderNumber},
+		History:   []domain.OrderStatusChange{{OrderNumber: orderNumber, NewStatus: domain.OrderStatusNew}},
+	}, nil
+}
+
+func (f *fakeAccountUsers) GetWithdrawals(_ context.Context, _ string) ([]domain.Withdrawal, error) {
+	return nil, nil
+}
+
+func (f *fakeAccountUsers) GetUserSessions(_ context.Context, _ string) ([]domain.UserSession, error) {
+	return nil, nil
+}
+
+func (f *fakeAccountUsers) RevokeAllSessions(_ context.Context, _ string) error {
+	f.revoked = true
+	return nil
+}
+
+type fakeEmailVerifier struct {
+	sentTo []string
+}
+
+func (f *fakeEmailVerifier) SendVerificationLink(_ context.Context, user domain.User) {
+	f.sentTo = append(f.sentTo, user.Email)
+}
+
+func TestAccountService_ExportUserData(t *testing.T) {
+	as, _ := NewAccountService(&fakeAccountRepo{}, &fakeAccountUsers{}, &fakeEmailVerifier{})
+
+	export, err := as.ExportUserData(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("ExportUserData() error = %v", err)
+	}
+
+	if export.Profile.ID != "user-1" || export.Balance.Current != 10 {
+		t.Errorf("unexpected profile or balance %+v, %+v", export.Profile, export.Balance)
+	}
+
+	if len(export.Orders) != 2 || len(export.Orders[1].History) != 1 {
+		t.Errorf("orders = %+v, want both orders with their history", export.Orders)
+	}
+
+	if export.Withdrawals == nil || export.Sessions == nil {
+		t.Error("empty lists must be exported as [] rather than null")
+	}
+}
+
+func TestAccountService_DeleteAccount(t *testing.T) {
+	logger.Init(io.Discard, "error")
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  error
+	}{
+		{name: "correct password", password: "secret-password"},
+		{name: "wrong password", password: "guess", wantErr: auth.ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAccountRepo{}
+			users := &fakeAccountUsers{}
+			as, _ := NewAccountService(repo, users, &fakeEmailVerifier{})
+
+			err := as.DeleteAccount(context.Background(), "user-1",
+				domain.DeleteAccountInput{Password: tt.password}, domain.SessionClient{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DeleteAccount() error = %v, want %v", err, tt.wantErr)
+			}
+
+			deleted := tt.wantErr == nil
+			if (repo.deletedVersion == 3) != deleted || users.revoked != deleted {
+				t.Errorf("deleted with version %d, sessions revoked %v, want deleted %v",
+					repo.deletedVersion, users.revoked, deleted)
+			}
+		})
+	}
+}
+
+func TestAccountService_UpdateProfile(t *testing.T) {
+	locale := "ro-RO"
+	email := "alice@example.com"
+
+	tests := []struct {
+		name     string
+		version  int
+		input    domain.UserProfileInput
+		wantErr  error
+		wantSent bool
+	}{
+		{name: "current version", version: 3, input: domain.UserProfileInput{Locale: &locale}},
+		{name: "any version", version: domain.AnyProfileVersion, input: domain.UserProfileInput{Locale: &locale}},
+		{name: "stale version", version: 2, input: domain.UserProfileInput{Locale: &locale},
+			wantErr: postgres.ErrEditConflict},
+		{name: "new email is verified", version: 3, input: domain.UserProfileInput{Email: &email},
+			wantSent: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAccountRepo{}
+			emails := &fakeEmailVerifier{}
+			as, _ := NewAccountService(repo, &fakeAccountUsers{}, emails)
+
+			user, err := as.UpdateProfile(context.Background(), "user-1", tt.version, tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateProfile() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if (len(emails.sentTo) == 1) != tt.wantSent {
+				t.Errorf("verification links sent to %v, want sent %v", emails.sentTo, tt.wantSent)
+			}
+
+			if tt.wantErr != nil {
+				if repo.updated != nil {
+					t.Error("a stale version must not be written")
+				}
+				return
+			}
+
+			// the fields left out of the update are kept
+			if user.DisplayName != "Alice" || user.Timezone != "UTC" || user.Version != 4 {
+				t.Errorf("updated user = %+v", user)
+			}
+		})
+	}
+}
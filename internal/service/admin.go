@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/repository"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+)
+
+type AdminUsers interface {
+	GetUserByID(ctx context.Context, userID string) (domain.User, error)
+	GetUserBalance(ctx context.Context, userID string) (domain.UserBalance, error)
+	GetUserOrders(ctx context.Context, userID string) ([]domain.UserOrder, error)
+	GetWithdrawals(ctx context.Context, userID string) ([]domain.Withdrawal, error)
+	RevokeAllSessions(ctx context.Context, userID string) error
+}
+
+// AdminService backs the support and admin API, every change made through it is
+// logged together with the acting user.
+type AdminService struct {
+	repo   repository.AdminRepo
+	users  AdminUsers
+	events EventBroker
+}
+
+func NewAdminService(repo repository.AdminRepo, users AdminUsers, events EventBroker) (*AdminService, error) {
+	return &AdminService{
+		repo:   repo,
+		users:  users,
+		events: events,
+	}, nil
+}
+
+func (as *AdminService) SearchUsers(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
+	return as.repo.SearchUsers(ctx, filter)
+}
+
+func (as *AdminService) GetUserDetails(ctx context.Context, userID string) (domain.UserDetails, error) {
+	user, err := as.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return domain.UserDetails{}, err
+	}
+
+	balance, err := as.users.GetUserBalance(ctx, userID)
+	if err != nil {
+		return domain.UserDetails{}, err
+	}
+
+	orders, err := as.users.GetUserOrders(ctx, userID)
+	if err != nil {
+		return domain.UserDetails{}, err
+	}
+
+	withdrawals, err := as.users.GetWithdrawals(ctx, userID)
+	if err != nil {
+		return domain.UserDetails{}, err
+	}
+
+	if orders == nil {
+		orders = []domain.UserOrder{}
+	}
+
+	if withdrawals == nil {
+		withdrawals = []domain.Withdrawal{}
+	}
+
+	return domain.UserDetails{
+		User:        user,
+		Balance:     balance,
+		Orders:      orders,
+		Withdrawals: withdrawals,
+	}, nil
+}
+
+// SuspendUser blocks the account and ends all of its sessions.
+func (as *AdminService) SuspendUser(ctx context.Context, actorID, userID string) error {
+	if actorID == userID {
+		return auth.ErrSelfAction
+	}
+
+	if err := as.repo.SetUserSuspended(ctx, userID, true); err != nil {
+		return err
+	}
+
+	as.audit(ctx, "user suspended", actorID, userID)
+
+	return as.users.RevokeAllSessions(ctx, userID)
+}
+
+func (as *AdminService) UnsuspendUser(ctx context.Context, actorID, userID string) error {
+	if err := as.repo.SetUserSuspended(ctx, userID, false); err != nil {
+		return err
+	}
+
+	as.audit(ctx, "user unsuspended", actorID, userID)
+
+	return nil
+}
+
+// ForceLogout ends all the sessions of the user and revokes the access tokens issued so far.
+func (as *AdminService) ForceLogout(ctx context.Context, actorID, userID string) error {
+	if _, err := as.users.GetUserByID(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := as.users.RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	as.audit(ctx, "user logged out", actorID, userID)
+
+	return nil
+}
+
+// SetUserRole grants the role, admins can not change their own role so that the
+// last admin can not lock everyone out by accident.
+func (as *AdminService) SetUserRole(ctx context.Context, actorID, userID, role string) error {
+	if actorID == userID {
+		return auth.ErrSelfAction
+	}
+
+	if err := as.repo.SetUserRole(ctx, userID, role); err != nil {
+		return err
+	}
+
+	as.audit(ctx, "user role changed", actorID, userID, slog.String("role", role))
+
+	return nil
+}
+
+// AdjustBalance credits or debits the user balance. Only admins may force an
+// adjustment that leaves the balance negative, and no one may adjust their own balance.
+func (as *AdminService) AdjustBalance(ctx context.Context,
+	actor domain.User,
+	adj domain.BalanceAdjustment) (domain.BalanceAdjustment, error) {
+	if actor.ID == adj.UserID {
+		return domain.BalanceAdjustment{}, auth.ErrSelfAction
+	}
+
+	if adj.Forced && actor.Role != domain.RoleAdmin {
+		return domain.BalanceAdjustment{}, auth.ErrInsufficientRole
+	}
+
+	adj.ActorID = actor.ID
+
+	adj, err := as.repo.AdjustBalance(ctx, adj)
+	if err != nil {
+		return domain.BalanceAdjustment{}, err
+	}
+
+	as.audit(ctx, "balance adjusted", actor.ID, adj.UserID,
+		slog.String("adjustment_id", adj.ID),
+		slog.Float64("amount", adj.Amount),
+		slog.String("reason_code", adj.ReasonCode),
+		slog.Bool("forced", adj.Forced))
+
+	as.publishBalance(ctx, adj.UserID)
+
+	return adj, nil
+}
+
+func (as *AdminService) GetBalanceAdjustments(ctx context.Context, userID string) ([]domain.BalanceAdjustment, error) {
+	if _, err := as.users.GetUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return as.repo.GetBalanceAdjustments(ctx, userID)
+}
+
+func (as *AdminService) publishBalance(ctx context.Context, userID string) {
+	balance, err := as.users.GetUserBalance(ctx, userID)
+	if err != nil {
+		logger.Log.ErrorContext(ctx, "failed to get balance for the balance event",
+			slog.String("userID", userID),
+			slog.String("err", err.Error()))
+		return
+	}
+
+	as.events.Publish(ctx, userID, domain.Event{
+		Type: domain.EventBalanceUpdated,
+		Data: balance,
+	})
+}
+
+func (as *AdminService) audit(ctx context.Context, msg, actorID, userID string, attrs ...any) {
+	logger.Log.InfoContext(ctx, "admin: "+msg,
+		append([]any{slog.String("actor_id", actorID), slog.String("user_id", userID)}, attrs...)...)
+}
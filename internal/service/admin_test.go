@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+)
+
+type fakeAdminRepo struct {
+	balance     float64
+	adjustments []domain.BalanceAdjustment
+}
+
+func (f *fakeAdminRepo) SearchUsers(_ context.Context, _ domain.UserFilter) ([]domain.User, error) {
+	return nil, nil
+}
+
+func (f *fakeAdminRepo) SetUserSuspended(_ context.Context, _ string, _ bool) error {
+	return nil
+}
+
+func (f *fakeAdminRepo) SetUserRole(_ context.Context, _, _ string) error {
+	return nil
+}
+
+func (f *fakeAdminRepo) AdjustBalance(_ context.Context,
+	adj domain.BalanceAdjustment) (domain.BalanceAdjustment, error) {
+	adj.BalanceBefore = f.balance
+	adj.BalanceAfter = f.balance + adj.Amount
+
+	if adj.BalanceAfter < 0 && !adj.Forced {
+		return domain.BalanceAdjustment{}, postgres.ErrInsufficientPoints
+	}
+
+	f.balance = adj.BalanceAfter
+	f.adjustments = append(f.adjustments, adj)
+
+	return adj, nil
+}
+
+func (f *fakeAdminRepo) GetBalanceAdjustments(_ context.Context, _ string) ([]domain.BalanceAdjustment, error) {
+	return f.adjustments, nil
+}
+
+type fakeAdminUsers struct {
+	repo *fakeAdminRepo
+}
+
+func (f fakeAdminUsers) GetUserByID(_ context.Context, userID string) (domain.User, error) {
+	return domain.User{ID: userID}, nil
+}
+
+func (f fakeAdminUsers) GetUserBalance(_ context.Context, userID string) (domain.UserBalance, error) {
+	return domain.UserBalance{UserID: userID, Current: f.repo.balance}, nil
+}
+
+func (f fakeAdminUsers) GetUserOrders(_ context.Context, _ string) ([]domain.UserOrder, error) {
+	return nil, nil
+}
+
+func (f fakeAdminUsers) GetWithdrawals(_ context.Context, _ string) ([]domain.Withdrawal, error) {
+	return nil, nil
+}
+
+func (f fakeAdminUsers) RevokeAllSessions(_ context.Context, _ string) error {
+	return nil
+}
+
+type fakeEventBroker struct {
+	published []domain.Event
+}
+
+func (f *fakeEventBroker) Publish(_ context.Context, _ string, event domain.Event) {
+	f.published = append(f.published, event)
+}
+
+func (f *fakeEventBroker) Subscribe(_ string) (<-chan domain.Event, func()) {
+	return nil, func() {}
+}
+
+func TestAdminService_AdjustBalance(t *testing.T) {
+	logger.Init(io.Discard, "error")
+
+	support := domain.User{ID: "support-1", Role: domain.RoleSupport}
+	admin := domain.User{ID: "admin-1", Role: domain.RoleAdmin}
+
+	tests := []struct {
+		name        string
+		actor       domain.User
+		adj         domain.BalanceAdjustment
+		wantErr     error
+		wantBalance float64
+	}{
+		{
+			name:        "credit",
+			actor:       support,
+			adj:         domain.BalanceAdjustment{UserID: "user-1", Amount: 25},
+			wantBalance: 125,
+		},
+		{
+			name:        "debit",
+			actor:       support,
+			adj:         domain.BalanceAdjustment{UserID: "user-1", Amount: -100},
+			wantBalance: 0,
+		},
+		{
+			name:        "debit below zero",
+			actor:       admin,
+			adj:         domain.BalanceAdjustment{UserID: "user-1", Amount: -150},
+			wantErr:     postgres.ErrInsufficientPoints,
+			wantBalance: 100,
+		},
+		{
+			name:        "forced by admin",
+			actor:       admin,
+			adj:         domain.BalanceAdjustment{UserID: "user-1", Amount: -150, Forced: true},
+			wantBalance: -50,
+		},
+		{
+			name:        "forced by support",
+			actor:       support,
+			adj:         domain.BalanceAdjustment{UserID: "user-1", Amount: -150, Forced: true},
+			wantErr:     auth.ErrInsufficientRole,
+			wantBalance: 100,
+		},
+		{
+			name:        "own balance",
+			actor:       admin,
+			adj:         domain.BalanceAdjustment{UserID: admin.ID, Amount: 10},
+			wantErr:     auth.ErrSelfAction,
+			wantBalance: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAdminRepo{balance: 100}
+			events := &fakeEventBroker{}
+			as, _ := NewAdminService(repo, fakeAdminUsers{repo: repo}, events)
+
+			adj, err := as.AdjustBalance(context.Background(), tt.actor, tt.adj)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AdjustBalance() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if repo.balance != tt.wantBalance {
+				t.Errorf("balance = %v, want %v", repo.balance, tt.wantBalance)
+			}
+
+			if tt.wantErr != nil {
+				if len(events.published) != 0 {
+					t.Errorf("published %d events for a failed adjustment", len(events.published))
+				}
+				return
+			}
+
+			if adj.ActorID != tt.actor.ID {
+				t.Errorf("ActorID = %q, want %q", adj.ActorID, tt.actor.ID)
+			}
+
+			if len(events.published) != 1 || events.published[0].Type != domain.EventBalanceUpdated {
+				t.Errorf("published %+v, want a single balance event", events.published)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/repository"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+)
+
+const (
+	// keys look like gm_<prefix>_<secret>, the prefix is stored in clear for the lookup
+	apiKeyTag         = "gm_"
+	apiKeyPrefixBytes = 6
+	apiKeySecretBytes = 32
+)
+
+type APIKeyService struct {
+	repo         repository.APIKeyRepo
+	tokenManager TokenManager
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepo, tm TokenManager) (*APIKeyService, error) {
+	return &APIKeyService{
+		repo:         repo,
+		tokenManager: tm,
+	}, nil
+}
+
+// CreateAPIKey generates the key and stores its hash, the returned key is the
+// only time the caller gets to see it.
+func (ks *APIKeyService) CreateAPIKey(ctx context.Context, key domain.APIKey) (domain.APIKey, error) {
+	prefix := make([]byte, apiKeyPrefixBytes)
+	if _, err := rand.Read(prefix); err != nil {
+		return domain.APIKey{}, err
+	}
+
+	secret := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return domain.APIKey{}, err
+	}
+
+	key.Prefix = hex.EncodeToString(prefix)
+	plaintext := apiKeyTag + key.Prefix + "_" + hex.EncodeToString(secret)
+
+	keyHash, err := ks.tokenManager.HashToken(plaintext)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	key.KeyHash = keyHash
+
+	key, err = ks.repo.CreateAPIKey(ctx, key)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+
+	key.Key = plaintext
+
+	return key, nil
+}
+
+func (ks *APIKeyService) GetAPIKeys(ctx context.Context, userID string) ([]domain.APIKey, error) {
+	return ks.repo.GetAPIKeys(ctx, userID)
+}
+
+func (ks *APIKeyService) DeleteAPIKey(ctx context.Context, userID, keyID string) error {
+	return ks.repo.DeleteAPIKey(ctx, userID, keyID)
+}
+
+// VerifyAPIKey returns the key matching the presented one, it fails with
+// auth.ErrInvalidAPIKey for malformed, unknown or deleted keys.
+func (ks *APIKeyService) VerifyAPIKey(ctx context.Context, plaintext string) (domain.APIKey, error) {
+	rest, ok := strings.CutPrefix(plaintext, apiKeyTag)
+	if !ok {
+		return domain.APIKey{}, auth.ErrInvalidAPIKey
+	}
+
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok || prefix == "" {
+		return domain.APIKey{}, auth.ErrInvalidAPIKey
+	}
+
+	key, err := ks.repo.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			return domain.APIKey{}, auth.ErrInvalidAPIKey
+		}
+
+		return domain.APIKey{}, err
+	}
+
+	keyHash, err := ks.tokenManager.HashToken(plaintext)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+
+	if !hmac.Equal([]byte(keyHash), []byte(key.KeyHash)) {
+		return domain.APIKey{}, auth.ErrInvalidAPIKey
+	}
+
+	// the usage is informative, failing to record it must not fail the request
+	if err := ks.repo.TouchAPIKey(ctx, key.ID); err != nil {
+		logger.Log.ErrorContext(ctx, "failed to record api key usage",
+			slog.String("key_id", key.ID),
+			slog.String("err", err.Error()))
+	}
+
+	return key, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/pkg/hash"
+)
+
+type fakeAPIKeyRepo struct {
+	keys map[string]domain.APIKey
+}
+
+func (f *fakeAPIKeyRepo) CreateAPIKey(_ context.Context, key domain.APIKey) (domain.APIKey, error) {
+	key.ID = "key-" + key.Prefix
+	f.keys[key.Prefix] = key
+	return key, nil
+}
+
+func (f *fakeAPIKeyRepo) GetAPIKeys(_ context.Context, _ string) ([]domain.APIKey, error) {
+	return nil, nil
+}
+
+func (f *fakeAPIKeyRepo) GetAPIKeyByPrefix(_ context.Context, prefix string) (domain.APIKey, error) {
+	key, ok := f.keys[prefix]
+	if !ok {
+		return domain.APIKey{}, postgres.ErrNoRowsFound
+	}
+
+	return key, nil
+}
+
+func (f *fakeAPIKeyRepo) DeleteAPIKey(_ context.Context, _, _ string) error {
+	return nil
+}
+
+func (f *fakeAPIKeyRepo) TouchAPIKey(_ context.Context, _ string) error {
+	return nil
+}
+
+func TestAPIKeyService_CreateAndVerify(t *testing.T) {
+	ctx := context.Background()
+
+	tm, err := auth.NewManager(config.JWTConfig{SigningKey: "secret", AccessTokenTTL: time.Minute},
+		hash.NewSHA256Hasher("salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &fakeAPIKeyRepo{keys: make(map[string]domain.APIKey)}
+	ks, _ := NewAPIKeyService(repo, tm)
+
+	created, err := ks.CreateAPIKey(ctx, domain.APIKey{UserID: "user-1", Name: "pos", Scopes: []string{"orders:write"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(created.Key, apiKeyTag+created.Prefix+"_") {
+		t.Fatalf("key %q does not carry its prefix %q", created.Key, created.Prefix)
+	}
+
+	if repo.keys[created.Prefix].Key != "" {
+		t.Error("the plaintext key was stored")
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr error
+	}{
+		{name: "valid key", key: created.Key},
+		{name: "wrong secret", key: created.Key[:len(created.Key)-1] + "x", wantErr: auth.ErrInvalidAPIKey},
+		{name: "unknown prefix", key: apiKeyTag + "000000000000_secret", wantErr: auth.ErrInvalidAPIKey},
+		{name: "malformed key", key: "not-an-api-key", wantErr: auth.ErrInvalidAPIKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ks.VerifyAPIKey(ctx, tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyAPIKey() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err == nil && (key.UserID != "user-1" || !key.HasScope("orders:write")) {
+				t.Errorf("VerifyAPIKey() = %+v", key)
+			}
+		})
+	}
+}
@@ -1,45 +1,253 @@
 package auth
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/mihailtudos/gophermart/internal/config"
 	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/pkg/hash"
 )
 
 var (
 	ErrTokenExpired = errors.New("token expired")
 	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenRevoked = errors.New("token revoked")
+
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidAPIKey      = errors.New("invalid api key")
+	ErrUserSuspended      = errors.New("user suspended")
+	ErrSelfAction         = errors.New("the action can not target the acting user")
+	ErrInsufficientRole   = errors.New("insufficient role")
+
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+	ErrEmailNotSet          = errors.New("no email is set")
+	ErrEmailAlreadyVerified = errors.New("the email is already verified")
+	ErrEmailNotVerified     = errors.New("the email is not verified")
+	ErrInvalidEmailToken    = errors.New("invalid or expired email verification token")
+
+	ErrInvalidOIDCState  = errors.New("invalid or expired sign-in state")
+	ErrIdentityNotLinked = errors.New("the identity is not linked to any user")
 )
 
+// challengeAudience marks the tokens issued between the password and the code
+// steps of a two-factor sign-in.
+const challengeAudience = "2fa-challenge"
+
 type Manager struct {
 	jwtCfg config.JWTConfig
+	hasher hash.PasswordHasher
+
+	// keys is nil when no key directory is configured, tokens are then signed with HS256
+	keys atomic.Pointer[KeySet]
+}
+
+func NewManager(cfg config.JWTConfig, hasher hash.PasswordHasher) (*Manager, error) {
+	if hasher == nil {
+		return nil, errors.New("missing token hasher")
+	}
+
+	if cfg.KeysDir == "" && cfg.SigningKey == "" {
+		return nil, errors.New("missing token signing key")
+	}
+
+	m := &Manager{jwtCfg: cfg, hasher: hasher}
+
+	if cfg.KeysDir != "" {
+		if err := m.ReloadKeys(); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// ReloadKeys reads the key directory again, picking up new and retired keys.
+func (m *Manager) ReloadKeys() error {
+	ks, err := LoadKeySet(m.jwtCfg.KeysDir)
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	m.keys.Store(ks)
+
+	return nil
+}
+
+// ReloadKeysInBackground periodically reloads the key directory, on failure the
+// previously loaded keys stay in use.
+func (m *Manager) ReloadKeysInBackground(ctx context.Context, interval time.Duration) {
+	if m.jwtCfg.KeysDir == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				logger.Log.Warn("recover from panic ", slog.Any("err", p))
+			}
+		}()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.ReloadKeys(); err != nil {
+					logger.Log.Error("reload signing keys", slog.String("err", err.Error()))
+				}
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// JWKS returns the public keys tokens can be verified with, it is empty when
+// tokens are signed with the shared HS256 secret.
+func (m *Manager) JWKS() domain.JWKS {
+	ks := m.keys.Load()
+	if ks == nil {
+		return domain.JWKS{Keys: []domain.JWK{}}
+	}
+
+	return ks.JWKS()
 }
 
-func NewManager(cfg config.JWTConfig) (*Manager, error) {
-	return &Manager{jwtCfg: cfg}, nil
+// claims are the JWT claims of an access token, SessionID ties the token to the
+// session it was issued for.
+type claims struct {
+	SessionID string `json:"sid,omitempty"`
+	Role      string `json:"role,omitempty"`
+	// IssuedAtMicro is the issue time in microseconds, iat only has a seconds precision
+	// which can not tell the tokens issued right after a revocation from the revoked ones
+	IssuedAtMicro int64 `json:"iat_us,omitempty"`
+	jwt.StandardClaims
 }
 
-func (m *Manager) NewJWT(userID string, ttl *time.Duration) (string, error) {
+func (m *Manager) NewJWT(userID, sessionID, role string, ttl *time.Duration) (string, error) {
 	if ttl == nil {
 		ttl = &m.jwtCfg.AccessTokenTTL
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
-		ExpiresAt: time.Now().Add(*ttl).Unix(),
-		Subject:   userID,
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	c := claims{
+		SessionID:     sessionID,
+		Role:          role,
+		IssuedAtMicro: now.UnixMicro(),
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(*ttl).Unix(),
+			Subject:   userID,
+		},
+	}
+
+	return m.sign(c)
+}
+
+// NewChallengeToken issues the token proving the password step of a two-factor
+// sign-in, it can only be exchanged for tokens together with a valid code.
+func (m *Manager) NewChallengeToken(userID string, ttl time.Duration) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	return m.sign(claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Audience:  challengeAudience,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+			Subject:   userID,
+		},
 	})
+}
+
+// ParseChallengeToken returns the claims of a challenge token, the tokens issued
+// without an ID can not be consumed and are refused.
+func (m *Manager) ParseChallengeToken(token string) (domain.ChallengeClaims, error) {
+	c, err := m.parse(token)
+	if err != nil {
+		return domain.ChallengeClaims{}, err
+	}
+
+	if c.Audience != challengeAudience || c.Id == "" {
+		return domain.ChallengeClaims{}, ErrInvalidToken
+	}
+
+	return domain.ChallengeClaims{
+		ID:        c.Id,
+		UserID:    c.Subject,
+		ExpiresAt: time.Unix(c.ExpiresAt, 0),
+	}, nil
+}
+
+func (m *Manager) sign(c claims) (string, error) {
+	ks := m.keys.Load()
+	if ks == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, c).SignedString([]byte(m.jwtCfg.SigningKey))
+	}
+
+	key := ks.signer()
+	token := jwt.NewWithClaims(key.method, c)
+	token.Header["kid"] = key.id
+
+	return token.SignedString(key.private)
+}
+
+func (m *Manager) Parse(accessToken string) (domain.TokenClaims, error) {
+	c, err := m.parse(accessToken)
+	if err != nil {
+		return domain.TokenClaims{}, err
+	}
+
+	// challenge tokens are signed with the same keys but grant no access
+	if c.Audience != "" {
+		return domain.TokenClaims{}, ErrInvalidToken
+	}
 
-	return token.SignedString([]byte(m.jwtCfg.SigningKey))
+	issuedAt := time.Unix(c.IssuedAt, 0)
+	if c.IssuedAtMicro != 0 {
+		issuedAt = time.UnixMicro(c.IssuedAtMicro)
+	}
+
+	return domain.TokenClaims{
+		ID:        c.Id,
+		UserID:    c.Subject,
+		SessionID: c.SessionID,
+		Role:      c.Role,
+		IssuedAt:  issuedAt,
+	}, nil
 }
 
-func (m *Manager) Parse(accessToken string) (string, error) {
-	token, err := jwt.Parse(accessToken, func(token *jwt.Token) (i interface{}, err error) {
+func (m *Manager) parse(token string) (claims, error) {
+	var c claims
+	_, err := jwt.ParseWithClaims(token, &c, func(token *jwt.Token) (i interface{}, err error) {
+		if ks := m.keys.Load(); ks != nil {
+			return ks.verifier(token)
+		}
+
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
@@ -47,25 +255,35 @@ func (m *Manager) Parse(accessToken string) (string, error) {
 		return []byte(m.jwtCfg.SigningKey), nil
 	})
 
-	// if err != nil {
-	// 	return "", err
-	// }
-
 	// handling specific token issues
 	if ve, ok := err.(*jwt.ValidationError); ok {
 		if ve.Errors&jwt.ValidationErrorExpired != 0 {
-			return "", ErrTokenExpired
+			return claims{}, ErrTokenExpired
 		} else {
-			return "", ErrInvalidToken
+			return claims{}, ErrInvalidToken
 		}
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", fmt.Errorf("error get user claims from token")
+	if err != nil {
+		return claims{}, err
+	}
+
+	if c.Subject == "" {
+		return claims{}, ErrInvalidToken
+	}
+
+	return c, nil
+}
+
+// newTokenID returns a random JTI identifying a single access token.
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
 
-	return claims["sub"].(string), nil
+	return hex.EncodeToString(b), nil
 }
 
 func (m *Manager) NewRefreshToken() (string, error) {
@@ -78,14 +296,24 @@ func (m *Manager) NewRefreshToken() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
+// HashToken returns the keyed hash opaque tokens, such as refresh tokens, are stored and looked up by.
+func (m *Manager) HashToken(token string) (string, error) {
+	return m.hasher.Hash(token)
+}
+
 func (m *Manager) CreateSession(userID string, token string) (domain.Session, error) {
 	if userID == "" || token == "" {
 		return domain.Session{}, fmt.Errorf("invalid arguments")
 	}
 
+	tokenHash, err := m.HashToken(token)
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("failed to hash refresh token: %w", err)
+	}
+
 	return domain.Session{
 		UserID:    userID,
-		Token:     token,
-		ExpiresAt: time.Now().Add(m.jwtCfg.RefreshTokenTTL),
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().UTC().Add(m.jwtCfg.RefreshTokenTTL),
 	}, nil
 }
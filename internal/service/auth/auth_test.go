@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/pkg/hash"
+)
+
+func TestManager_ChallengeToken(t *testing.T) {
+	m := newTestManager(t, "")
+
+	challenge, err := m.NewChallengeToken("user", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := m.ParseChallengeToken(challenge)
+	if err != nil || claims.UserID != "user" || claims.ID == "" {
+		t.Errorf("ParseChallengeToken() = %+v, %v", claims, err)
+	}
+
+	other, err := m.NewChallengeToken("user", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if otherClaims, err := m.ParseChallengeToken(other); err != nil || otherClaims.ID == claims.ID {
+		t.Errorf("challenge tokens share the ID %q, err = %v", claims.ID, err)
+	}
+
+	if _, err := m.Parse(challenge); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Parse() accepted a challenge token as an access token, err = %v", err)
+	}
+
+	access, err := m.NewJWT("user", "session", "user", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.ParseChallengeToken(access); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ParseChallengeToken() accepted an access token, err = %v", err)
+	}
+}
+
+func TestNewManager_MissingSigningKey(t *testing.T) {
+	if _, err := NewManager(config.JWTConfig{AccessTokenTTL: time.Minute}, hash.NewSHA256Hasher("salt")); err == nil {
+		t.Error("NewManager() without a signing key nor a key directory expected an error")
+	}
+}
+
+func TestManager_IssuedAtPrecision(t *testing.T) {
+	m := newTestManager(t, "")
+
+	before := time.Now().Truncate(time.Microsecond)
+	access, err := m.NewJWT("user", "session", "user", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now()
+
+	claims, err := m.Parse(access)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the issue time keeps the microseconds that iat drops
+	if claims.IssuedAt.Before(before) || claims.IssuedAt.After(after) {
+		t.Errorf("IssuedAt = %s, want between %s and %s", claims.IssuedAt, before, after)
+	}
+}
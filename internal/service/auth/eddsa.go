@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// SigningMethodEdDSA implements the EdDSA (Ed25519) JWT signing method, which
+// jwt-go does not ship with.
+type SigningMethodEdDSA struct{}
+
+var (
+	SigningMethodEd25519 = &SigningMethodEdDSA{}
+
+	ErrEdDSAVerification = errors.New("crypto/ed25519: verification error")
+)
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEd25519.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEd25519
+	})
+}
+
+func (m *SigningMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+// Verify expects an ed25519.PublicKey.
+func (m *SigningMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return ErrEdDSAVerification
+	}
+
+	return nil
+}
+
+// Sign expects an ed25519.PrivateKey.
+func (m *SigningMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mihailtudos/gophermart/internal/domain"
+)
+
+const (
+	keyFileExt = ".pem"
+
+	minRSAKeyBits = 2048
+)
+
+var (
+	ErrNoSigningKey   = errors.New("no private key found in the key directory")
+	ErrUnknownKey     = errors.New("unknown signing key")
+	ErrUnsupportedKey = errors.New("unsupported key type")
+)
+
+// signingKey is a key loaded from the key directory, keys without a private
+// part can only verify tokens.
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// KeySet holds every key tokens can be verified with and the key new tokens are signed with.
+type KeySet struct {
+	keys    map[string]signingKey
+	current string
+}
+
+// LoadKeySet reads every <kid>.pem file of the directory. RSA keys sign with RS256 and
+// Ed25519 keys with EdDSA. New tokens are signed with the private key whose kid sorts
+// last, so naming keys by creation date (e.g. 2024-09-26.pem) rotates them in order.
+// A key stays valid for verification until its file is removed, a public key file
+// keeps verifying tokens of a key whose private part was already retired.
+func LoadKeySet(dir string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+keyFileExt))
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{keys: make(map[string]signingKey, len(files))}
+
+	sort.Strings(files)
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), keyFileExt)
+
+		key, err := loadKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key %s: %w", kid, err)
+		}
+		key.id = kid
+
+		ks.keys[kid] = key
+		if key.private != nil {
+			ks.current = kid
+		}
+	}
+
+	if ks.current == "" {
+		return nil, ErrNoSigningKey
+	}
+
+	return ks, nil
+}
+
+func loadKey(file string) (signingKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return signingKey{}, errors.New("no PEM data found")
+	}
+
+	var parsed any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return signingKey{}, fmt.Errorf("%w: PEM block %q", ErrUnsupportedKey, block.Type)
+	}
+
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	return newSigningKey(parsed)
+}
+
+func newSigningKey(parsed any) (signingKey, error) {
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return signingKey{}, fmt.Errorf("RSA key must be at least %d bits", minRSAKeyBits)
+		}
+
+		return signingKey{method: jwt.SigningMethodRS256, private: k, public: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return signingKey{}, fmt.Errorf("RSA key must be at least %d bits", minRSAKeyBits)
+		}
+
+		return signingKey{method: jwt.SigningMethodRS256, public: k}, nil
+	case ed25519.PrivateKey:
+		return signingKey{method: SigningMethodEd25519, private: k, public: k.Public()}, nil
+	case ed25519.PublicKey:
+		return signingKey{method: SigningMethodEd25519, public: k}, nil
+	default:
+		return signingKey{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, parsed)
+	}
+}
+
+// signer returns the key new tokens are signed with.
+func (ks *KeySet) signer() signingKey {
+	return ks.keys[ks.current]
+}
+
+// verifier returns the public key for the token's kid, making sure the
+// token was signed with the algorithm the key belongs to.
+func (ks *KeySet) verifier(token *jwt.Token) (crypto.PublicKey, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.public, nil
+}
+
+// JWKS returns the public keys of the set.
+func (ks *KeySet) JWKS() domain.JWKS {
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	jwks := domain.JWKS{Keys: make([]domain.JWK, 0, len(kids))}
+	for _, kid := range kids {
+		key := ks.keys[kid]
+		jwk := domain.JWK{
+			Use: "sig",
+			Alg: key.method.Alg(),
+			Kid: kid,
+		}
+
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
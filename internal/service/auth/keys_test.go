@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/pkg/hash"
+)
+
+func writePEM(t *testing.T, dir, kid, blockType string, der []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+keyFileExt), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestManager(t *testing.T, dir string) *Manager {
+	t.Helper()
+
+	m, err := NewManager(config.JWTConfig{
+		AccessTokenTTL: time.Minute,
+		SigningKey:     "secret",
+		KeysDir:        dir,
+	}, hash.NewSHA256Hasher("salt"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	return m
+}
+
+func tokenHeader(t *testing.T, token string) map[string]interface{} {
+	t.Helper()
+
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, &claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return parsed.Header
+}
+
+func TestManager_KeyRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, "2024-01", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	m := newTestManager(t, dir)
+
+	oldToken, err := m.NewJWT("user", "session", "user", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h := tokenHeader(t, oldToken); h["kid"] != "2024-01" || h["alg"] != "RS256" {
+		t.Fatalf("unexpected header %v", h)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, "2024-02", "PRIVATE KEY", der)
+
+	// retire the private part of the old key, its public part still verifies
+	der, err = x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, "2024-01", "PUBLIC KEY", der)
+
+	if err := m.ReloadKeys(); err != nil {
+		t.Fatalf("ReloadKeys() error = %v", err)
+	}
+
+	newToken, err := m.NewJWT("user", "session", "user", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h := tokenHeader(t, newToken); h["kid"] != "2024-02" || h["alg"] != "EdDSA" {
+		t.Fatalf("unexpected header %v", h)
+	}
+
+	for _, token := range []string{oldToken, newToken} {
+		c, err := m.Parse(token)
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+
+		if c.UserID != "user" || c.SessionID != "session" {
+			t.Errorf("Parse() = %+v", c)
+		}
+	}
+
+	jwks := m.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS() returned %d keys, want 2", len(jwks.Keys))
+	}
+
+	if k := jwks.Keys[0]; k.Kid != "2024-01" || k.Kty != "RSA" || k.N == "" || k.E != "AQAB" {
+		t.Errorf("unexpected RSA JWK %+v", k)
+	}
+
+	if k := jwks.Keys[1]; k.Kid != "2024-02" || k.Kty != "OKP" || k.Crv != "Ed25519" || k.X == "" {
+		t.Errorf("unexpected Ed25519 JWK %+v", k)
+	}
+
+	// once the key file is removed its tokens are no longer accepted
+	if err := os.Remove(filepath.Join(dir, "2024-01"+keyFileExt)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.ReloadKeys(); err != nil {
+		t.Fatalf("ReloadKeys() error = %v", err)
+	}
+
+	if _, err := m.Parse(oldToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Parse() error = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestManager_RejectsAlgorithmConfusion(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, "rsa", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	m := newTestManager(t, dir)
+
+	// an HS256 token keyed with the published public key must not verify
+	publicDER := x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+			Subject:   "user",
+		},
+	})
+	token.Header["kid"] = "rsa"
+
+	signed, err := token.SignedString(publicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Parse(signed); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Parse() error = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestManager_HS256Fallback(t *testing.T) {
+	m := newTestManager(t, "")
+
+	token, err := m.NewJWT("user", "", "user", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h := tokenHeader(t, token); h["alg"] != "HS256" {
+		t.Fatalf("unexpected header %v", h)
+	}
+
+	if c, err := m.Parse(token); err != nil || c.UserID != "user" {
+		t.Errorf("Parse() = %+v, %v", c, err)
+	}
+
+	if keys := m.JWKS().Keys; len(keys) != 0 {
+		t.Errorf("JWKS() exposed %d keys for HS256", len(keys))
+	}
+}
+
+func TestLoadKeySet_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, dir string)
+		wantErr error
+	}{
+		{
+			name:    "empty directory",
+			prepare: func(t *testing.T, dir string) {},
+			wantErr: ErrNoSigningKey,
+		},
+		{
+			name: "public keys only",
+			prepare: func(t *testing.T, dir string) {
+				pub, _, err := ed25519.GenerateKey(rand.Reader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				der, err := x509.MarshalPKIXPublicKey(pub)
+				if err != nil {
+					t.Fatal(err)
+				}
+				writePEM(t, dir, "ed", "PUBLIC KEY", der)
+			},
+			wantErr: ErrNoSigningKey,
+		},
+		{
+			name: "unsupported PEM block",
+			prepare: func(t *testing.T, dir string) {
+				writePEM(t, dir, "cert", "CERTIFICATE", []byte("x"))
+			},
+			wantErr: ErrUnsupportedKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.prepare(t, dir)
+
+			if _, err := LoadKeySet(dir); !errors.Is(err, tt.wantErr) {
+				t.Errorf("LoadKeySet() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/notifier"
+	"github.com/mihailtudos/gophermart/internal/repository"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+)
+
+const emailVerificationSendTimeout = 30 * time.Second
+
+type EmailVerificationUsers interface {
+	GetUserByID(ctx context.Context, userID string) (domain.User, error)
+}
+
+// EmailVerificationService confirms that users own their email, the link sent to
+// it carries a token signed for the user and the email with an expiry.
+type EmailVerificationService struct {
+	repo  repository.EmailVerificationRepo
+	users EmailVerificationUsers
+	// limiter counts the links resent per user, every one is a failure so that the
+	// next one has to wait
+	limiter LoginLimiter
+	sender  notifier.Sender
+	cfg     config.EmailVerificationConfig
+	key     []byte
+	now     func() time.Time
+}
+
+func NewEmailVerificationService(repo repository.EmailVerificationRepo,
+	users EmailVerificationUsers,
+	limiter LoginLimiter,
+	sender notifier.Sender,
+	cfg config.EmailVerificationConfig) (*EmailVerificationService, error) {
+	if cfg.SigningKey == "" {
+		return nil, errors.New("missing email verification signing key")
+	}
+
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("invalid email verification URL: %w", err)
+	}
+
+	return &EmailVerificationService{
+		repo:    repo,
+		users:   users,
+		limiter: limiter,
+		sender:  sender,
+		cfg:     cfg,
+		key:     []byte(cfg.SigningKey),
+		now:     time.Now,
+	}, nil
+}
+
+// SendVerificationLink sends the link to the email of the user in the background.
+func (es *EmailVerificationService) SendVerificationLink(ctx context.Context, user domain.User) {
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				logger.Log.Warn("recover from panic ", slog.Any("err", p))
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), emailVerificationSendTimeout)
+		defer cancel()
+
+		if err := es.sendLink(ctx, user); err != nil {
+			logger.Log.ErrorContext(ctx, "failed to send email verification link",
+				slog.String("userID", user.ID),
+				slog.String("err", err.Error()))
+		}
+	}()
+}
+
+// ResendVerificationLink sends a new link for the current email of the user, the
+// links resent are throttled per user.
+func (es *EmailVerificationService) ResendVerificationLink(ctx context.Context, userID string) error {
+	if err := es.limiter.Allow(ctx, userID, ""); err != nil {
+		return err
+	}
+
+	user, err := es.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case user.Email == "":
+		return auth.ErrEmailNotSet
+	case user.EmailVerified():
+		return auth.ErrEmailAlreadyVerified
+	}
+
+	if err := es.limiter.Failure(ctx, userID, ""); err != nil {
+		return fmt.Errorf("failed to record verification link request: %w", err)
+	}
+
+	es.SendVerificationLink(ctx, user)
+
+	return nil
+}
+
+func (es *EmailVerificationService) sendLink(ctx context.Context, user domain.User) error {
+	link, err := url.Parse(es.cfg.URL)
+	if err != nil {
+		return fmt.Errorf("invalid email verification URL: %w", err)
+	}
+
+	q := link.Query()
+	q.Set("token", es.signToken(user.ID, user.Email, es.now().Add(es.cfg.TokenTTL)))
+	link.RawQuery = q.Encode()
+
+	return es.sender.Send(ctx, notifier.Message{
+		To:      user.Email,
+		Subject: "Verify your Gophermart email",
+		Body: fmt.Sprintf("Use the link below to confirm this is your email, it expires in %s.\n\n%s\n\n"+
+			"If you did not add this email to a Gophermart account you can ignore this message.",
+			es.cfg.TokenTTL, link.String()),
+	})
+}
+
+// VerifyEmail marks the email the token was issued for as verified, the token is
+// rejected once the user has changed the email.
+func (es *EmailVerificationService) VerifyEmail(ctx context.Context, token string) error {
+	userID, email, err := es.parseToken(token)
+	if err != nil {
+		return err
+	}
+
+	user, err := es.users.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			return auth.ErrInvalidEmailToken
+		}
+
+		return err
+	}
+
+	if user.Email != email {
+		return auth.ErrInvalidEmailToken
+	}
+
+	// following the link again is not an error
+	if user.EmailVerified() {
+		return nil
+	}
+
+	if err := es.repo.VerifyEmail(ctx, userID, email); err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			return auth.ErrInvalidEmailToken
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// signToken encodes the user, the email and the expiry with their HMAC-SHA256, the
+// fields are separated by new lines which neither of them can contain.
+func (es *EmailVerificationService) signToken(userID, email string, expiresAt time.Time) string {
+	payload := strings.Join([]string{userID, email, strconv.FormatInt(expiresAt.Unix(), 10)}, "\n")
+
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(es.mac([]byte(payload)))
+}
+
+func (es *EmailVerificationService) parseToken(token string) (userID, email string, err error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", "", auth.ErrInvalidEmailToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", "", auth.ErrInvalidEmailToken
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, es.mac(payload)) {
+		return "", "", auth.ErrInvalidEmailToken
+	}
+
+	fields := strings.Split(string(payload), "\n")
+	if len(fields) != 3 {
+		return "", "", auth.ErrInvalidEmailToken
+	}
+
+	expiresAt, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || !es.now().Before(time.Unix(expiresAt, 0)) {
+		return "", "", auth.ErrInvalidEmailToken
+	}
+
+	return fields[0], fields[1], nil
+}
+
+func (es *EmailVerificationService) mac(payload []byte) []byte {
+	h := hmac.New(sha256.New, es.key)
+	h.Write(payload)
+	return h.Sum(nil)
+}
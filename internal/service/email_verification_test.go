@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/notifier"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/internal/service/throttle"
+)
+
+type fakeEmailVerificationRepo struct {
+	verified []string
+}
+
+func (f *fakeEmailVerificationRepo) VerifyEmail(_ context.Context, _, email string) error {
+	f.verified = append(f.verified, email)
+	return nil
+}
+
+type fakeEmailUsers struct {
+	user domain.User
+}
+
+func (f *fakeEmailUsers) GetUserByID(_ context.Context, _ string) (domain.User, error) {
+	return f.user, nil
+}
+
+// fakeSender records the messages instead of mailing them, the services send
+// them in the background.
+type fakeSender struct {
+	mu       sync.Mutex
+	messages []notifier.Message
+}
+
+func (f *fakeSender) Send(_ context.Context, msg notifier.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.messages = append(f.messages, msg)
+	return nil
+}
+
+func TestEmailVerificationService_VerifyEmail(t *testing.T) {
+	logger.Init(io.Discard, "error")
+
+	user := domain.User{ID: "user-1", UserProfile: domain.UserProfile{Email: "alice@example.com"}}
+	verifiedAt := time.Now()
+
+	tests := []struct {
+		name string
+		// change alters the user or the token after the link was sent
+		change       func(users *fakeEmailUsers, token string) string
+		after        time.Duration
+		wantErr      error
+		wantVerified bool
+	}{
+		{name: "valid link", wantVerified: true},
+		{name: "expired link", after: 25 * time.Hour, wantErr: auth.ErrInvalidEmailToken},
+		{name: "tampered link", change: func(_ *fakeEmailUsers, token string) string {
+			payload, mac, _ := strings.Cut(token, ".")
+			return payload + "A." + mac
+		}, wantErr: auth.ErrInvalidEmailToken},
+		{name: "email changed since", change: func(users *fakeEmailUsers, token string) string {
+			users.user.Email = "mallory@example.com"
+			return token
+		}, wantErr: auth.ErrInvalidEmailToken},
+		{name: "already verified", change: func(users *fakeEmailUsers, token string) string {
+			users.user.EmailVerifiedAt = &verifiedAt
+			return token
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeEmailVerificationRepo{}
+			users := &fakeEmailUsers{user: user}
+			sender := &fakeSender{}
+
+			es, err := NewEmailVerificationService(repo, users, &fakeLoginLimiter{}, sender, config.EmailVerificationConfig{
+				SigningKey: "secret",
+				TokenTTL:   24 * time.Hour,
+				URL:        "https://gophermart.example/verify-email",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := es.sendLink(context.Background(), user); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(sender.messages) != 1 || sender.messages[0].To != user.Email {
+				t.Fatalf("messages = %+v, want one to %s", sender.messages, user.Email)
+			}
+
+			token := linkToken(t, sender.messages[0].Body)
+			if tt.change != nil {
+				token = tt.change(users, token)
+			}
+
+			es.now = func() time.Time { return time.Now().Add(tt.after) }
+
+			err = es.VerifyEmail(context.Background(), token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyEmail() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if (len(repo.verified) == 1) != tt.wantVerified {
+				t.Errorf("verified = %v, want verified %v", repo.verified, tt.wantVerified)
+			}
+		})
+	}
+}
+
+// linkToken extracts the token of the verification link in the message body.
+func linkToken(t *testing.T, body string) string {
+	t.Helper()
+
+	for _, line := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(line, "https://") {
+			continue
+		}
+
+		link, err := url.Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return link.Query().Get("token")
+	}
+
+	t.Fatalf("no link in %q", body)
+	return ""
+}
+
+func TestEmailVerificationService_ResendVerificationLink(t *testing.T) {
+	logger.Init(io.Discard, "error")
+
+	verifiedAt := time.Now()
+
+	tests := []struct {
+		name    string
+		profile domain.UserProfile
+		wantErr error
+	}{
+		{name: "unverified email", profile: domain.UserProfile{Email: "alice@example.com"}},
+		{name: "no email", wantErr: auth.ErrEmailNotSet},
+		{name: "verified email", profile: domain.UserProfile{Email: "alice@example.com", EmailVerifiedAt: &verifiedAt},
+			wantErr: auth.ErrEmailAlreadyVerified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &fakeEmailUsers{user: domain.User{ID: "user-1", UserProfile: tt.profile}}
+
+			es, _ := NewEmailVerificationService(&fakeEmailVerificationRepo{}, users, &fakeLoginLimiter{},
+				&fakeSender{}, config.EmailVerificationConfig{SigningKey: "secret", TokenTTL: time.Hour})
+
+			if err := es.ResendVerificationLink(context.Background(), "user-1"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ResendVerificationLink() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEmailVerificationService_ResendVerificationLinkCooldown(t *testing.T) {
+	logger.Init(io.Discard, "error")
+	ctx := context.Background()
+
+	limiter, err := throttle.NewScopedLimiter(&fakeLoginAttemptsRepo{}, "email-verification",
+		config.LoginThrottleConfig{
+			BaseDelay:          time.Minute,
+			MaxDelay:           time.Hour,
+			LoginLockThreshold: 10,
+			LockoutDuration:    time.Hour,
+			FailureWindow:      time.Hour,
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := &fakeEmailUsers{user: domain.User{ID: "user-1",
+		UserProfile: domain.UserProfile{Email: "alice@example.com"}}}
+
+	es, _ := NewEmailVerificationService(&fakeEmailVerificationRepo{}, users, limiter, &fakeSender{},
+		config.EmailVerificationConfig{SigningKey: "secret", TokenTTL: time.Hour})
+
+	if err := es.ResendVerificationLink(ctx, "user-1"); err != nil {
+		t.Fatalf("ResendVerificationLink() error = %v", err)
+	}
+
+	if err := es.ResendVerificationLink(ctx, "user-1"); !errors.Is(err, throttle.ErrTooManyAttempts) {
+		t.Errorf("ResendVerificationLink() within the cooldown error = %v, want %v", err,
+			throttle.ErrTooManyAttempts)
+	}
+
+	// the cooldown is per user
+	if err := es.ResendVerificationLink(ctx, "user-2"); err != nil {
+		t.Errorf("ResendVerificationLink() for another user error = %v", err)
+	}
+}
+
+func TestNewEmailVerificationService_MissingKey(t *testing.T) {
+	_, err := NewEmailVerificationService(&fakeEmailVerificationRepo{}, &fakeEmailUsers{}, &fakeLoginLimiter{},
+		&fakeSender{}, config.EmailVerificationConfig{TokenTTL: time.Hour})
+	if err == nil {
+		t.Error("NewEmailVerificationService() without a signing key expected an error")
+	}
+}
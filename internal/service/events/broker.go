@@ -0,0 +1,104 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+)
+
+const subscriberBufferSize = 16
+
+type subscribers map[chan domain.Event]struct{}
+
+// Broker is an in-process pub/sub used to fan out user events
+// to all the active subscriptions of that user.
+type Broker struct {
+	mu     sync.Mutex
+	subs   map[string]subscribers
+	closed bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subs: make(map[string]subscribers),
+	}
+}
+
+// Subscribe registers a new subscription for the user events. The returned
+// channel is closed when the subscription is cancelled, when the subscriber
+// cannot keep up with the published events or when the broker is closed.
+func (b *Broker) Subscribe(userID string) (<-chan domain.Event, func()) {
+	ch := make(chan domain.Event, subscriberBufferSize)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(subscribers)
+	}
+	b.subs[userID][ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.remove(userID, ch)
+	}
+}
+
+// Publish delivers the event to all the user subscriptions without blocking,
+// slow subscribers are dropped and are expected to resume using the event ID.
+func (b *Broker) Publish(ctx context.Context, userID string, event domain.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs[userID] {
+		select {
+		case ch <- event:
+		default:
+			logger.Log.WarnContext(ctx, "dropping slow events subscriber",
+				slog.String("userID", userID))
+			b.remove(userID, ch)
+		}
+	}
+}
+
+// Close terminates all the subscriptions, subsequent subscriptions are closed right away.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for userID, subs := range b.subs {
+		for ch := range subs {
+			close(ch)
+		}
+		delete(b.subs, userID)
+	}
+}
+
+func (b *Broker) remove(userID string, ch chan domain.Event) {
+	subs, ok := b.subs[userID]
+	if !ok {
+		return
+	}
+
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+
+	delete(subs, ch)
+	close(ch)
+
+	if len(subs) == 0 {
+		delete(b.subs, userID)
+	}
+}
@@ -0,0 +1,78 @@
+package events
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+)
+
+func TestBroker_Publish(t *testing.T) {
+	b := NewBroker()
+
+	events, unsubscribe := b.Subscribe("user-1")
+	defer unsubscribe()
+
+	other, unsubscribeOther := b.Subscribe("user-2")
+	defer unsubscribeOther()
+
+	b.Publish(context.Background(), "user-1", domain.Event{ID: "1", Type: domain.EventOrderStatusChanged})
+
+	select {
+	case event := <-events:
+		if event.ID != "1" {
+			t.Errorf("Publish() delivered event %q, want %q", event.ID, "1")
+		}
+	default:
+		t.Fatal("Publish() did not deliver the event to the user subscriber")
+	}
+
+	select {
+	case event := <-other:
+		t.Errorf("Publish() delivered event %q to another user", event.ID)
+	default:
+	}
+}
+
+func TestBroker_DropsSlowSubscriber(t *testing.T) {
+	logger.Init(io.Discard, "error")
+
+	b := NewBroker()
+
+	events, unsubscribe := b.Subscribe("user-1")
+	defer unsubscribe()
+
+	for range subscriberBufferSize + 1 {
+		b.Publish(context.Background(), "user-1", domain.Event{Type: domain.EventBalanceUpdated})
+	}
+
+	received := 0
+	for range events {
+		received++
+	}
+
+	if received != subscriberBufferSize {
+		t.Errorf("slow subscriber received %d events, want %d", received, subscriberBufferSize)
+	}
+}
+
+func TestBroker_Close(t *testing.T) {
+	b := NewBroker()
+
+	events, unsubscribe := b.Subscribe("user-1")
+	b.Close()
+
+	if _, ok := <-events; ok {
+		t.Error("Close() did not close the subscription")
+	}
+
+	// unsubscribing after close must not panic
+	unsubscribe()
+
+	late, _ := b.Subscribe("user-1")
+	if _, ok := <-late; ok {
+		t.Error("Subscribe() after Close() returned an open subscription")
+	}
+}
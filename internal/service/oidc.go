@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/repository"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/pkg/oidc"
+)
+
+const oidcPasswordBytes = 32
+
+type OIDCProvider interface {
+	Issuer() string
+	AuthCodeURL(state, nonce, codeVerifier string) string
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (oidc.Claims, error)
+}
+
+type OIDCUsers interface {
+	Register(ctx context.Context, user domain.User) (string, error)
+	GetUserByID(ctx context.Context, userID string) (domain.User, error)
+	GenerateUserTokens(ctx context.Context, userID string, client domain.SessionClient) (domain.Tokens, error)
+}
+
+// OIDCChallenges starts the local two-factor authentication of a user.
+type OIDCChallenges interface {
+	NewChallenge(ctx context.Context, userID string) (string, error)
+}
+
+// OIDCService signs users in with the OpenID Connect provider, identities are
+// linked to users by the issuer and the subject of the ID token.
+type OIDCService struct {
+	repo         repository.OIDCRepo
+	users        OIDCUsers
+	challenges   OIDCChallenges
+	provider     OIDCProvider
+	tokenManager TokenManager
+	// limiter caps the sign-ins started per client IP, each one stores a state until it expires
+	limiter RateLimiter
+	cfg     config.OIDCConfig
+	now     func() time.Time
+}
+
+func NewOIDCService(repo repository.OIDCRepo,
+	users OIDCUsers,
+	challenges OIDCChallenges,
+	provider OIDCProvider,
+	tm TokenManager,
+	limiter RateLimiter,
+	cfg config.OIDCConfig) (*OIDCService, error) {
+	return &OIDCService{
+		repo:         repo,
+		users:        users,
+		challenges:   challenges,
+		provider:     provider,
+		tokenManager: tm,
+		limiter:      limiter,
+		cfg:          cfg,
+		now:          time.Now,
+	}, nil
+}
+
+// StartLogin starts a sign-in at the provider, when linkUserID is set the identity
+// is linked to that user instead. The sign-ins are rate limited per client IP.
+func (o *OIDCService) StartLogin(ctx context.Context, linkUserID, ip string) (domain.OIDCLogin, error) {
+	if err := o.limiter.Allow(ip); err != nil {
+		return domain.OIDCLogin{}, err
+	}
+
+	state, err := oidc.NewRandomString()
+	if err != nil {
+		return domain.OIDCLogin{}, err
+	}
+
+	nonce, err := oidc.NewRandomString()
+	if err != nil {
+		return domain.OIDCLogin{}, err
+	}
+
+	codeVerifier, err := oidc.NewRandomString()
+	if err != nil {
+		return domain.OIDCLogin{}, err
+	}
+
+	stateHash, err := o.tokenManager.HashToken(state)
+	if err != nil {
+		return domain.OIDCLogin{}, err
+	}
+
+	expiresAt := o.now().Add(o.cfg.StateTTL)
+
+	err = o.repo.CreateOIDCState(ctx, domain.OIDCState{
+		StateHash:    stateHash,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		return domain.OIDCLogin{}, err
+	}
+
+	return domain.OIDCLogin{
+		URL:       o.provider.AuthCodeURL(state, nonce, codeVerifier),
+		State:     state,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Callback completes the sign-in with the code the provider redirected back with
+// and opens a session for the user the identity is linked to.
+//
+// The users with the two-factor authentication enabled get a local challenge instead
+// of the tokens, whatever the provider asked them for.
+func (o *OIDCService) Callback(ctx context.Context,
+	code, state string,
+	client domain.SessionClient) (domain.OIDCSignin, error) {
+	stateHash, err := o.tokenManager.HashToken(state)
+	if err != nil {
+		return domain.OIDCSignin{}, err
+	}
+
+	st, err := o.repo.ConsumeOIDCState(ctx, stateHash)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			return domain.OIDCSignin{}, auth.ErrInvalidOIDCState
+		}
+
+		return domain.OIDCSignin{}, err
+	}
+
+	claims, err := o.provider.Exchange(ctx, code, st.CodeVerifier, st.Nonce)
+	if err != nil {
+		return domain.OIDCSignin{}, err
+	}
+
+	userID, err := o.identityUser(ctx, st, claims)
+	if err != nil {
+		return domain.OIDCSignin{}, err
+	}
+
+	user, err := o.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return domain.OIDCSignin{}, err
+	}
+
+	if user.Suspended() {
+		return domain.OIDCSignin{}, auth.ErrUserSuspended
+	}
+
+	if user.TwoFactorEnabled {
+		challenge, err := o.challenges.NewChallenge(ctx, userID)
+		if err != nil {
+			return domain.OIDCSignin{}, err
+		}
+
+		return domain.OIDCSignin{ChallengeToken: challenge}, nil
+	}
+
+	tokens, err := o.users.GenerateUserTokens(ctx, userID, client)
+	if err != nil {
+		return domain.OIDCSignin{}, err
+	}
+
+	return domain.OIDCSignin{Tokens: tokens}, nil
+}
+
+// identityUser returns the user the identity is linked to, linking it first when
+// the sign-in was started to link it or when new accounts are created for it.
+func (o *OIDCService) identityUser(ctx context.Context, st domain.OIDCState, claims oidc.Claims) (string, error) {
+	identity, err := o.repo.GetUserIdentity(ctx, o.provider.Issuer(), claims.Subject)
+	if err == nil {
+		if st.LinkUserID != "" && st.LinkUserID != identity.UserID {
+			return "", postgres.ErrIdentityAlreadyLinked
+		}
+
+		return identity.UserID, nil
+	}
+
+	if !errors.Is(err, postgres.ErrNoRowsFound) {
+		return "", err
+	}
+
+	// identities are never matched to users by their login, anyone can register
+	// any login so it does not prove the user owns the identity
+	userID := st.LinkUserID
+	if userID == "" {
+		if !o.cfg.AutoCreate {
+			return "", auth.ErrIdentityNotLinked
+		}
+
+		if userID, err = o.createUser(ctx, claims); err != nil {
+			return "", err
+		}
+	}
+
+	_, err = o.repo.CreateUserIdentity(ctx, domain.UserIdentity{
+		UserID:  userID,
+		Issuer:  o.provider.Issuer(),
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	logger.Log.InfoContext(ctx, "linked oidc identity",
+		slog.String("userID", userID),
+		slog.String("issuer", o.provider.Issuer()))
+
+	return userID, nil
+}
+
+// createUser registers a user for the identity, the login is the verified email
+// if there is one. The password is random, it can be set with a password reset.
+func (o *OIDCService) createUser(ctx context.Context, claims oidc.Claims) (string, error) {
+	login := "oidc-" + claims.Subject
+	if claims.Email != "" && claims.EmailVerified {
+		login = claims.Email
+	}
+
+	b := make([]byte, oidcPasswordBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	user := domain.User{Login: login}
+	if err := user.Password.Set(hex.EncodeToString(b)); err != nil {
+		return "", err
+	}
+
+	userID, err := o.users.Register(ctx, user)
+	if err != nil {
+		// the login is taken by a local account, its owner has to link the identity
+		if errors.Is(err, postgres.ErrDuplicateLogin) {
+			return "", auth.ErrIdentityNotLinked
+		}
+
+		return "", fmt.Errorf("failed to register oidc user: %w", err)
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/internal/service/throttle"
+	"github.com/mihailtudos/gophermart/pkg/hash"
+	"github.com/mihailtudos/gophermart/pkg/oidc"
+)
+
+const testIssuer = "https://idp.example"
+
+type fakeOIDCRepo struct {
+	states     map[string]domain.OIDCState
+	identities map[string]domain.UserIdentity
+}
+
+func newFakeOIDCRepo() *fakeOIDCRepo {
+	return &fakeOIDCRepo{
+		states:     map[string]domain.OIDCState{},
+		identities: map[string]domain.UserIdentity{},
+	}
+}
+
+func (f *fakeOIDCRepo) CreateOIDCState(_ context.Context, state domain.OIDCState) error {
+	f.states[state.StateHash] = state
+	return nil
+}
+
+func (f *fakeOIDCRepo) ConsumeOIDCState(_ context.Context, stateHash string) (domain.OIDCState, error) {
+	state, ok := f.states[stateHash]
+	if !ok {
+		return domain.OIDCState{}, postgres.ErrNoRowsFound
+	}
+
+	delete(f.states, stateHash)
+	return state, nil
+}
+
+func (f *fakeOIDCRepo) GetUserIdentity(_ context.Context, issuer, subject string) (domain.UserIdentity, error) {
+	identity, ok := f.identities[issuer+"|"+subject]
+	if !ok {
+		return domain.UserIdentity{}, postgres.ErrNoRowsFound
+	}
+
+	return identity, nil
+}
+
+func (f *fakeOIDCRepo) CreateUserIdentity(_ context.Context,
+	identity domain.UserIdentity) (domain.UserIdentity, error) {
+	f.identities[identity.Issuer+"|"+identity.Subject] = identity
+	return identity, nil
+}
+
+// fakeOIDCProvider asserts the subject of the code, if the nonce matches.
+type fakeOIDCProvider struct {
+	nonce string
+}
+
+func (f *fakeOIDCProvider) Issuer() string {
+	return testIssuer
+}
+
+func (f *fakeOIDCProvider) AuthCodeURL(_, nonce, _ string) string {
+	f.nonce = nonce
+	return testIssuer + "/authorize"
+}
+
+func (f *fakeOIDCProvider) Exchange(_ context.Context, code, _, nonce string) (oidc.Claims, error) {
+	if nonce != f.nonce {
+		return oidc.Claims{}, oidc.ErrInvalidIDToken
+	}
+
+	return oidc.Claims{Subject: code, Email: "gopher@example.com", EmailVerified: true}, nil
+}
+
+type fakeOIDCUsers struct {
+	registered []domain.User
+}
+
+func (f *fakeOIDCUsers) GetUserByID(_ context.Context, userID string) (domain.User, error) {
+	return domain.User{ID: userID}, nil
+}
+
+func (f *fakeOIDCUsers) Register(_ context.Context, user domain.User) (string, error) {
+	f.registered = append(f.registered, user)
+	return "new-user", nil
+}
+
+func (f *fakeOIDCUsers) GenerateUserTokens(_ context.Context,
+	userID string,
+	_ domain.SessionClient) (domain.Tokens, error) {
+	return domain.Tokens{AccessToken: "access-" + userID}, nil
+}
+
+type fakeOIDCChallenges struct{}
+
+func (fakeOIDCChallenges) NewChallenge(_ context.Context, userID string) (string, error) {
+	return "challenge-" + userID, nil
+}
+
+func newTestOIDCLimiter(t *testing.T) *throttle.RateLimiter {
+	t.Helper()
+
+	limiter, err := throttle.NewRateLimiter(3, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return limiter
+}
+
+func TestOIDCService_Callback(t *testing.T) {
+	logger.Init(io.Discard, "error")
+
+	tm, err := auth.NewManager(config.JWTConfig{SigningKey: "secret", AccessTokenTTL: time.Minute},
+		hash.NewSHA256Hasher("salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		autoCreate bool
+		linkUserID string
+		subject    string
+		wantUserID string
+		wantErr    error
+	}{
+		{name: "linked identity signs in", subject: "linked-subject", wantUserID: "user-1"},
+		{name: "unlinked identity is rejected", subject: "other-subject", wantErr: auth.ErrIdentityNotLinked},
+		{name: "unlinked identity creates a user", autoCreate: true, subject: "other-subject",
+			wantUserID: "new-user"},
+		{name: "signed in user links the identity", linkUserID: "user-2", subject: "other-subject",
+			wantUserID: "user-2"},
+		{name: "identity linked to another user", linkUserID: "user-2", subject: "linked-subject",
+			wantErr: postgres.ErrIdentityAlreadyLinked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeOIDCRepo()
+			repo.identities[testIssuer+"|linked-subject"] = domain.UserIdentity{
+				UserID:  "user-1",
+				Issuer:  testIssuer,
+				Subject: "linked-subject",
+			}
+
+			users := &fakeOIDCUsers{}
+			oidcService, _ := NewOIDCService(repo, users, fakeOIDCChallenges{}, &fakeOIDCProvider{}, tm,
+				newTestOIDCLimiter(t), config.OIDCConfig{StateTTL: time.Minute, AutoCreate: tt.autoCreate})
+
+			login, err := oidcService.StartLogin(context.Background(), tt.linkUserID, "10.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signin, err := oidcService.Callback(context.Background(), tt.subject, login.State, domain.SessionClient{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Callback() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if signin.Tokens.AccessToken != "access-"+tt.wantUserID || signin.ChallengeToken != "" {
+				t.Errorf("signin = %+v, want the tokens of %q", signin, tt.wantUserID)
+			}
+
+			identity, _ := repo.GetUserIdentity(context.Background(), testIssuer, tt.subject)
+			if identity.UserID != tt.wantUserID {
+				t.Errorf("identity linked to %q, want %q", identity.UserID, tt.wantUserID)
+			}
+
+			if tt.autoCreate && (len(users.registered) != 1 || users.registered[0].Login != "gopher@example.com") {
+				t.Errorf("registered = %+v, want a user with the verified email as login", users.registered)
+			}
+
+			// the state is single-use
+			if _, err := oidcService.Callback(context.Background(), tt.subject, login.State,
+				domain.SessionClient{}); !errors.Is(err, auth.ErrInvalidOIDCState) {
+				t.Errorf("reused state error = %v, want %v", err, auth.ErrInvalidOIDCState)
+			}
+		})
+	}
+}
+
+// TestOIDCService_CallbackTwoFactor loads the users with the UserService, so that
+// the two-factor flag comes from the repository like in production.
+func TestOIDCService_CallbackTwoFactor(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		twoFactor     bool
+		wantChallenge bool
+	}{
+		{name: "two-factor user gets a challenge", twoFactor: true, wantChallenge: true},
+		{name: "other user gets the tokens"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := newTestUser(t, "user-1", "alice", "correct horse")
+			user.TwoFactorEnabled = tt.twoFactor
+
+			us, tm, _ := newTestUserService(t, &fakeUserRepo{users: map[string]domain.User{"user-1": user}},
+				&fakeLoginLimiter{})
+
+			repo := newFakeOIDCRepo()
+			repo.identities[testIssuer+"|linked-subject"] = domain.UserIdentity{
+				UserID:  "user-1",
+				Issuer:  testIssuer,
+				Subject: "linked-subject",
+			}
+
+			oidcService, _ := NewOIDCService(repo, us, fakeOIDCChallenges{}, &fakeOIDCProvider{}, tm,
+				newTestOIDCLimiter(t), config.OIDCConfig{StateTTL: time.Minute})
+
+			login, err := oidcService.StartLogin(ctx, "", "10.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signin, err := oidcService.Callback(ctx, "linked-subject", login.State, domain.SessionClient{})
+			if err != nil {
+				t.Fatalf("Callback() error = %v", err)
+			}
+
+			if tt.wantChallenge {
+				if signin.ChallengeToken != "challenge-user-1" || signin.Tokens.AccessToken != "" {
+					t.Errorf("signin = %+v, want only a challenge", signin)
+				}
+				return
+			}
+
+			if signin.Tokens.AccessToken == "" || signin.ChallengeToken != "" {
+				t.Errorf("signin = %+v, want the tokens", signin)
+			}
+		})
+	}
+}
+
+func TestOIDCService_StartLoginThrottle(t *testing.T) {
+	ctx := context.Background()
+
+	tm, err := auth.NewManager(config.JWTConfig{SigningKey: "secret", AccessTokenTTL: time.Minute},
+		hash.NewSHA256Hasher("salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := newFakeOIDCRepo()
+	oidcService, _ := NewOIDCService(repo, &fakeOIDCUsers{}, fakeOIDCChallenges{}, &fakeOIDCProvider{}, tm,
+		newTestOIDCLimiter(t), config.OIDCConfig{StateTTL: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		if _, err := oidcService.StartLogin(ctx, "", "10.0.0.1"); err != nil {
+			t.Fatalf("sign-in %d: StartLogin() error = %v", i+1, err)
+		}
+	}
+
+	if _, err := oidcService.StartLogin(ctx, "", "10.0.0.1"); !errors.Is(err, throttle.ErrTooManyAttempts) {
+		t.Errorf("StartLogin() error = %v, want %v", err, throttle.ErrTooManyAttempts)
+	}
+
+	if len(repo.states) != 3 {
+		t.Errorf("stored %d states, want 3", len(repo.states))
+	}
+
+	// other clients are not affected
+	if _, err := oidcService.StartLogin(ctx, "", "10.0.0.2"); err != nil {
+		t.Errorf("StartLogin() from another IP error = %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/validator"
+	"github.com/mihailtudos/gophermart/pkg/breach"
+)
+
+// minLoginLength keeps very short logins from banning every password containing them
+const minLoginLength = 3
+
+type BreachChecker interface {
+	Breached(password string) (bool, error)
+}
+
+// PasswordPolicy checks new passwords, on sign-up, change and reset, against the
+// configured rules. It is not applied at sign-in so that existing passwords keep working.
+type PasswordPolicy struct {
+	cfg      config.PasswordPolicyConfig
+	banned   map[string]struct{}
+	breached BreachChecker
+}
+
+func NewPasswordPolicy(cfg config.PasswordPolicyConfig) (*PasswordPolicy, error) {
+	pp := &PasswordPolicy{cfg: cfg, banned: make(map[string]struct{})}
+
+	if cfg.BannedFile != "" {
+		if err := pp.loadBanned(cfg.BannedFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.BreachedDir != "" {
+		index, err := breach.NewIndex(cfg.BreachedDir, cfg.BreachedMinCount)
+		if err != nil {
+			return nil, err
+		}
+
+		pp.breached = index
+	}
+
+	return pp, nil
+}
+
+func (pp *PasswordPolicy) loadBanned(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open the banned passwords file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if password := strings.TrimSpace(scanner.Text()); password != "" {
+			pp.banned[strings.ToLower(password)] = struct{}{}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// ValidatePassword records the violations under the key, login may be empty when
+// it is not known. The error is only set when the breached-password check failed.
+func (pp *PasswordPolicy) ValidatePassword(v *validator.Validator, key, login, password string) error {
+	errs := validator.New()
+
+	domain.ValidatePasswordPlaintext(errs, password)
+	errs.Check(len(password) >= pp.cfg.MinLength, "password",
+		fmt.Sprintf("must be at least %d bytes long", pp.cfg.MinLength))
+	errs.Check(charClasses(password) >= pp.cfg.MinCharClasses, "password",
+		fmt.Sprintf("must use at least %d of lower case letters, upper case letters, digits and symbols",
+			pp.cfg.MinCharClasses))
+
+	if pp.cfg.ForbidLogin && len(login) >= minLoginLength {
+		errs.Check(!strings.Contains(strings.ToLower(password), strings.ToLower(login)), "password",
+			"must not contain the login")
+	}
+
+	_, banned := pp.banned[strings.ToLower(password)]
+	errs.Check(!banned, "password", "is too common")
+
+	// the breached-password check is the most expensive one, it is only run on otherwise valid passwords
+	if errs.Valid() && pp.breached != nil {
+		breached, err := pp.breached.Breached(password)
+		if err != nil {
+			return fmt.Errorf("failed to check the breached passwords: %w", err)
+		}
+
+		errs.Check(!breached, "password", "has appeared in a data breach, please choose another one")
+	}
+
+	for _, message := range errs.Errors {
+		v.AddError(key, message)
+	}
+
+	return nil
+}
+
+// charClasses counts the classes of characters used among lower case, upper case, digits and symbols.
+func charClasses(password string) int {
+	var lower, upper, digit, symbol int
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+
+	return lower + upper + digit + symbol
+}
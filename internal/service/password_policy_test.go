@@ -0,0 +1,74 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/validator"
+)
+
+func TestPasswordPolicy_ValidatePassword(t *testing.T) {
+	dir := t.TempDir()
+
+	banned := filepath.Join(dir, "banned.txt")
+	if err := os.WriteFile(banned, []byte("Gophermart2024\n\nletmein99\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// SHA-1("Password123") is B2E98AD6F6EB8508DD6A14CFA704BAD7F05F6FB1
+	breached := filepath.Join(dir, "breached")
+	if err := os.Mkdir(breached, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(breached, "B2E98.txt"),
+		[]byte("AD6F6EB8508DD6A14CFA704BAD7F05F6FB1:3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pp, err := NewPasswordPolicy(config.PasswordPolicyConfig{
+		MinLength:        10,
+		MinCharClasses:   3,
+		ForbidLogin:      true,
+		BannedFile:       banned,
+		BreachedDir:      breached,
+		BreachedMinCount: 1,
+	})
+	if err != nil {
+		t.Fatalf("NewPasswordPolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		want     string
+	}{
+		{name: "valid", login: "alice", password: "Correct-Horse-7", want: ""},
+		{name: "too short", login: "alice", password: "Ab1-xyz", want: "must be at least 8 bytes long"},
+		{name: "below the configured length", login: "alice", password: "Ab1-xyzab",
+			want: "must be at least 10 bytes long"},
+		{name: "too few character classes", login: "alice", password: "correcthorse7",
+			want: "must use at least 3 of lower case letters, upper case letters, digits and symbols"},
+		{name: "contains the login", login: "Alice", password: "my-ALICE-pass1",
+			want: "must not contain the login"},
+		{name: "unknown login", login: "", password: "my-alice-pass1", want: ""},
+		{name: "banned", login: "alice", password: "GOPHERmart2024", want: "is too common"},
+		{name: "breached", login: "alice", password: "Password123",
+			want: "has appeared in a data breach, please choose another one"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			if err := pp.ValidatePassword(v, "new_password", tt.login, tt.password); err != nil {
+				t.Fatalf("ValidatePassword() error = %v", err)
+			}
+
+			if got := v.Errors["new_password"]; got != tt.want {
+				t.Errorf("ValidatePassword() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/notifier"
+	"github.com/mihailtudos/gophermart/internal/repository"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+)
+
+const (
+	passwordResetTokenBytes  = 32
+	passwordResetSendTimeout = 30 * time.Second
+)
+
+type PasswordResetUsers interface {
+	GetUserByLogin(ctx context.Context, login string) (domain.User, error)
+}
+
+type PasswordResetService struct {
+	repo         repository.PasswordResetRepo
+	users        PasswordResetUsers
+	tokenManager TokenManager
+	revocations  TokenRevoker
+	// limiter counts every request as a failure, it is scoped apart from the sign-in
+	limiter LoginLimiter
+	sender  notifier.Sender
+	cfg     config.PasswordResetConfig
+}
+
+func NewPasswordResetService(repo repository.PasswordResetRepo,
+	users PasswordResetUsers,
+	tm TokenManager,
+	revocations TokenRevoker,
+	limiter LoginLimiter,
+	sender notifier.Sender,
+	cfg config.PasswordResetConfig) (*PasswordResetService, error) {
+	return &PasswordResetService{
+		repo:         repo,
+		users:        users,
+		tokenManager: tm,
+		revocations:  revocations,
+		limiter:      limiter,
+		sender:       sender,
+		cfg:          cfg,
+	}, nil
+}
+
+// ForgotPassword sends a reset link to the user in the background, so that
+// neither the response nor its timing tells whether the login exists. The requests
+// are throttled per login and per client IP whether the login exists or not.
+func (ps *PasswordResetService) ForgotPassword(ctx context.Context, login, ip string) error {
+	if err := ps.limiter.Allow(ctx, login, ip); err != nil {
+		return err
+	}
+
+	if err := ps.limiter.Failure(ctx, login, ip); err != nil {
+		return fmt.Errorf("failed to record password reset request: %w", err)
+	}
+
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				logger.Log.Warn("recover from panic ", slog.Any("err", p))
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), passwordResetSendTimeout)
+		defer cancel()
+
+		if err := ps.sendResetLink(ctx, login); err != nil {
+			logger.Log.ErrorContext(ctx, "failed to send password reset link",
+				slog.String("err", err.Error()))
+		}
+	}()
+
+	return nil
+}
+
+func (ps *PasswordResetService) sendResetLink(ctx context.Context, login string) error {
+	user, err := ps.users.GetUserByLogin(ctx, login)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			return nil
+		}
+
+		return err
+	}
+
+	b := make([]byte, passwordResetTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(b)
+
+	tokenHash, err := ps.tokenManager.HashToken(token)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().UTC().Add(ps.cfg.TokenTTL)
+	if err := ps.repo.CreatePasswordResetToken(ctx, user.ID, tokenHash, expiresAt); err != nil {
+		return err
+	}
+
+	link, err := url.Parse(ps.cfg.URL)
+	if err != nil {
+		return fmt.Errorf("invalid password reset URL: %w", err)
+	}
+
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+
+	// an unverified email may have a typo in it, the login is used as the recipient then
+	to := user.Login
+	if user.EmailVerified() {
+		to = user.Email
+	}
+
+	return ps.sender.Send(ctx, notifier.Message{
+		To:      to,
+		Subject: "Reset your Gophermart password",
+		Body: fmt.Sprintf("Use the link below to choose a new password, it expires in %s.\n\n%s\n\n"+
+			"If you did not ask for a password reset you can ignore this message.",
+			ps.cfg.TokenTTL, link.String()),
+	})
+}
+
+// ResetPassword consumes the reset token and sets the new password, the sessions of the
+// user are revoked along with it and the access tokens issued so far right after. It fails
+// with ErrNoRowsFound for unknown, used or expired tokens.
+func (ps *PasswordResetService) ResetPassword(ctx context.Context, input domain.PasswordResetInput) error {
+	tokenHash, err := ps.tokenManager.HashToken(input.Token)
+	if err != nil {
+		return err
+	}
+
+	var user domain.User
+	if err := user.Password.Set(input.Password); err != nil {
+		return err
+	}
+
+	userID, err := ps.repo.ResetPassword(ctx, tokenHash, user.Password.Hash, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return ps.revocations.RevokeUser(ctx, userID)
+}
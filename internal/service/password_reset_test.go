@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/internal/service/throttle"
+	"github.com/mihailtudos/gophermart/pkg/hash"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeLoginAttemptsRepo keeps the throttle counters in memory so that the real
+// limiter can be used in the tests.
+type fakeLoginAttemptsRepo struct {
+	mu       sync.Mutex
+	attempts map[string]domain.LoginAttempts
+}
+
+func (f *fakeLoginAttemptsRepo) GetLoginAttempts(_ context.Context, key string) (domain.LoginAttempts, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	a, ok := f.attempts[key]
+	if !ok {
+		return domain.LoginAttempts{}, postgres.ErrNoRowsFound
+	}
+
+	return a, nil
+}
+
+func (f *fakeLoginAttemptsRepo) RecordLoginFailure(_ context.Context,
+	key string, failedAt, windowStart time.Time) (domain.LoginAttempts, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.attempts == nil {
+		f.attempts = make(map[string]domain.LoginAttempts)
+	}
+
+	a, ok := f.attempts[key]
+	if !ok || a.LastFailedAt.Before(windowStart) {
+		a = domain.LoginAttempts{Key: key, LockedUntil: a.LockedUntil}
+	}
+
+	a.Failures++
+	a.LastFailedAt = failedAt
+	f.attempts[key] = a
+
+	return a, nil
+}
+
+func (f *fakeLoginAttemptsRepo) LockLogin(_ context.Context, key string, until time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	a := f.attempts[key]
+	a.LockedUntil = &until
+	f.attempts[key] = a
+
+	return nil
+}
+
+func (f *fakeLoginAttemptsRepo) ResetLoginAttempts(_ context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.attempts, key)
+	return nil
+}
+
+func (f *fakeLoginAttemptsRepo) DeleteStaleLoginAttempts(_ context.Context, _, _ string, _ time.Time) error {
+	return nil
+}
+
+type fakePasswordResetRepo struct {
+	// tokens maps the token hashes to the users they were issued for
+	tokens map[string]string
+	reset  []string
+}
+
+func (f *fakePasswordResetRepo) CreatePasswordResetToken(_ context.Context, userID, tokenHash string,
+	_ time.Time) error {
+	f.tokens[tokenHash] = userID
+	return nil
+}
+
+func (f *fakePasswordResetRepo) ResetPassword(_ context.Context, tokenHash string, _ []byte,
+	_ time.Time) (string, error) {
+	userID, ok := f.tokens[tokenHash]
+	if !ok {
+		return "", postgres.ErrNoRowsFound
+	}
+
+	delete(f.tokens, tokenHash)
+	f.reset = append(f.reset, userID)
+
+	return userID, nil
+}
+
+// unknownUsers knows no login, the reset links are never sent.
+type unknownUsers struct{}
+
+func (unknownUsers) GetUserByLogin(_ context.Context, _ string) (domain.User, error) {
+	return domain.User{}, postgres.ErrNoRowsFound
+}
+
+func newTestPasswordResetService(t *testing.T,
+	repo *fakePasswordResetRepo) (*PasswordResetService, *auth.Manager, *fakeRevocationRepo) {
+	t.Helper()
+	logger.Init(io.Discard, "error")
+
+	if err := domain.SetPasswordCost(bcrypt.MinCost); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = domain.SetPasswordCost(domain.DefaultPasswordCost) })
+
+	tm, err := auth.NewManager(config.JWTConfig{SigningKey: "secret", AccessTokenTTL: time.Minute},
+		hash.NewSHA256Hasher("salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limiter, err := throttle.NewScopedLimiter(&fakeLoginAttemptsRepo{}, "password-reset", config.LoginThrottleConfig{
+		FreeAttempts:       10,
+		LoginLockThreshold: 3,
+		IPLockThreshold:    5,
+		LockoutDuration:    time.Hour,
+		FailureWindow:      time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revocationRepo := &fakeRevocationRepo{}
+	revocations, _ := NewRevocationList(revocationRepo, time.Minute)
+
+	ps, _ := NewPasswordResetService(repo, unknownUsers{}, tm, revocations, limiter, &fakeSender{},
+		config.PasswordResetConfig{TokenTTL: time.Minute, URL: "http://localhost/reset"})
+
+	return ps, tm, revocationRepo
+}
+
+func TestPasswordResetService_ForgotPasswordThrottle(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		// request returns the login and the IP of the i-th request
+		request func(i int) (string, string)
+		allowed int
+	}{
+		{name: "same login from many IPs", request: func(i int) (string, string) {
+			return "alice", fmt.Sprintf("10.0.0.%d", i+1)
+		}, allowed: 3},
+		{name: "many logins from the same IP", request: func(i int) (string, string) {
+			return fmt.Sprintf("user%d", i), "10.0.0.1"
+		}, allowed: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps, _, _ := newTestPasswordResetService(t, &fakePasswordResetRepo{tokens: map[string]string{}})
+
+			for i := 0; i < tt.allowed; i++ {
+				login, ip := tt.request(i)
+				if err := ps.ForgotPassword(ctx, login, ip); err != nil {
+					t.Fatalf("request %d: ForgotPassword() error = %v", i+1, err)
+				}
+			}
+
+			login, ip := tt.request(tt.allowed)
+			if err := ps.ForgotPassword(ctx, login, ip); !errors.Is(err, throttle.ErrTooManyAttempts) {
+				t.Errorf("ForgotPassword() error = %v, want %v", err, throttle.ErrTooManyAttempts)
+			}
+		})
+	}
+}
+
+func TestPasswordResetService_ResetPassword(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "valid token", token: "reset-token"},
+		{name: "unknown token", token: "other-token", wantErr: postgres.ErrNoRowsFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakePasswordResetRepo{tokens: map[string]string{}}
+			ps, tm, revocationRepo := newTestPasswordResetService(t, repo)
+
+			tokenHash, err := tm.HashToken("reset-token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			repo.tokens[tokenHash] = "user-1"
+
+			err = ps.ResetPassword(ctx, domain.PasswordResetInput{Token: tt.token, Password: "battery staple"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ResetPassword() error = %v, want %v", err, tt.wantErr)
+			}
+
+			wantRevoked := 0
+			if tt.wantErr == nil {
+				wantRevoked = 1
+			}
+
+			if len(repo.reset) != wantRevoked || len(revocationRepo.revocations) != wantRevoked {
+				t.Fatalf("reset %d passwords and revoked %d users, want %d", len(repo.reset),
+					len(revocationRepo.revocations), wantRevoked)
+			}
+
+			if wantRevoked == 1 && *revocationRepo.revocations[0].UserID != "user-1" {
+				t.Errorf("revoked the tokens of %s, want user-1", *revocationRepo.revocations[0].UserID)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/repository"
+)
+
+// RevocationList keeps the revoked access tokens in memory so that verifying a
+// token does not hit the database. Revocations are written to the database first
+// and the cache is refreshed periodically to pick up the ones made by other instances.
+type RevocationList struct {
+	repo     repository.RevocationRepo
+	tokenTTL time.Duration
+
+	mu       sync.RWMutex
+	tokens   map[string]time.Time
+	sessions map[string]revocationCutoff
+	users    map[string]revocationCutoff
+}
+
+// revocationCutoff revokes every token issued up to revokedAt.
+type revocationCutoff struct {
+	revokedAt time.Time
+	expiresAt time.Time
+}
+
+func NewRevocationList(repo repository.RevocationRepo, tokenTTL time.Duration) (*RevocationList, error) {
+	return &RevocationList{
+		repo:     repo,
+		tokenTTL: tokenTTL,
+		tokens:   make(map[string]time.Time),
+		sessions: make(map[string]revocationCutoff),
+		users:    make(map[string]revocationCutoff),
+	}, nil
+}
+
+// IsRevoked reports whether the access token was revoked, either by itself or
+// through its session or user.
+func (rl *RevocationList) IsRevoked(claims domain.TokenClaims) bool {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	if _, ok := rl.tokens[claims.ID]; ok && claims.ID != "" {
+		return true
+	}
+
+	if c, ok := rl.sessions[claims.SessionID]; ok && claims.SessionID != "" && !claims.IssuedAt.After(c.revokedAt) {
+		return true
+	}
+
+	if c, ok := rl.users[claims.UserID]; ok && !claims.IssuedAt.After(c.revokedAt) {
+		return true
+	}
+
+	return false
+}
+
+func (rl *RevocationList) RevokeToken(ctx context.Context, jti string) error {
+	return rl.revoke(ctx, domain.TokenRevocation{JTI: &jti})
+}
+
+func (rl *RevocationList) RevokeSession(ctx context.Context, sessionID string) error {
+	return rl.revoke(ctx, domain.TokenRevocation{SessionID: &sessionID})
+}
+
+func (rl *RevocationList) RevokeUser(ctx context.Context, userID string) error {
+	return rl.revoke(ctx, domain.TokenRevocation{UserID: &userID})
+}
+
+func (rl *RevocationList) revoke(ctx context.Context, revocation domain.TokenRevocation) error {
+	// the tokens carry their issue time in microseconds, the precision the database
+	// keeps, so a token issued in the same second as the revocation is told apart
+	revocation.RevokedAt = time.Now().UTC().Truncate(time.Microsecond)
+	revocation.ExpiresAt = revocation.RevokedAt.Add(rl.tokenTTL)
+
+	if err := rl.repo.RevokeTokens(ctx, revocation); err != nil {
+		return err
+	}
+
+	rl.mu.Lock()
+	rl.add(revocation)
+	rl.mu.Unlock()
+
+	return nil
+}
+
+// add must be called with the lock held.
+func (rl *RevocationList) add(r domain.TokenRevocation) {
+	cutoff := revocationCutoff{revokedAt: r.RevokedAt, expiresAt: r.ExpiresAt}
+
+	switch {
+	case r.JTI != nil:
+		rl.tokens[*r.JTI] = r.ExpiresAt
+	case r.SessionID != nil:
+		if c, ok := rl.sessions[*r.SessionID]; !ok || c.revokedAt.Before(cutoff.revokedAt) {
+			rl.sessions[*r.SessionID] = cutoff
+		}
+	case r.UserID != nil:
+		if c, ok := rl.users[*r.UserID]; !ok || c.revokedAt.Before(cutoff.revokedAt) {
+			rl.users[*r.UserID] = cutoff
+		}
+	}
+}
+
+// Refresh reloads the revocations from the database and drops the expired ones.
+func (rl *RevocationList) Refresh(ctx context.Context) error {
+	revocations, err := rl.repo.GetTokenRevocations(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	// revocations never get lifted, so entries made while loading are kept
+	for jti, expiresAt := range rl.tokens {
+		if !expiresAt.After(now) {
+			delete(rl.tokens, jti)
+		}
+	}
+
+	for id, c := range rl.sessions {
+		if !c.expiresAt.After(now) {
+			delete(rl.sessions, id)
+		}
+	}
+
+	for id, c := range rl.users {
+		if !c.expiresAt.After(now) {
+			delete(rl.users, id)
+		}
+	}
+
+	for _, r := range revocations {
+		rl.add(r)
+	}
+
+	return nil
+}
+
+func (rl *RevocationList) RefreshInBackground(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				logger.Log.Warn("recover from panic ", slog.Any("err", p))
+			}
+		}()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := rl.Refresh(ctx); err != nil {
+					logger.Log.Error("refresh token revocations", slog.String("err", err.Error()))
+				}
+
+				if err := rl.repo.DeleteExpiredTokenRevocations(ctx); err != nil {
+					logger.Log.Error("purge token revocations", slog.String("err", err.Error()))
+				}
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
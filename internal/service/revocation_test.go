@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/domain"
+)
+
+type fakeRevocationRepo struct {
+	revocations []domain.TokenRevocation
+}
+
+func (f *fakeRevocationRepo) RevokeTokens(_ context.Context, revocation domain.TokenRevocation) error {
+	f.revocations = append(f.revocations, revocation)
+	return nil
+}
+
+func (f *fakeRevocationRepo) GetTokenRevocations(_ context.Context) ([]domain.TokenRevocation, error) {
+	return f.revocations, nil
+}
+
+func (f *fakeRevocationRepo) DeleteExpiredTokenRevocations(_ context.Context) error {
+	return nil
+}
+
+func TestRevocationList_IsRevoked(t *testing.T) {
+	ctx := context.Background()
+	before := time.Now().Add(-time.Minute)
+	after := time.Now().Add(time.Minute)
+
+	rl, _ := NewRevocationList(&fakeRevocationRepo{}, time.Hour)
+	if err := rl.RevokeToken(ctx, "jti-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.RevokeSession(ctx, "session-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.RevokeUser(ctx, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the tokens issued in the same second as a revocation are told apart by their microseconds
+	cutoff := rl.users["user-1"].revokedAt
+	justBefore, justAfter := cutoff.Add(-time.Microsecond), cutoff.Add(time.Microsecond)
+
+	tests := []struct {
+		name   string
+		claims domain.TokenClaims
+		want   bool
+	}{
+		{
+			name:   "revoked jti",
+			claims: domain.TokenClaims{ID: "jti-1", UserID: "user-2", IssuedAt: after},
+			want:   true,
+		},
+		{
+			name:   "token of a revoked session",
+			claims: domain.TokenClaims{ID: "jti-2", UserID: "user-2", SessionID: "session-1", IssuedAt: before},
+			want:   true,
+		},
+		{
+			name:   "token of a revoked user",
+			claims: domain.TokenClaims{ID: "jti-2", UserID: "user-1", SessionID: "session-2", IssuedAt: before},
+			want:   true,
+		},
+		{
+			name:   "token issued after the user revocation",
+			claims: domain.TokenClaims{ID: "jti-2", UserID: "user-1", SessionID: "session-2", IssuedAt: after},
+			want:   false,
+		},
+		{
+			name:   "token issued at the user revocation",
+			claims: domain.TokenClaims{ID: "jti-2", UserID: "user-1", SessionID: "session-2", IssuedAt: cutoff},
+			want:   true,
+		},
+		{
+			name:   "token issued just before the user revocation",
+			claims: domain.TokenClaims{ID: "jti-2", UserID: "user-1", SessionID: "session-2", IssuedAt: justBefore},
+			want:   true,
+		},
+		{
+			name:   "token issued just after the user revocation",
+			claims: domain.TokenClaims{ID: "jti-2", UserID: "user-1", SessionID: "session-2", IssuedAt: justAfter},
+			want:   false,
+		},
+		{
+			name:   "unrelated token",
+			claims: domain.TokenClaims{ID: "jti-3", UserID: "user-2", SessionID: "session-2", IssuedAt: before},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rl.IsRevoked(tt.claims); got != tt.want {
+				t.Errorf("IsRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevocationList_Refresh(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	jti, expiredJTI := "from-db", "expired"
+
+	repo := &fakeRevocationRepo{revocations: []domain.TokenRevocation{
+		{JTI: &jti, RevokedAt: now, ExpiresAt: now.Add(time.Hour)},
+	}}
+
+	rl, _ := NewRevocationList(repo, time.Hour)
+	rl.tokens[expiredJTI] = now.Add(-time.Second)
+	rl.tokens["local"] = now.Add(time.Hour)
+
+	if err := rl.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if !rl.IsRevoked(domain.TokenClaims{ID: jti}) {
+		t.Error("revocation loaded from the database is missing")
+	}
+
+	if !rl.IsRevoked(domain.TokenClaims{ID: "local"}) {
+		t.Error("unexpired local revocation was dropped")
+	}
+
+	if _, ok := rl.tokens[expiredJTI]; ok {
+		t.Error("expired revocation was kept")
+	}
+}
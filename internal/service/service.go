@@ -11,18 +11,52 @@ import (
 )
 
 type TokenManager interface {
-	NewJWT(userID string, ttl *time.Duration) (string, error)
-	Parse(accessToken string) (string, error)
+	NewJWT(userID, sessionID, role string, ttl *time.Duration) (string, error)
+	Parse(accessToken string) (domain.TokenClaims, error)
 	NewRefreshToken() (string, error)
+	HashToken(token string) (string, error)
 	CreateSession(userID string, token string) (domain.Session, error)
+	NewChallengeToken(userID string, ttl time.Duration) (string, error)
+	ParseChallengeToken(token string) (domain.ChallengeClaims, error)
 }
 
 type Auth interface {
-	GenerateUserTokens(ctx context.Context, userID string) (domain.Tokens, error)
-	SetSessionToken(ctx context.Context, userID string, tokens string) error
-	Login(ctx context.Context, input domain.UserAuthInput) (domain.User, error)
+	GenerateUserTokens(ctx context.Context, userID string, client domain.SessionClient) (domain.Tokens, error)
+	RefreshTokens(ctx context.Context, refreshToken string, client domain.SessionClient) (domain.Tokens, error)
+	Login(ctx context.Context, input domain.UserAuthInput, client domain.SessionClient) (domain.User, error)
 	Register(ctx context.Context, user domain.User) (string, error)
-	VerifyToken(ctx context.Context, token string) (string, error)
+	VerifyToken(ctx context.Context, token string) (domain.TokenClaims, error)
+	GetUserSessions(ctx context.Context, userID string) ([]domain.UserSession, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	RevokeAllSessions(ctx context.Context, userID string) error
+	Logout(ctx context.Context, claims domain.TokenClaims) error
+	ChangePassword(ctx context.Context,
+		userID string,
+		input domain.ChangePasswordInput,
+		client domain.SessionClient) (domain.Tokens, error)
+}
+
+type EventBroker interface {
+	Publish(ctx context.Context, userID string, event domain.Event)
+	Subscribe(userID string) (<-chan domain.Event, func())
+}
+
+type TokenRevoker interface {
+	IsRevoked(claims domain.TokenClaims) bool
+	RevokeToken(ctx context.Context, jti string) error
+	RevokeSession(ctx context.Context, sessionID string) error
+	RevokeUser(ctx context.Context, userID string) error
+}
+
+type LoginLimiter interface {
+	Allow(ctx context.Context, login, ip string) error
+	Failure(ctx context.Context, login, ip string) error
+	Success(ctx context.Context, login string) error
+}
+
+// RateLimiter caps the requests per key, without the delays of the LoginLimiter.
+type RateLimiter interface {
+	Allow(key string) error
 }
 
 type AccrualClient interface {
@@ -34,17 +68,26 @@ type UserManager interface {
 	GetUserBalance(ctx context.Context, userID string) (domain.UserBalance, error)
 	WithdrawalPoints(ctx context.Context, wp domain.Withdrawal) (string, error)
 	GetWithdrawals(ctx context.Context, userID string) ([]domain.Withdrawal, error)
+	SubscribeEvents(userID string) (<-chan domain.Event, func())
 	OrderService
 	Auth
 }
 
 type OrderService interface {
-	UpdateOrder(ctx context.Context, updateOrder domain.Order) error
+	UpdateOrder(ctx context.Context, updateOrder domain.Order) (domain.OrderStatusChange, error)
+	GetUserOrderStatusChanges(ctx context.Context, userID, sinceID string) ([]domain.OrderStatusChange, error)
 	RegisterOrder(ctx context.Context, order domain.Order) (domain.Order, error)
 	GetUserOrders(ctx context.Context, userID string) ([]domain.UserOrder, error)
-	GetUnfinishedOrders(ctx context.Context) ([]domain.Order, error)
+	GetUserOrder(ctx context.Context, userID, orderNumber string) (domain.UserOrderDetails, error)
+	GetUnfinishedOrders(ctx context.Context, lease time.Duration) ([]domain.Order, error)
+	ReleaseOrderLease(ctx context.Context, orderNumber string) error
+	CancelOrder(ctx context.Context, userID, orderNumber string) (domain.OrderStatusChange, error)
 }
 
+// orderLeaseDuration is how long an order is reserved for the poller, it covers
+// the accrual client timeout so that a slow request does not lose the lease.
+const orderLeaseDuration = 2 * time.Minute
+
 type Services struct {
 	UserService   UserManager
 	TokenManager  TokenManager
@@ -86,7 +129,7 @@ func (ss *Services) UpdateOrdersInBackground(ctx context.Context, jobInterval ti
 }
 
 func (ss *Services) updateOrders(ctx context.Context) {
-	orders, err := ss.UserService.GetUnfinishedOrders(ctx)
+	orders, err := ss.UserService.GetUnfinishedOrders(ctx, orderLeaseDuration)
 	if err != nil {
 		logger.Log.Error("update orders: get unfinished orders", slog.String("err", err.Error()))
 		return
@@ -104,13 +147,15 @@ func (ss *Services) updateOrders(ctx context.Context) {
 		updateOrder, err := ss.AccrualClient.GetOrderInfo(ctx, order)
 		if err != nil {
 			logger.Log.Error("update orders: get order info", slog.String("err", err.Error()))
+			ss.releaseOrder(ctx, order)
 			continue
 		}
 
 		fmt.Printf("GetOrderInfo %#v", updateOrder)
 
 		if order.OrderStatus != updateOrder.OrderStatus {
-			err := ss.UserService.UpdateOrder(ctx, updateOrder)
+			updateOrder.StatusSource = domain.OrderStatusSourcePoller
+			_, err := ss.UserService.UpdateOrder(ctx, updateOrder)
 
 			if err != nil {
 				logger.Log.Error("failed to update the order status", slog.String("err", err.Error()))
@@ -120,5 +165,12 @@ func (ss *Services) updateOrders(ctx context.Context) {
 		}
 
 		logger.Log.Info("skipping order " + order.OrderNumber)
+		ss.releaseOrder(ctx, order)
+	}
+}
+
+func (ss *Services) releaseOrder(ctx context.Context, order domain.Order) {
+	if err := ss.UserService.ReleaseOrderLease(ctx, order.OrderNumber); err != nil {
+		logger.Log.Error("update orders: release order lease", slog.String("err", err.Error()))
 	}
 }
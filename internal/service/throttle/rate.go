@@ -0,0 +1,96 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/logger"
+)
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// RateLimiter lets a key through at most limit times per window, it has no delays
+// nor lockouts so that a key shared by many clients, like the IP of a NAT, is only
+// slowed down while it is over the limit. The counters are kept in memory, every
+// instance limits on its own.
+type RateLimiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]rateWindow
+}
+
+func NewRateLimiter(limit int, window time.Duration) (*RateLimiter, error) {
+	if limit <= 0 || window <= 0 {
+		return nil, errors.New("the rate limit and its window must be positive")
+	}
+
+	return &RateLimiter{
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		windows: make(map[string]rateWindow),
+	}, nil
+}
+
+// Allow counts a request for the key, it fails with a RetryError once the limit
+// of the current window is reached.
+func (rl *RateLimiter) Allow(key string) error {
+	now := rl.now()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	w, ok := rl.windows[key]
+	if !ok || !now.Before(w.start.Add(rl.window)) {
+		w = rateWindow{start: now}
+	}
+
+	if w.count >= rl.limit {
+		return &RetryError{RetryAfter: w.start.Add(rl.window).Sub(now)}
+	}
+
+	w.count++
+	rl.windows[key] = w
+
+	return nil
+}
+
+// CleanupInBackground periodically drops the windows that are over.
+func (rl *RateLimiter) CleanupInBackground(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				logger.Log.Warn("recover from panic ", slog.Any("err", p))
+			}
+		}()
+
+		for {
+			select {
+			case <-ticker.C:
+				now := rl.now()
+
+				rl.mu.Lock()
+				for key, w := range rl.windows {
+					if !now.Before(w.start.Add(rl.window)) {
+						delete(rl.windows, key)
+					}
+				}
+				rl.mu.Unlock()
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,52 @@
+package throttle
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	rl, err := NewRateLimiter(3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1727600000, 0)
+	rl.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if err := rl.Allow("10.0.0.1"); err != nil {
+			t.Fatalf("request %d: Allow() error = %v", i+1, err)
+		}
+	}
+
+	err = rl.Allow("10.0.0.1")
+
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || retryErr.RetryAfter != time.Minute {
+		t.Fatalf("Allow() over the limit error = %v, want a retry after %s", err, time.Minute)
+	}
+
+	// the other keys are not affected
+	if err := rl.Allow("10.0.0.2"); err != nil {
+		t.Errorf("Allow() for another key error = %v", err)
+	}
+
+	// the key is let through again once the window is over, without any lockout
+	now = now.Add(time.Minute)
+	if err := rl.Allow("10.0.0.1"); err != nil {
+		t.Errorf("Allow() in the next window error = %v", err)
+	}
+}
+
+func TestNewRateLimiter_Invalid(t *testing.T) {
+	for _, tt := range []struct {
+		limit  int
+		window time.Duration
+	}{{0, time.Minute}, {1, 0}} {
+		if _, err := NewRateLimiter(tt.limit, tt.window); err == nil {
+			t.Errorf("NewRateLimiter(%d, %s) expected an error", tt.limit, tt.window)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/repository"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+)
+
+const (
+	loginKeyPrefix = "login:"
+	ipKeyPrefix    = "ip:"
+
+	// cacheTTL bounds how long failures recorded by other instances go unnoticed
+	cacheTTL = 10 * time.Second
+)
+
+var ErrTooManyAttempts = errors.New("too many failed login attempts")
+
+// RetryError is returned while sign-ins are throttled, RetryAfter tells when
+// the next attempt will be accepted.
+type RetryError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RetryError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (e *RetryError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+type cachedAttempts struct {
+	attempts domain.LoginAttempts
+	loadedAt time.Time
+}
+
+// Limiter protects the sign-in against brute-force attacks. Failures are counted
+// per login, which gets progressively longer delays and a lockout, and per client
+// IP, which only gets locked out past a much higher threshold since an IP can be
+// shared by many users. The counters live in the database so that they survive
+// restarts, with an in-memory cache in front of them.
+type Limiter struct {
+	repo repository.LoginAttemptsRepo
+	cfg  config.LoginThrottleConfig
+	now  func() time.Time
+
+	// loginPrefix and ipPrefix keep the counters of scoped limiters apart
+	loginPrefix string
+	ipPrefix    string
+
+	mu    sync.Mutex
+	cache map[string]cachedAttempts
+}
+
+func NewLimiter(repo repository.LoginAttemptsRepo, cfg config.LoginThrottleConfig) (*Limiter, error) {
+	return NewScopedLimiter(repo, "", cfg)
+}
+
+// NewScopedLimiter returns a limiter whose counters are kept apart from the sign-in
+// ones, so that it can throttle another action per login and per IP.
+func NewScopedLimiter(repo repository.LoginAttemptsRepo,
+	scope string,
+	cfg config.LoginThrottleConfig) (*Limiter, error) {
+	if repo == nil {
+		return nil, errors.New("missing login attempts repository")
+	}
+
+	if scope != "" {
+		scope += ":"
+	}
+
+	return &Limiter{
+		repo:        repo,
+		cfg:         cfg,
+		now:         time.Now,
+		loginPrefix: scope + loginKeyPrefix,
+		ipPrefix:    scope + ipKeyPrefix,
+		cache:       make(map[string]cachedAttempts),
+	}, nil
+}
+
+// Allow fails with a RetryError when sign-ins for the login or from the IP are throttled.
+func (l *Limiter) Allow(ctx context.Context, login, ip string) error {
+	now := l.now()
+
+	var wait time.Duration
+	for _, key := range l.keys(login, ip) {
+		attempts, err := l.get(ctx, key, now)
+		if err != nil {
+			return err
+		}
+
+		if d := l.retryAfter(attempts, now); d > wait {
+			wait = d
+		}
+	}
+
+	if wait > 0 {
+		return &RetryError{RetryAfter: wait}
+	}
+
+	return nil
+}
+
+// Failure records a failed sign-in for the login and the IP.
+func (l *Limiter) Failure(ctx context.Context, login, ip string) error {
+	now := l.now()
+
+	for _, key := range l.keys(login, ip) {
+		attempts, err := l.repo.RecordLoginFailure(ctx, key, now, now.Add(-l.cfg.FailureWindow))
+		if err != nil {
+			return err
+		}
+
+		if attempts.Failures >= l.lockThreshold(key) {
+			until := now.Add(l.cfg.LockoutDuration)
+			if err := l.repo.LockLogin(ctx, key, until); err != nil {
+				return err
+			}
+
+			attempts.LockedUntil = &until
+			logger.Log.WarnContext(ctx, "security: sign-in locked after repeated failures",
+				slog.String("key", key),
+				slog.Int("failures", attempts.Failures))
+		}
+
+		l.store(key, attempts, now)
+	}
+
+	return nil
+}
+
+// Success resets the failures of the login, the IP counter is kept so that an
+// attacker can not clear it by signing in to an account of their own.
+func (l *Limiter) Success(ctx context.Context, login string) error {
+	key := l.loginKey(login)
+
+	if err := l.repo.ResetLoginAttempts(ctx, key); err != nil {
+		return err
+	}
+
+	l.store(key, domain.LoginAttempts{Key: key}, l.now())
+
+	return nil
+}
+
+func (l *Limiter) retryAfter(attempts domain.LoginAttempts, now time.Time) time.Duration {
+	var wait time.Duration
+
+	if attempts.LockedUntil != nil && attempts.LockedUntil.After(now) {
+		wait = attempts.LockedUntil.Sub(now)
+	}
+
+	if !strings.HasPrefix(attempts.Key, l.loginPrefix) ||
+		attempts.Failures <= l.cfg.FreeAttempts ||
+		attempts.LastFailedAt.Before(now.Add(-l.cfg.FailureWindow)) {
+		return wait
+	}
+
+	if d := attempts.LastFailedAt.Add(l.delay(attempts.Failures)).Sub(now); d > wait {
+		wait = d
+	}
+
+	return wait
+}
+
+// delay doubles BaseDelay for every failure past the free attempts.
+func (l *Limiter) delay(failures int) time.Duration {
+	d := l.cfg.BaseDelay
+	for i := l.cfg.FreeAttempts + 1; i < failures && d < l.cfg.MaxDelay; i++ {
+		d *= 2
+	}
+
+	if d > l.cfg.MaxDelay {
+		d = l.cfg.MaxDelay
+	}
+
+	return d
+}
+
+func (l *Limiter) lockThreshold(key string) int {
+	if strings.HasPrefix(key, l.ipPrefix) {
+		return l.cfg.IPLockThreshold
+	}
+
+	return l.cfg.LoginLockThreshold
+}
+
+func (l *Limiter) get(ctx context.Context, key string, now time.Time) (domain.LoginAttempts, error) {
+	l.mu.Lock()
+	cached, ok := l.cache[key]
+	l.mu.Unlock()
+
+	if ok && now.Sub(cached.loadedAt) < cacheTTL {
+		return cached.attempts, nil
+	}
+
+	attempts, err := l.repo.GetLoginAttempts(ctx, key)
+	if err != nil {
+		if !errors.Is(err, postgres.ErrNoRowsFound) {
+			return domain.LoginAttempts{}, err
+		}
+
+		attempts = domain.LoginAttempts{Key: key}
+	}
+
+	l.store(key, attempts, now)
+
+	return attempts, nil
+}
+
+func (l *Limiter) store(key string, attempts domain.LoginAttempts, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cache[key] = cachedAttempts{attempts: attempts, loadedAt: now}
+}
+
+// CleanupInBackground periodically drops the stale cache entries and the
+// failures that are past the failure window.
+func (l *Limiter) CleanupInBackground(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				logger.Log.Warn("recover from panic ", slog.Any("err", p))
+			}
+		}()
+
+		for {
+			select {
+			case <-ticker.C:
+				now := l.now()
+
+				l.mu.Lock()
+				for key, cached := range l.cache {
+					if now.Sub(cached.loadedAt) >= cacheTTL {
+						delete(l.cache, key)
+					}
+				}
+				l.mu.Unlock()
+
+				// the keys of the other scopes follow their own failure window
+				err := l.repo.DeleteStaleLoginAttempts(ctx, l.loginPrefix, l.ipPrefix, now.Add(-l.cfg.FailureWindow))
+				if err != nil {
+					logger.Log.Error("delete stale login attempts", slog.String("err", err.Error()))
+				}
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (l *Limiter) loginKey(login string) string {
+	// logins are case insensitive (citext)
+	return l.loginPrefix + strings.ToLower(login)
+}
+
+func (l *Limiter) keys(login, ip string) []string {
+	k := []string{l.loginKey(login)}
+	if ip != "" {
+		k = append(k, l.ipPrefix+ip)
+	}
+
+	return k
+}
@@ -0,0 +1,200 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+)
+
+type fakeLoginAttemptsRepo struct {
+	attempts map[string]domain.LoginAttempts
+}
+
+func (f *fakeLoginAttemptsRepo) GetLoginAttempts(_ context.Context, key string) (domain.LoginAttempts, error) {
+	a, ok := f.attempts[key]
+	if !ok {
+		return domain.LoginAttempts{}, postgres.ErrNoRowsFound
+	}
+
+	return a, nil
+}
+
+func (f *fakeLoginAttemptsRepo) RecordLoginFailure(_ context.Context,
+	key string, failedAt, windowStart time.Time) (domain.LoginAttempts, error) {
+	a, ok := f.attempts[key]
+	if !ok || a.LastFailedAt.Before(windowStart) {
+		a = domain.LoginAttempts{Key: key, LockedUntil: a.LockedUntil}
+	}
+
+	a.Failures++
+	a.LastFailedAt = failedAt
+	f.attempts[key] = a
+
+	return a, nil
+}
+
+func (f *fakeLoginAttemptsRepo) LockLogin(_ context.Context, key string, until time.Time) error {
+	a := f.attempts[key]
+	a.LockedUntil = &until
+	f.attempts[key] = a
+
+	return nil
+}
+
+func (f *fakeLoginAttemptsRepo) ResetLoginAttempts(_ context.Context, key string) error {
+	delete(f.attempts, key)
+	return nil
+}
+
+func (f *fakeLoginAttemptsRepo) DeleteStaleLoginAttempts(_ context.Context, _, _ string, _ time.Time) error {
+	return nil
+}
+
+func newTestLimiter(t *testing.T) (*Limiter, *fakeLoginAttemptsRepo, *time.Time) {
+	t.Helper()
+	logger.Init(io.Discard, "error")
+
+	repo := &fakeLoginAttemptsRepo{attempts: make(map[string]domain.LoginAttempts)}
+	l, err := NewLimiter(repo, config.LoginThrottleConfig{
+		FreeAttempts:       2,
+		BaseDelay:          time.Second,
+		MaxDelay:           4 * time.Second,
+		LoginLockThreshold: 6,
+		IPLockThreshold:    3,
+		LockoutDuration:    time.Minute,
+		FailureWindow:      time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 9, 27, 10, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	return l, repo, &now
+}
+
+func retryAfter(t *testing.T, err error) time.Duration {
+	t.Helper()
+
+	if err == nil {
+		return 0
+	}
+
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("Allow() error = %v, want a RetryError", err)
+	}
+
+	return retryErr.RetryAfter
+}
+
+func TestLimiter_ProgressiveDelayAndLockout(t *testing.T) {
+	ctx := context.Background()
+	l, _, _ := newTestLimiter(t)
+
+	// the IP is left out so that only the login counter is exercised
+	want := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, time.Minute}
+	for i, w := range want {
+		if err := l.Failure(ctx, "Alice", ""); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := retryAfter(t, l.Allow(ctx, "alice", "")); got != w {
+			t.Errorf("after %d failures retry after = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestLimiter_SuccessResetsLoginOnly(t *testing.T) {
+	ctx := context.Background()
+	l, repo, now := newTestLimiter(t)
+
+	for i := 0; i < 3; i++ {
+		if err := l.Failure(ctx, "alice", "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the IP threshold is reached, other logins from it are locked out as well
+	if got := retryAfter(t, l.Allow(ctx, "bob", "10.0.0.1")); got != time.Minute {
+		t.Errorf("retry after = %v, want %v", got, time.Minute)
+	}
+
+	if err := l.Success(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := repo.attempts["login:alice"]; ok {
+		t.Error("login failures were not reset")
+	}
+
+	if _, ok := repo.attempts["ip:10.0.0.1"]; !ok {
+		t.Error("IP failures must survive a successful login")
+	}
+
+	*now = now.Add(time.Minute)
+	if err := l.Allow(ctx, "alice", "10.0.0.1"); err != nil {
+		t.Errorf("Allow() after the lockout error = %v", err)
+	}
+}
+
+func TestLimiter_LoadsStateFromRepository(t *testing.T) {
+	ctx := context.Background()
+	l, repo, now := newTestLimiter(t)
+
+	// failures recorded before a restart or by another instance
+	lockedUntil := now.Add(30 * time.Second)
+	repo.attempts["login:alice"] = domain.LoginAttempts{
+		Key:          "login:alice",
+		Failures:     6,
+		LastFailedAt: *now,
+		LockedUntil:  &lockedUntil,
+	}
+
+	if got := retryAfter(t, l.Allow(ctx, "alice", "")); got != 30*time.Second {
+		t.Errorf("retry after = %v, want %v", got, 30*time.Second)
+	}
+}
+
+func TestNewScopedLimiter_KeepsCountersApart(t *testing.T) {
+	ctx := context.Background()
+	l, repo, now := newTestLimiter(t)
+
+	scoped, err := NewScopedLimiter(repo, "password-reset", l.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scoped.now = l.now
+
+	for i := 0; i < 6; i++ {
+		if err := scoped.Failure(ctx, "alice", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := retryAfter(t, scoped.Allow(ctx, "alice", "")); got != time.Minute {
+		t.Errorf("scoped retry after = %v, want %v", got, time.Minute)
+	}
+
+	// the sign-in of the login is not throttled by the other action
+	if err := l.Allow(ctx, "alice", ""); err != nil {
+		t.Errorf("Allow() error = %v, want the sign-in allowed", err)
+	}
+
+	if _, ok := repo.attempts["password-reset:login:alice"]; !ok {
+		t.Errorf("scoped failures were not recorded under their own key: %v", repo.attempts)
+	}
+
+	*now = now.Add(time.Minute)
+	if err := scoped.Allow(ctx, "alice", ""); err != nil {
+		t.Errorf("Allow() after the lockout error = %v", err)
+	}
+}
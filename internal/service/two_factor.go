@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/pkg/totp"
+)
+
+const recoveryCodeBytes = 5
+
+type TwoFactorUsers interface {
+	GetUserByID(ctx context.Context, userID string) (domain.User, error)
+	GenerateUserTokens(ctx context.Context, userID string, client domain.SessionClient) (domain.Tokens, error)
+}
+
+// TwoFactorService manages the TOTP enrollment and the second step of the sign-in.
+type TwoFactorService struct {
+	repo         repository.TwoFactorRepo
+	users        TwoFactorUsers
+	tokenManager TokenManager
+	limiter      LoginLimiter
+	cfg          config.TwoFactorConfig
+	now          func() time.Time
+}
+
+func NewTwoFactorService(repo repository.TwoFactorRepo,
+	users TwoFactorUsers,
+	tm TokenManager,
+	limiter LoginLimiter,
+	cfg config.TwoFactorConfig) (*TwoFactorService, error) {
+	return &TwoFactorService{
+		repo:         repo,
+		users:        users,
+		tokenManager: tm,
+		limiter:      limiter,
+		cfg:          cfg,
+		now:          time.Now,
+	}, nil
+}
+
+// Setup starts an enrollment with a new secret, the two-factor authentication is
+// only enabled once a code generated from it is confirmed. The password is required
+// so that a stolen access token is not enough.
+func (ts *TwoFactorService) Setup(ctx context.Context,
+	userID string,
+	input domain.TwoFactorSetupInput,
+	client domain.SessionClient) (domain.TwoFactorSetup, error) {
+	user, err := ts.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return domain.TwoFactorSetup{}, err
+	}
+
+	if err := ts.checkPassword(ctx, user, input.Password, client); err != nil {
+		return domain.TwoFactorSetup{}, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return domain.TwoFactorSetup{}, err
+	}
+
+	if err := ts.repo.SetPendingTOTPSecret(ctx, userID, secret); err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			return domain.TwoFactorSetup{}, auth.ErrTwoFactorEnabled
+		}
+
+		return domain.TwoFactorSetup{}, err
+	}
+
+	return domain.TwoFactorSetup{
+		Secret: secret,
+		URI:    totp.URI(ts.cfg.Issuer, user.Login, secret),
+	}, nil
+}
+
+// Confirm enables the two-factor authentication when the code matches the pending
+// secret and returns the recovery codes, they are only ever shown here. The password
+// is required like for the setup.
+func (ts *TwoFactorService) Confirm(ctx context.Context,
+	userID string,
+	input domain.TwoFactorConfirmInput,
+	client domain.SessionClient) ([]string, error) {
+	user, err := ts.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ts.checkPassword(ctx, user, input.Password, client); err != nil {
+		return nil, err
+	}
+
+	tf, err := ts.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if tf.Enabled() {
+		return nil, auth.ErrTwoFactorEnabled
+	}
+
+	if tf.PendingSecret == nil {
+		return nil, auth.ErrTwoFactorNotEnabled
+	}
+
+	step, ok := totp.Validate(*tf.PendingSecret, input.Code, ts.now(), ts.cfg.Skew, 0)
+	if !ok {
+		return nil, auth.ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, ts.cfg.RecoveryCodes)
+	hashes := make([]string, ts.cfg.RecoveryCodes)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, err
+		}
+
+		if hashes[i], err = ts.tokenManager.HashToken(normalizeRecoveryCode(codes[i])); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ts.repo.EnableTOTP(ctx, userID, step, hashes); err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			return nil, auth.ErrTwoFactorEnabled
+		}
+
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable turns the two-factor authentication off, both the password and a
+// code are required so that a stolen access token is not enough.
+func (ts *TwoFactorService) Disable(ctx context.Context,
+	userID string,
+	input domain.TwoFactorDisableInput,
+	client domain.SessionClient) error {
+	user, err := ts.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := ts.checkPassword(ctx, user, input.Password, client); err != nil {
+		return err
+	}
+
+	if err := ts.verifyCode(ctx, userID, input.Code); err != nil {
+		if errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+			return ts.failure(ctx, user.Login, client, err)
+		}
+
+		return err
+	}
+
+	if err := ts.limiter.Success(ctx, user.Login); err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+
+	return ts.repo.DisableTOTP(ctx, userID)
+}
+
+// NewChallenge issues the challenge token returned by the sign-in of a user
+// with the two-factor authentication enabled.
+func (ts *TwoFactorService) NewChallenge(_ context.Context, userID string) (string, error) {
+	return ts.tokenManager.NewChallengeToken(userID, ts.cfg.ChallengeTTL)
+}
+
+// CompleteLogin checks the code for the user the challenge token was issued for
+// and opens a session, failed codes are throttled like failed passwords. A challenge
+// allows a single attempt, the password step has to be repeated after a wrong code.
+func (ts *TwoFactorService) CompleteLogin(ctx context.Context,
+	input domain.TwoFactorLoginInput,
+	client domain.SessionClient) (domain.Tokens, error) {
+	challenge, err := ts.tokenManager.ParseChallengeToken(input.ChallengeToken)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+	userID := challenge.UserID
+
+	user, err := ts.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	if err := ts.limiter.Allow(ctx, user.Login, client.IPAddress); err != nil {
+		return domain.Tokens{}, err
+	}
+
+	if err := ts.repo.UseChallenge(ctx, challenge.ID, challenge.ExpiresAt); err != nil {
+		if errors.Is(err, postgres.ErrNoRowsFound) {
+			return domain.Tokens{}, auth.ErrInvalidToken
+		}
+
+		return domain.Tokens{}, err
+	}
+
+	if err := ts.verifyCode(ctx, userID, input.Code); err != nil {
+		if errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+			return domain.Tokens{}, ts.failure(ctx, user.Login, client, err)
+		}
+
+		return domain.Tokens{}, err
+	}
+
+	if err := ts.limiter.Success(ctx, user.Login); err != nil {
+		return domain.Tokens{}, fmt.Errorf("failed to reset login failures: %w", err)
+	}
+
+	return ts.users.GenerateUserTokens(ctx, userID, client)
+}
+
+// verifyCode accepts a TOTP code not used before or an unused recovery code.
+func (ts *TwoFactorService) verifyCode(ctx context.Context, userID, code string) error {
+	tf, err := ts.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !tf.Enabled() {
+		return auth.ErrTwoFactorNotEnabled
+	}
+
+	if step, ok := totp.Validate(*tf.Secret, code, ts.now(), ts.cfg.Skew, tf.LastStep); ok {
+		// the update is conditional on the step, a code sent twice concurrently is accepted once
+		err = ts.repo.UseTOTPStep(ctx, userID, step)
+	} else {
+		var codeHash string
+		if codeHash, err = ts.tokenManager.HashToken(normalizeRecoveryCode(code)); err != nil {
+			return err
+		}
+
+		err = ts.repo.UseRecoveryCode(ctx, userID, codeHash)
+	}
+
+	if errors.Is(err, postgres.ErrNoRowsFound) {
+		return auth.ErrInvalidTwoFactorCode
+	}
+
+	return err
+}
+
+// checkPassword verifies the password of the user, failures are throttled like on the
+// sign-in. A correct password does not reset the failures, only a completed sign-in
+// does, so that it can not be used to clear the failed codes.
+func (ts *TwoFactorService) checkPassword(ctx context.Context,
+	user domain.User,
+	password string,
+	client domain.SessionClient) error {
+	if err := ts.limiter.Allow(ctx, user.Login, client.IPAddress); err != nil {
+		return err
+	}
+
+	matches, err := user.Password.Matches(password)
+	if err != nil {
+		return err
+	}
+
+	if !matches {
+		return ts.failure(ctx, user.Login, client, auth.ErrInvalidCredentials)
+	}
+
+	return nil
+}
+
+func (ts *TwoFactorService) failure(ctx context.Context, login string, client domain.SessionClient, err error) error {
+	if ferr := ts.limiter.Failure(ctx, login, client.IPAddress); ferr != nil {
+		return fmt.Errorf("failed to record login failure: %w", ferr)
+	}
+
+	return err
+}
+
+// newRecoveryCode returns a random code formatted as xxxxx-xxxxx.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeBytes)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := hex.EncodeToString(b)
+
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
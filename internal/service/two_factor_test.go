@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/internal/service/throttle"
+	"github.com/mihailtudos/gophermart/pkg/hash"
+	"github.com/mihailtudos/gophermart/pkg/totp"
+)
+
+type fakeTwoFactorRepo struct {
+	tf         domain.TwoFactor
+	codes      map[string]bool
+	challenges map[string]bool
+}
+
+func (f *fakeTwoFactorRepo) GetTwoFactor(_ context.Context, _ string) (domain.TwoFactor, error) {
+	return f.tf, nil
+}
+
+func (f *fakeTwoFactorRepo) SetPendingTOTPSecret(_ context.Context, _, secret string) error {
+	if f.tf.Enabled() {
+		return postgres.ErrNoRowsFound
+	}
+
+	f.tf.PendingSecret = &secret
+	return nil
+}
+
+func (f *fakeTwoFactorRepo) EnableTOTP(_ context.Context, _ string, step int64, hashes []string) error {
+	now := time.Now()
+	f.tf.Secret, f.tf.PendingSecret, f.tf.EnabledAt, f.tf.LastStep = f.tf.PendingSecret, nil, &now, step
+
+	f.codes = make(map[string]bool)
+	for _, h := range hashes {
+		f.codes[h] = false
+	}
+
+	return nil
+}
+
+func (f *fakeTwoFactorRepo) DisableTOTP(_ context.Context, _ string) error {
+	f.tf = domain.TwoFactor{}
+	f.codes = nil
+	return nil
+}
+
+func (f *fakeTwoFactorRepo) UseTOTPStep(_ context.Context, _ string, step int64) error {
+	if step <= f.tf.LastStep {
+		return postgres.ErrNoRowsFound
+	}
+
+	f.tf.LastStep = step
+	return nil
+}
+
+func (f *fakeTwoFactorRepo) UseRecoveryCode(_ context.Context, _, codeHash string) error {
+	if used, ok := f.codes[codeHash]; !ok || used {
+		return postgres.ErrNoRowsFound
+	}
+
+	f.codes[codeHash] = true
+	return nil
+}
+
+func (f *fakeTwoFactorRepo) UseChallenge(_ context.Context, challengeID string, _ time.Time) error {
+	if f.challenges[challengeID] {
+		return postgres.ErrNoRowsFound
+	}
+
+	if f.challenges == nil {
+		f.challenges = make(map[string]bool)
+	}
+
+	f.challenges[challengeID] = true
+	return nil
+}
+
+type fakeTwoFactorUsers struct {
+	user domain.User
+}
+
+func (f fakeTwoFactorUsers) GetUserByID(_ context.Context, userID string) (domain.User, error) {
+	user := f.user
+	user.ID = userID
+	return user, nil
+}
+
+func (fakeTwoFactorUsers) GenerateUserTokens(_ context.Context,
+	userID string,
+	_ domain.SessionClient) (domain.Tokens, error) {
+	return domain.Tokens{AccessToken: "access-" + userID}, nil
+}
+
+type fakeLoginLimiter struct {
+	failures  int
+	successes int
+}
+
+func (f *fakeLoginLimiter) Allow(_ context.Context, _, _ string) error { return nil }
+
+func (f *fakeLoginLimiter) Failure(_ context.Context, _, _ string) error {
+	f.failures++
+	return nil
+}
+
+func (f *fakeLoginLimiter) Success(_ context.Context, _ string) error {
+	f.successes++
+	return nil
+}
+
+func TestTwoFactorService_EnrollAndLogin(t *testing.T) {
+	ctx := context.Background()
+
+	tm, err := auth.NewManager(config.JWTConfig{SigningKey: "secret", AccessTokenTTL: time.Minute},
+		hash.NewSHA256Hasher("salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &fakeTwoFactorRepo{}
+	limiter := &fakeLoginLimiter{}
+	users := fakeTwoFactorUsers{user: newTestUser(t, "user-1", "alice", "correct horse")}
+	ts, _ := NewTwoFactorService(repo, users, tm, limiter, config.TwoFactorConfig{
+		Issuer:        "Gophermart",
+		ChallengeTTL:  time.Minute,
+		Skew:          1,
+		RecoveryCodes: 2,
+	})
+
+	now := time.Unix(1727600000, 0)
+	ts.now = func() time.Time { return now }
+
+	withPassword := domain.TwoFactorSetupInput{Password: "correct horse"}
+	if _, err := ts.Setup(ctx, "user-1", domain.TwoFactorSetupInput{Password: "wrong horse"},
+		domain.SessionClient{}); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("Setup() with a wrong password error = %v", err)
+	}
+
+	setup, err := ts.Setup(ctx, "user-1", withPassword, domain.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codeAt := func(at time.Time) string {
+		code, err := totp.CodeAt(setup.Secret, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	confirm := func(password, code string) ([]string, error) {
+		return ts.Confirm(ctx, "user-1", domain.TwoFactorConfirmInput{Password: password, Code: code},
+			domain.SessionClient{})
+	}
+
+	if _, err := confirm("correct horse", "not-a-code"); !errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+		t.Fatalf("Confirm() with a wrong code error = %v", err)
+	}
+
+	if _, err := confirm("wrong horse", codeAt(now)); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("Confirm() with a wrong password error = %v", err)
+	}
+
+	recoveryCodes, err := confirm("correct horse", codeAt(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recoveryCodes) != 2 {
+		t.Fatalf("got %d recovery codes, want 2", len(recoveryCodes))
+	}
+
+	if _, err := ts.Setup(ctx, "user-1", withPassword, domain.SessionClient{}); !errors.Is(err,
+		auth.ErrTwoFactorEnabled) {
+		t.Errorf("Setup() once enabled error = %v", err)
+	}
+
+	// the code confirming the enrollment can not be used again
+	later := now.Add(totp.Period)
+	tests := []struct {
+		name    string
+		code    string
+		wantErr error
+	}{
+		{name: "code of the confirmation", code: codeAt(now), wantErr: auth.ErrInvalidTwoFactorCode},
+		{name: "code of the next step", code: codeAt(later)},
+		{name: "replayed code", code: codeAt(later), wantErr: auth.ErrInvalidTwoFactorCode},
+		{name: "recovery code", code: recoveryCodes[0]},
+		{name: "used recovery code", code: recoveryCodes[0], wantErr: auth.ErrInvalidTwoFactorCode},
+		{name: "recovery code without the dash", code: "  " + recoveryCodes[1][:5] + recoveryCodes[1][6:]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.now = func() time.Time { return later }
+
+			challenge, err := ts.NewChallenge(ctx, "user-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tokens, err := ts.CompleteLogin(ctx, domain.TwoFactorLoginInput{
+				ChallengeToken: challenge,
+				Code:           tt.code,
+			}, domain.SessionClient{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CompleteLogin() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err == nil && tokens.AccessToken != "access-user-1" {
+				t.Errorf("CompleteLogin() tokens = %+v", tokens)
+			}
+		})
+	}
+
+	// the wrong password of the setup and of the confirmation count as well
+	if limiter.failures != 5 {
+		t.Errorf("recorded %d failures, want 5", limiter.failures)
+	}
+}
+
+func TestTwoFactorService_ChallengeIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+
+	tm, err := auth.NewManager(config.JWTConfig{SigningKey: "secret", AccessTokenTTL: time.Minute},
+		hash.NewSHA256Hasher("salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1727600000, 0)
+	enabledAt := now.Add(-time.Hour)
+	repo := &fakeTwoFactorRepo{tf: domain.TwoFactor{UserID: "user-1", Secret: &secret, EnabledAt: &enabledAt}}
+
+	ts, _ := NewTwoFactorService(repo, fakeTwoFactorUsers{}, tm, &fakeLoginLimiter{}, config.TwoFactorConfig{
+		ChallengeTTL: time.Minute,
+		Skew:         1,
+	})
+	ts.now = func() time.Time { return now }
+
+	challenge, err := ts.NewChallenge(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ts.CompleteLogin(ctx, domain.TwoFactorLoginInput{ChallengeToken: challenge, Code: "000000"},
+		domain.SessionClient{}); !errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+		t.Fatalf("CompleteLogin() with a wrong code error = %v", err)
+	}
+
+	code, err := totp.CodeAt(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the right code does not help once the challenge was used
+	if _, err := ts.CompleteLogin(ctx, domain.TwoFactorLoginInput{ChallengeToken: challenge, Code: code},
+		domain.SessionClient{}); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("CompleteLogin() with a used challenge error = %v, want %v", err, auth.ErrInvalidToken)
+	}
+}
+
+func TestTwoFactorService_AlternatingLoginLocksOut(t *testing.T) {
+	ctx := context.Background()
+	const lockThreshold = 4
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := newTestUser(t, "user-1", "alice", "correct horse")
+	user.TwoFactorEnabled = true
+
+	enabledAt := time.Now().Add(-time.Hour)
+	repo := &fakeTwoFactorRepo{tf: domain.TwoFactor{UserID: "user-1", Secret: &secret, EnabledAt: &enabledAt}}
+
+	limiter, err := throttle.NewLimiter(&fakeLoginAttemptsRepo{}, config.LoginThrottleConfig{
+		FreeAttempts:       lockThreshold,
+		LoginLockThreshold: lockThreshold,
+		IPLockThreshold:    100,
+		LockoutDuration:    time.Hour,
+		FailureWindow:      time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	us, tm, _ := newTestUserService(t, &fakeUserRepo{users: map[string]domain.User{"user-1": user}}, limiter)
+	ts, _ := NewTwoFactorService(repo, us, tm, limiter, config.TwoFactorConfig{ChallengeTTL: time.Minute, Skew: 1})
+
+	client := domain.SessionClient{IPAddress: "10.0.0.1"}
+	for i := 0; i < lockThreshold; i++ {
+		// the correct password must not clear the failed codes
+		if _, err := us.Login(ctx, domain.UserAuthInput{Login: "alice", Password: "correct horse"}, client); err != nil {
+			t.Fatalf("attempt %d: Login() error = %v", i+1, err)
+		}
+
+		challenge, err := ts.NewChallenge(ctx, "user-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = ts.CompleteLogin(ctx, domain.TwoFactorLoginInput{ChallengeToken: challenge, Code: "000000"}, client)
+		if !errors.Is(err, auth.ErrInvalidTwoFactorCode) {
+			t.Fatalf("attempt %d: CompleteLogin() error = %v", i+1, err)
+		}
+	}
+
+	if _, err := us.Login(ctx, domain.UserAuthInput{Login: "alice", Password: "correct horse"},
+		client); !errors.Is(err, throttle.ErrTooManyAttempts) {
+		t.Errorf("Login() after %d wrong codes error = %v, want %v", lockThreshold, err, throttle.ErrTooManyAttempts)
+	}
+}
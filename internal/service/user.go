@@ -2,21 +2,44 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
 	"github.com/mihailtudos/gophermart/internal/repository"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
 )
 
+// passwordRehashTimeout bounds the background upgrade of a password hash
+const passwordRehashTimeout = 30 * time.Second
+
 type UserService struct {
 	repo         repository.UserRepo
 	tokenManager TokenManager
+	events       EventBroker
+	revocations  TokenRevoker
+	limiter      LoginLimiter
+	// verifiedEmailForWithdrawals only lets users with a verified email withdraw points
+	verifiedEmailForWithdrawals bool
 }
 
 func NewUserService(repo repository.UserRepo,
-	tm TokenManager) (*UserService, error) {
+	tm TokenManager,
+	events EventBroker,
+	revocations TokenRevoker,
+	limiter LoginLimiter,
+	verifiedEmailForWithdrawals bool) (*UserService, error) {
 	return &UserService{
-		repo:         repo,
-		tokenManager: tm,
+		repo:                        repo,
+		tokenManager:                tm,
+		events:                      events,
+		revocations:                 revocations,
+		limiter:                     limiter,
+		verifiedEmailForWithdrawals: verifiedEmailForWithdrawals,
 	}, nil
 }
 
@@ -30,45 +53,295 @@ func (u *UserService) Register(ctx context.Context, user domain.User) (string, e
 	return userID, nil
 }
 
-func (u *UserService) SetSessionToken(ctx context.Context, userID string, token string) error {
-	st, err := u.tokenManager.CreateSession(userID, token)
-	if err != nil {
-		return err
+// Login verifies the credentials, failed attempts are throttled per login and per client IP.
+func (u *UserService) Login(ctx context.Context,
+	input domain.UserAuthInput,
+	client domain.SessionClient) (domain.User, error) {
+	if err := u.limiter.Allow(ctx, input.Login, client.IPAddress); err != nil {
+		return domain.User{}, err
 	}
 
-	return u.repo.SetSessionToken(ctx, st)
-}
-
-func (u *UserService) Login(ctx context.Context, input domain.UserAuthInput) (domain.User, error) {
 	user, err := u.repo.GetUserByLogin(ctx, input.Login)
-	if err != nil {
+	if err != nil && !errors.Is(err, postgres.ErrNoRowsFound) {
 		return domain.User{}, err
 	}
 
+	matches := false
+	if err == nil {
+		matches, err = user.Password.Matches(input.Password)
+		if err != nil {
+			return domain.User{}, err
+		}
+	} else {
+		// an unknown login must not answer faster than a wrong password
+		domain.CompareDummyPassword(input.Password)
+	}
+
+	if !matches {
+		if err := u.limiter.Failure(ctx, input.Login, client.IPAddress); err != nil {
+			return domain.User{}, fmt.Errorf("failed to record login failure: %w", err)
+		}
+
+		return domain.User{}, auth.ErrInvalidCredentials
+	}
+
+	// with the two-factor authentication the failures are only reset once the code is
+	// checked, otherwise the password would clear the failed codes of the challenges
+	if !user.TwoFactorEnabled {
+		if err := u.limiter.Success(ctx, input.Login); err != nil {
+			return domain.User{}, fmt.Errorf("failed to reset login failures: %w", err)
+		}
+	}
+
+	if user.Suspended() {
+		return domain.User{}, auth.ErrUserSuspended
+	}
+
+	if user.Password.NeedsRehash() {
+		u.rehashPassword(ctx, user, input.Password)
+	}
+
 	return user, nil
 }
 
-func (u *UserService) RefreshTokens(ctx context.Context, refreshToken string) (domain.Tokens, error) {
-	return domain.Tokens{}, nil
+// rehashPassword upgrades the password hash to the current cost in the background,
+// the plaintext password is only known while the user signs in.
+func (u *UserService) rehashPassword(ctx context.Context, user domain.User, plaintext string) {
+	oldHash := user.Password.Hash
+
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				logger.Log.Warn("recover from panic ", slog.Any("err", p))
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), passwordRehashTimeout)
+		defer cancel()
+
+		if err := user.Password.Set(plaintext); err != nil {
+			logger.Log.ErrorContext(ctx, "failed to rehash password", slog.String("err", err.Error()))
+			return
+		}
+
+		// a password changed in the meantime needs no upgrade
+		err := u.repo.RehashPassword(ctx, user.ID, oldHash, user.Password.Hash)
+		if err != nil && !errors.Is(err, postgres.ErrEditConflict) {
+			logger.Log.ErrorContext(ctx, "failed to store rehashed password",
+				slog.String("userID", user.ID),
+				slog.String("err", err.Error()))
+		}
+	}()
+}
+
+// GenerateUserTokens opens a new session for the client and issues a token pair
+// bound to it, a previous session of the same device is replaced.
+func (u *UserService) GenerateUserTokens(ctx context.Context,
+	userID string,
+	client domain.SessionClient) (domain.Tokens, error) {
+	user, err := u.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	if user.Suspended() {
+		return domain.Tokens{}, auth.ErrUserSuspended
+	}
+
+	refToken, err := u.tokenManager.NewRefreshToken()
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	st, err := u.tokenManager.CreateSession(userID, refToken)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+	st.SetClient(client)
+
+	sessionID, ended, err := u.repo.SetSessionToken(ctx, st)
+	if err != nil {
+		return domain.Tokens{}, fmt.Errorf("failed to set user session: %w", err)
+	}
+
+	// the access tokens of the replaced and pruned sessions are revoked along with their refresh tokens
+	for _, familyID := range ended {
+		if err := u.revocations.RevokeSession(ctx, familyID); err != nil {
+			return domain.Tokens{}, err
+		}
+	}
+
+	token, err := u.tokenManager.NewJWT(userID, sessionID, user.Role, nil)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	return domain.Tokens{
+		AccessToken:  token,
+		RefreshToken: refToken,
+	}, nil
 }
 
-func (u *UserService) GenerateUserTokens(ctx context.Context, userID string) (domain.Tokens, error) {
-	token, err := u.tokenManager.NewJWT(userID, nil)
+// RefreshTokens issues a new token pair for a valid refresh token, the refresh
+// token is rotated so the presented one can not be used again.
+func (u *UserService) RefreshTokens(ctx context.Context,
+	refreshToken string,
+	client domain.SessionClient) (domain.Tokens, error) {
+	tokenHash, err := u.tokenManager.HashToken(refreshToken)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	session, err := u.repo.GetSessionByToken(ctx, tokenHash)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	// a replayed token must reach RotateSessionToken so its family gets revoked
+	if session.UsedAt == nil && time.Now().UTC().After(session.ExpiresAt) {
+		return domain.Tokens{}, auth.ErrTokenExpired
+	}
+
+	user, err := u.repo.GetUserByID(ctx, session.UserID)
 	if err != nil {
 		return domain.Tokens{}, err
 	}
 
+	if user.Suspended() {
+		return domain.Tokens{}, auth.ErrUserSuspended
+	}
+
 	refToken, err := u.tokenManager.NewRefreshToken()
 	if err != nil {
 		return domain.Tokens{}, err
 	}
 
+	st, err := u.tokenManager.CreateSession(session.UserID, refToken)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+	st.SetClient(client)
+
+	if err := u.repo.RotateSessionToken(ctx, tokenHash, st); err != nil {
+		if errors.Is(err, postgres.ErrRefreshTokenReused) {
+			logger.Log.WarnContext(ctx, "security: refresh token reuse detected, session family revoked",
+				slog.String("user_id", session.UserID),
+				slog.String("family_id", session.FamilyID),
+				slog.String("session_id", session.ID))
+
+			// the access tokens issued to the family are revoked along with the refresh tokens
+			if rErr := u.revocations.RevokeSession(ctx, session.FamilyID); rErr != nil {
+				return domain.Tokens{}, rErr
+			}
+		}
+
+		return domain.Tokens{}, err
+	}
+
+	token, err := u.tokenManager.NewJWT(session.UserID, session.FamilyID, user.Role, nil)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
 	return domain.Tokens{
 		AccessToken:  token,
 		RefreshToken: refToken,
 	}, nil
 }
 
+func (u *UserService) GetUserSessions(ctx context.Context, userID string) ([]domain.UserSession, error) {
+	return u.repo.GetUserSessions(ctx, userID)
+}
+
+// RevokeSession ends the session and revokes the access tokens issued for it.
+func (u *UserService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	if err := u.repo.RevokeSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+
+	return u.revocations.RevokeSession(ctx, sessionID)
+}
+
+// RevokeAllSessions ends every session of the user and revokes all the access
+// tokens issued so far.
+func (u *UserService) RevokeAllSessions(ctx context.Context, userID string) error {
+	if err := u.repo.RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	return u.revocations.RevokeUser(ctx, userID)
+}
+
+// Logout ends the session the access token was issued for and revokes the token.
+func (u *UserService) Logout(ctx context.Context, claims domain.TokenClaims) error {
+	if err := u.revocations.RevokeToken(ctx, claims.ID); err != nil {
+		return err
+	}
+
+	// tokens issued before sessions were bound to them have no session to end
+	if claims.SessionID == "" {
+		return nil
+	}
+
+	err := u.RevokeSession(ctx, claims.UserID, claims.SessionID)
+	if err != nil && !errors.Is(err, postgres.ErrNoRowsFound) {
+		return err
+	}
+
+	return nil
+}
+
+// ChangePassword replaces the password after checking the current one. Every session
+// of the user is revoked and a new token pair is issued for the caller.
+func (u *UserService) ChangePassword(ctx context.Context,
+	userID string,
+	input domain.ChangePasswordInput,
+	client domain.SessionClient) (domain.Tokens, error) {
+	user, err := u.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	// the current password can be guessed here as well as on the sign-in
+	if err := u.limiter.Allow(ctx, user.Login, client.IPAddress); err != nil {
+		return domain.Tokens{}, err
+	}
+
+	matches, err := user.Password.Matches(input.CurrentPassword)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	if !matches {
+		if err := u.limiter.Failure(ctx, user.Login, client.IPAddress); err != nil {
+			return domain.Tokens{}, fmt.Errorf("failed to record login failure: %w", err)
+		}
+
+		return domain.Tokens{}, auth.ErrInvalidCredentials
+	}
+
+	// the failed codes of the two-factor sign-in are only reset by a correct code
+	if !user.TwoFactorEnabled {
+		if err := u.limiter.Success(ctx, user.Login); err != nil {
+			return domain.Tokens{}, fmt.Errorf("failed to reset login failures: %w", err)
+		}
+	}
+
+	if err := user.Password.Set(input.NewPassword); err != nil {
+		return domain.Tokens{}, err
+	}
+
+	if _, err := u.repo.UpdatePassword(ctx, user); err != nil {
+		return domain.Tokens{}, err
+	}
+
+	if err := u.RevokeAllSessions(ctx, userID); err != nil {
+		return domain.Tokens{}, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return u.GenerateUserTokens(ctx, userID, client)
+}
+
 func (u *UserService) GetUserByLogin(ctx context.Context, login string) (domain.User, error) {
 	return u.repo.GetUserByLogin(ctx, login)
 }
@@ -77,13 +350,17 @@ func (u *UserService) GetUserByID(ctx context.Context, userID string) (domain.Us
 	return u.repo.GetUserByID(ctx, userID)
 }
 
-func (u *UserService) VerifyToken(ctx context.Context, token string) (string, error) {
-	userID, err := u.tokenManager.Parse(token)
+func (u *UserService) VerifyToken(ctx context.Context, token string) (domain.TokenClaims, error) {
+	claims, err := u.tokenManager.Parse(token)
 	if err != nil {
-		return "", err
+		return domain.TokenClaims{}, err
 	}
 
-	return userID, nil
+	if u.revocations.IsRevoked(claims) {
+		return domain.TokenClaims{}, auth.ErrTokenRevoked
+	}
+
+	return claims, nil
 }
 
 func (u *UserService) RegisterOrder(ctx context.Context, order domain.Order) (domain.Order, error) {
@@ -94,22 +371,102 @@ func (u *UserService) GetUserOrders(ctx context.Context, userID string) ([]domai
 	return u.repo.GetUserOrders(ctx, userID)
 }
 
+func (u *UserService) GetUserOrder(ctx context.Context, userID, orderNumber string) (domain.UserOrderDetails, error) {
+	return u.repo.GetUserOrder(ctx, userID, orderNumber)
+}
+
 func (u *UserService) GetUserBalance(ctx context.Context, userID string) (domain.UserBalance, error) {
 	return u.repo.GetUserBalance(ctx, userID)
 }
 
+// WithdrawalPoints debits the points for the order, when configured the user must
+// have verified the email first.
 func (u *UserService) WithdrawalPoints(ctx context.Context, wp domain.Withdrawal) (string, error) {
-	return u.repo.WithdrawalPoints(ctx, wp)
+	if u.verifiedEmailForWithdrawals {
+		user, err := u.repo.GetUserByID(ctx, wp.UserID)
+		if err != nil {
+			return "", err
+		}
+
+		if !user.EmailVerified() {
+			return "", auth.ErrEmailNotVerified
+		}
+	}
+
+	id, err := u.repo.WithdrawalPoints(ctx, wp)
+	if err != nil {
+		return id, err
+	}
+
+	u.publishBalance(ctx, wp.UserID)
+
+	return id, nil
 }
 
 func (u *UserService) GetWithdrawals(ctx context.Context, userID string) ([]domain.Withdrawal, error) {
 	return u.repo.GetWithdrawals(ctx, userID)
 }
 
-func (u *UserService) GetUnfinishedOrders(ctx context.Context) ([]domain.Order, error) {
-	return u.repo.GetUnfinishedOrders(ctx)
+func (u *UserService) GetUnfinishedOrders(ctx context.Context, lease time.Duration) ([]domain.Order, error) {
+	return u.repo.GetUnfinishedOrders(ctx, lease)
+}
+
+func (u *UserService) ReleaseOrderLease(ctx context.Context, orderNumber string) error {
+	return u.repo.ReleaseOrderLease(ctx, orderNumber)
 }
 
-func (u *UserService) UpdateOrder(ctx context.Context, order domain.Order) error {
-	return u.repo.UpdateOrder(ctx, order)
+func (u *UserService) CancelOrder(ctx context.Context, userID, orderNumber string) (domain.OrderStatusChange, error) {
+	change, err := u.repo.CancelOrder(ctx, userID, orderNumber)
+	if err != nil {
+		return change, err
+	}
+
+	u.events.Publish(ctx, userID, domain.Event{
+		ID:   change.ID,
+		Type: domain.EventOrderStatusChanged,
+		Data: change,
+	})
+
+	return change, nil
+}
+
+func (u *UserService) UpdateOrder(ctx context.Context, order domain.Order) (domain.OrderStatusChange, error) {
+	change, err := u.repo.UpdateOrder(ctx, order)
+	if err != nil {
+		return change, err
+	}
+
+	u.events.Publish(ctx, change.UserID, domain.Event{
+		ID:   change.ID,
+		Type: domain.EventOrderStatusChanged,
+		Data: change,
+	})
+
+	u.publishBalance(ctx, change.UserID)
+
+	return change, nil
+}
+
+func (u *UserService) GetUserOrderStatusChanges(ctx context.Context,
+	userID, sinceID string) ([]domain.OrderStatusChange, error) {
+	return u.repo.GetUserOrderStatusChanges(ctx, userID, sinceID)
+}
+
+func (u *UserService) SubscribeEvents(userID string) (<-chan domain.Event, func()) {
+	return u.events.Subscribe(userID)
+}
+
+func (u *UserService) publishBalance(ctx context.Context, userID string) {
+	balance, err := u.repo.GetUserBalance(ctx, userID)
+	if err != nil {
+		logger.Log.ErrorContext(ctx, "failed to get balance for the balance event",
+			slog.String("userID", userID),
+			slog.String("err", err.Error()))
+		return
+	}
+
+	u.events.Publish(ctx, userID, domain.Event{
+		Type: domain.EventBalanceUpdated,
+		Data: balance,
+	})
 }
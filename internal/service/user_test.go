@@ -0,0 +1,677 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/repository"
+	"github.com/mihailtudos/gophermart/internal/repository/postgres"
+	"github.com/mihailtudos/gophermart/internal/service/auth"
+	"github.com/mihailtudos/gophermart/pkg/hash"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeUserRepo keeps the state in memory, the methods the tests do not need
+// panic on the nil embedded interface.
+type fakeUserRepo struct {
+	repository.UserRepo
+	users    map[string]domain.User
+	sessions []*domain.Session
+	// nextSession numbers the sessions so that a replaced family ID is never reused
+	nextSession int
+	orders      map[string]domain.Order
+	// beforeUpdate runs before the stored password is updated, a concurrent change
+	// of the account can be simulated in it
+	beforeUpdate func()
+	// rehashed receives the hashes stored by RehashPassword, which runs in the background
+	rehashed chan []byte
+}
+
+func (f *fakeUserRepo) GetUserByID(_ context.Context, id string) (domain.User, error) {
+	user, ok := f.users[id]
+	if !ok {
+		return domain.User{}, postgres.ErrNoRowsFound
+	}
+
+	return user, nil
+}
+
+func (f *fakeUserRepo) GetUserByLogin(_ context.Context, login string) (domain.User, error) {
+	for _, user := range f.users {
+		if user.Login == login {
+			return user, nil
+		}
+	}
+
+	return domain.User{}, postgres.ErrNoRowsFound
+}
+
+func (f *fakeUserRepo) RehashPassword(_ context.Context, userID string, oldHash, newHash []byte) error {
+	user, ok := f.users[userID]
+	if !ok || !bytes.Equal(user.Password.Hash, oldHash) {
+		return postgres.ErrEditConflict
+	}
+
+	user.Password.Hash = newHash
+	f.users[userID] = user
+	f.rehashed <- newHash
+
+	return nil
+}
+
+// UpdatePassword is guarded by the version like the repository.
+func (f *fakeUserRepo) UpdatePassword(_ context.Context, user domain.User) (int, error) {
+	if f.beforeUpdate != nil {
+		f.beforeUpdate()
+	}
+
+	stored, ok := f.users[user.ID]
+	if !ok || stored.Version != user.Version {
+		return 0, postgres.ErrEditConflict
+	}
+
+	user.Version++
+	f.users[user.ID] = user
+
+	return user.Version, nil
+}
+
+func (f *fakeUserRepo) RevokeAllSessions(_ context.Context, userID string) error {
+	now := time.Now()
+	for _, st := range f.sessions {
+		if st.UserID == userID && st.RevokedAt == nil {
+			st.RevokedAt = &now
+		}
+	}
+
+	return nil
+}
+
+// SetSessionToken starts a new token family with the session, replacing the
+// sessions of the same device and revoking the oldest families beyond the limit.
+func (f *fakeUserRepo) SetSessionToken(_ context.Context, st domain.Session) (string, []string, error) {
+	var ended []string
+
+	if st.DeviceID != nil {
+		kept := f.sessions[:0]
+		for _, session := range f.sessions {
+			if session.UserID != st.UserID || session.DeviceID == nil || *session.DeviceID != *st.DeviceID {
+				kept = append(kept, session)
+			} else if !slices.Contains(ended, session.FamilyID) {
+				ended = append(ended, session.FamilyID)
+			}
+		}
+		f.sessions = kept
+	}
+
+	f.nextSession++
+	st.ID = fmt.Sprintf("session-%d", f.nextSession)
+	st.FamilyID = st.ID
+	f.sessions = append(f.sessions, &st)
+
+	// the sessions are stored in creation order, the newest live tokens are kept
+	now := time.Now()
+	live := 0
+	for i := len(f.sessions) - 1; i >= 0; i-- {
+		session := f.sessions[i]
+		if session.UserID != st.UserID || session.UsedAt != nil || session.RevokedAt != nil {
+			continue
+		}
+
+		if live++; live > domain.MaxUserSessions {
+			for _, family := range f.sessions {
+				if family.FamilyID == session.FamilyID && family.RevokedAt == nil {
+					family.RevokedAt = &now
+				}
+			}
+			ended = append(ended, session.FamilyID)
+		}
+	}
+
+	return st.FamilyID, ended, nil
+}
+
+func (f *fakeUserRepo) GetSessionByToken(_ context.Context, tokenHash string) (domain.Session, error) {
+	for _, st := range f.sessions {
+		if st.TokenHash == tokenHash {
+			return *st, nil
+		}
+	}
+
+	return domain.Session{}, postgres.ErrNoRowsFound
+}
+
+// RotateSessionToken follows the repository, a used token revokes its family.
+func (f *fakeUserRepo) RotateSessionToken(ctx context.Context, oldTokenHash string, st domain.Session) error {
+	old, err := f.GetSessionByToken(ctx, oldTokenHash)
+	if err != nil {
+		return err
+	}
+
+	if old.RevokedAt != nil {
+		return postgres.ErrNoRowsFound
+	}
+
+	now := time.Now()
+	if old.UsedAt != nil {
+		for _, session := range f.sessions {
+			if session.FamilyID == old.FamilyID && session.RevokedAt == nil {
+				session.RevokedAt = &now
+			}
+		}
+
+		return postgres.ErrRefreshTokenReused
+	}
+
+	for _, session := range f.sessions {
+		if session.ID == old.ID {
+			session.UsedAt = &now
+		}
+	}
+
+	f.nextSession++
+	st.ID = fmt.Sprintf("session-%d", f.nextSession)
+	st.FamilyID, st.ParentID, st.DeviceID = old.FamilyID, &old.ID, old.DeviceID
+	f.sessions = append(f.sessions, &st)
+
+	return nil
+}
+
+func (f *fakeUserRepo) session(id string) *domain.Session {
+	for _, st := range f.sessions {
+		if st.ID == id {
+			return st
+		}
+	}
+
+	return nil
+}
+
+// CancelOrder only cancels the new orders of the user, like the repository does.
+func (f *fakeUserRepo) CancelOrder(_ context.Context, userID, orderNumber string) (domain.OrderStatusChange, error) {
+	order, ok := f.orders[orderNumber]
+	if !ok || order.UserID != userID {
+		return domain.OrderStatusChange{}, postgres.ErrNoRowsFound
+	}
+
+	if order.OrderStatus != domain.OrderStatusNew {
+		return domain.OrderStatusChange{}, postgres.ErrOrderNotCancellable
+	}
+
+	order.OrderStatus = domain.OrderStatusCancelled
+	f.orders[orderNumber] = order
+
+	return domain.OrderStatusChange{
+		ID:          "change-1",
+		OrderNumber: orderNumber,
+		UserID:      userID,
+		NewStatus:   domain.OrderStatusCancelled,
+	}, nil
+}
+
+func TestUserService_CancelOrder(t *testing.T) {
+	logger.Init(io.Discard, "error")
+
+	tests := []struct {
+		name    string
+		userID  string
+		number  string
+		wantErr error
+	}{
+		{name: "own new order", userID: "user-1", number: "12345678903"},
+		{name: "own order being processed", userID: "user-1", number: "9278923470",
+			wantErr: postgres.ErrOrderNotCancellable},
+		{name: "order of another user", userID: "user-2", number: "12345678903", wantErr: postgres.ErrNoRowsFound},
+		{name: "unknown order", userID: "user-1", number: "346436439", wantErr: postgres.ErrNoRowsFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUserRepo{orders: map[string]domain.Order{
+				"12345678903": {OrderNumber: "12345678903", UserID: "user-1", OrderStatus: domain.OrderStatusNew},
+				"9278923470":  {OrderNumber: "9278923470", UserID: "user-1", OrderStatus: domain.OrderStatusProcessing},
+			}}
+			broker := &fakeEventBroker{}
+
+			us, _ := NewUserService(repo, nil, broker, nil, nil, false)
+
+			change, err := us.CancelOrder(context.Background(), tt.userID, tt.number)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CancelOrder() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				if len(broker.published) != 0 {
+					t.Errorf("published %d events for a failed cancellation", len(broker.published))
+				}
+				return
+			}
+
+			if change.NewStatus != domain.OrderStatusCancelled {
+				t.Errorf("change status = %s, want %s", change.NewStatus, domain.OrderStatusCancelled)
+			}
+
+			if len(broker.published) != 1 || broker.published[0].Type != domain.EventOrderStatusChanged {
+				t.Errorf("published = %+v, want one order status event", broker.published)
+			}
+		})
+	}
+}
+
+func newTestUserService(t *testing.T,
+	repo *fakeUserRepo, limiter LoginLimiter) (*UserService, *auth.Manager, *RevocationList) {
+	t.Helper()
+	logger.Init(io.Discard, "error")
+
+	tm, err := auth.NewManager(config.JWTConfig{
+		SigningKey:      "secret",
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}, hash.NewSHA256Hasher("salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revocations, _ := NewRevocationList(&fakeRevocationRepo{}, time.Minute)
+	us, _ := NewUserService(repo, tm, &fakeEventBroker{}, revocations, limiter, false)
+
+	return us, tm, revocations
+}
+
+func TestUserService_RefreshTokens(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		// token returns the refresh token presented after the user signed in
+		token   func(t *testing.T, repo *fakeUserRepo, issued string) string
+		wantErr error
+	}{
+		{name: "valid token is rotated", token: func(_ *testing.T, _ *fakeUserRepo, issued string) string {
+			return issued
+		}},
+		{name: "expired token", token: func(_ *testing.T, repo *fakeUserRepo, issued string) string {
+			repo.sessions[0].ExpiresAt = time.Now().Add(-time.Second)
+			return issued
+		}, wantErr: auth.ErrTokenExpired},
+		{name: "unknown token", token: func(_ *testing.T, _ *fakeUserRepo, _ string) string {
+			return "not-a-refresh-token"
+		}, wantErr: postgres.ErrNoRowsFound},
+		{name: "logged out session", token: func(_ *testing.T, repo *fakeUserRepo, issued string) string {
+			now := time.Now()
+			repo.sessions[0].RevokedAt = &now
+			return issued
+		}, wantErr: postgres.ErrNoRowsFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUserRepo{users: map[string]domain.User{"user-1": {ID: "user-1", Login: "alice"}}}
+			us, tm, _ := newTestUserService(t, repo, &fakeLoginLimiter{})
+
+			issued, err := us.GenerateUserTokens(ctx, "user-1", domain.SessionClient{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tokens, err := us.RefreshTokens(ctx, tt.token(t, repo, issued.RefreshToken), domain.SessionClient{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RefreshTokens() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if tokens.RefreshToken == "" || tokens.RefreshToken == issued.RefreshToken {
+				t.Fatalf("refresh token was not rotated")
+			}
+
+			if repo.session("session-1").UsedAt == nil {
+				t.Error("the presented token was not marked as used")
+			}
+
+			rotated := repo.session("session-2")
+			if rotated == nil || rotated.FamilyID != "session-1" {
+				t.Fatalf("rotated session = %+v, want one in the family of session-1", rotated)
+			}
+
+			claims, err := tm.Parse(tokens.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if claims.UserID != "user-1" || claims.SessionID != "session-1" {
+				t.Errorf("access token claims = %+v, want user-1 in session-1", claims)
+			}
+
+			// the new token can be rotated in turn
+			if _, err := us.RefreshTokens(ctx, tokens.RefreshToken, domain.SessionClient{}); err != nil {
+				t.Errorf("RefreshTokens() with the rotated token error = %v", err)
+			}
+		})
+	}
+}
+
+func TestUserService_RefreshTokensReuse(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeUserRepo{users: map[string]domain.User{"user-1": {ID: "user-1", Login: "alice"}}}
+	us, tm, revocations := newTestUserService(t, repo, &fakeLoginLimiter{})
+
+	issued, err := us.GenerateUserTokens(ctx, "user-1", domain.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := us.RefreshTokens(ctx, issued.RefreshToken, domain.SessionClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first token is presented again, as an attacker holding a stolen copy would
+	if _, err := us.RefreshTokens(ctx, issued.RefreshToken, domain.SessionClient{}); !errors.Is(err,
+		postgres.ErrRefreshTokenReused) {
+		t.Fatalf("RefreshTokens() error = %v, want %v", err, postgres.ErrRefreshTokenReused)
+	}
+
+	for _, st := range repo.sessions {
+		if st.RevokedAt == nil {
+			t.Errorf("session %s of the family was not revoked", st.ID)
+		}
+	}
+
+	// the legitimate holder of the rotated token is signed out as well
+	if _, err := us.RefreshTokens(ctx, rotated.RefreshToken, domain.SessionClient{}); !errors.Is(err,
+		postgres.ErrNoRowsFound) {
+		t.Errorf("RefreshTokens() with the rotated token error = %v, want %v", err, postgres.ErrNoRowsFound)
+	}
+
+	claims, err := tm.Parse(rotated.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !revocations.IsRevoked(claims) {
+		t.Error("the access token issued to the family is not revoked")
+	}
+}
+
+func TestUserService_GenerateUserTokensDevices(t *testing.T) {
+	ctx := context.Background()
+	phone := domain.SessionClient{DeviceID: "phone", DeviceInfo: "Mozilla/5.0"}
+	laptop := domain.SessionClient{DeviceID: "laptop", DeviceInfo: "Mozilla/5.0"}
+	unknown := domain.SessionClient{DeviceInfo: "Mozilla/5.0"}
+
+	devices := make([]domain.SessionClient, domain.MaxUserSessions+1)
+	for i := range devices {
+		devices[i] = domain.SessionClient{DeviceID: fmt.Sprintf("device-%d", i), DeviceInfo: "Mozilla/5.0"}
+	}
+
+	tests := []struct {
+		name string
+		// logins are the devices signing in, in order
+		logins []domain.SessionClient
+		// refresh rotates the refresh token of the first login before the others
+		refresh bool
+		want    int
+	}{
+		{name: "devices sharing a user agent", logins: []domain.SessionClient{phone, laptop}, want: 2},
+		{name: "same device", logins: []domain.SessionClient{phone, phone}, want: 1},
+		{name: "same device after a rotation", logins: []domain.SessionClient{phone, laptop, phone}, refresh: true,
+			want: 2},
+		{name: "clients without a device ID", logins: []domain.SessionClient{unknown, unknown}, want: 2},
+		{name: "more devices than the limit", logins: devices, want: domain.MaxUserSessions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUserRepo{users: map[string]domain.User{"user-1": {ID: "user-1", Login: "alice"}}}
+			us, _, revocations := newTestUserService(t, repo, &fakeLoginLimiter{})
+
+			var last domain.Tokens
+			var started []string
+			for i, client := range tt.logins {
+				tokens, err := us.GenerateUserTokens(ctx, "user-1", client)
+				if err != nil {
+					t.Fatal(err)
+				}
+				started = append(started, repo.sessions[len(repo.sessions)-1].FamilyID)
+
+				if i == 0 && tt.refresh {
+					if _, err := us.RefreshTokens(ctx, tokens.RefreshToken, client); err != nil {
+						t.Fatal(err)
+					}
+				}
+				last = tokens
+			}
+
+			families := map[string]bool{}
+			for _, st := range repo.sessions {
+				if st.RevokedAt == nil {
+					families[st.FamilyID] = true
+				}
+			}
+
+			if len(families) != tt.want {
+				t.Errorf("got %d sessions, want %d", len(families), tt.want)
+			}
+
+			// the access tokens of the replaced and pruned sessions are revoked, the others are kept
+			issuedAt := time.Now().Add(-time.Minute)
+			for _, familyID := range started {
+				revoked := revocations.IsRevoked(domain.TokenClaims{SessionID: familyID, IssuedAt: issuedAt})
+				if revoked == families[familyID] {
+					t.Errorf("session %s revoked = %v, want %v", familyID, revoked, !families[familyID])
+				}
+			}
+
+			// the session opened last is always kept
+			if _, err := us.RefreshTokens(ctx, last.RefreshToken, tt.logins[len(tt.logins)-1]); err != nil {
+				t.Errorf("RefreshTokens() with the latest session error = %v", err)
+			}
+		})
+	}
+}
+
+// newTestUser returns a user with the password hashed at the lowest cost, to keep the tests fast.
+func newTestUser(t *testing.T, id, login, plaintext string) domain.User {
+	t.Helper()
+
+	if err := domain.SetPasswordCost(bcrypt.MinCost); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = domain.SetPasswordCost(domain.DefaultPasswordCost) })
+
+	user := domain.User{ID: id, Login: login, Role: domain.RoleUser, Version: 1}
+	if err := user.Password.Set(plaintext); err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func TestUserService_ChangePassword(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		current    string
+		concurrent bool
+		// twoFactor enables the two-factor authentication, the password must not
+		// reset the failed codes then
+		twoFactor     bool
+		wantErr       error
+		wantFailures  int
+		wantSuccesses int
+	}{
+		{name: "password changed", current: "correct horse", wantSuccesses: 1},
+		{name: "password changed with two-factor", current: "correct horse", twoFactor: true},
+		{name: "wrong current password", current: "wrong horse", wantErr: auth.ErrInvalidCredentials,
+			wantFailures: 1},
+		{name: "account changed meanwhile", current: "correct horse", concurrent: true,
+			wantErr: postgres.ErrEditConflict, wantSuccesses: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := newTestUser(t, "user-1", "alice", "correct horse")
+			user.TwoFactorEnabled = tt.twoFactor
+			repo := &fakeUserRepo{users: map[string]domain.User{"user-1": user}}
+			if tt.concurrent {
+				repo.beforeUpdate = func() {
+					changed := repo.users["user-1"]
+					changed.Version++
+					repo.users["user-1"] = changed
+				}
+			}
+
+			limiter := &fakeLoginLimiter{}
+			us, tm, revocations := newTestUserService(t, repo, limiter)
+
+			// the user is signed in on another device
+			other, err := us.GenerateUserTokens(ctx, "user-1", domain.SessionClient{DeviceID: "phone"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tokens, err := us.ChangePassword(ctx, "user-1", domain.ChangePasswordInput{
+				CurrentPassword: tt.current,
+				NewPassword:     "battery staple",
+			}, domain.SessionClient{DeviceID: "laptop"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ChangePassword() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if limiter.failures != tt.wantFailures || limiter.successes != tt.wantSuccesses {
+				t.Errorf("recorded %d failures and %d successes, want %d and %d", limiter.failures,
+					limiter.successes, tt.wantFailures, tt.wantSuccesses)
+			}
+
+			stored := repo.users["user-1"]
+			changed, err := stored.Password.Matches("battery staple")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantErr != nil {
+				if changed {
+					t.Error("the password was changed")
+				}
+
+				// the other sessions are kept when the password is not changed
+				if _, err := us.RefreshTokens(ctx, other.RefreshToken, domain.SessionClient{}); err != nil {
+					t.Errorf("RefreshTokens() of the other device error = %v", err)
+				}
+				return
+			}
+
+			if !changed {
+				t.Fatal("the new password was not stored")
+			}
+
+			if _, err := us.RefreshTokens(ctx, other.RefreshToken, domain.SessionClient{}); !errors.Is(err,
+				postgres.ErrNoRowsFound) {
+				t.Errorf("RefreshTokens() of the other device error = %v, want %v", err, postgres.ErrNoRowsFound)
+			}
+
+			claims, err := tm.Parse(other.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !revocations.IsRevoked(claims) {
+				t.Error("the access token of the other device is not revoked")
+			}
+
+			// the token issued right after the revocation, usually in the same second, is valid
+			if _, err := us.VerifyToken(ctx, tokens.AccessToken); err != nil {
+				t.Errorf("VerifyToken() of the new session error = %v", err)
+			}
+
+			if _, err := us.RefreshTokens(ctx, tokens.RefreshToken, domain.SessionClient{}); err != nil {
+				t.Errorf("RefreshTokens() of the new session error = %v", err)
+			}
+		})
+	}
+}
+
+func TestUserService_LoginRehashesPassword(t *testing.T) {
+	ctx := context.Background()
+
+	md5Sum := md5.Sum([]byte("correct horse"))
+	sha256Sum := sha256.Sum256([]byte("correct horse"))
+
+	tests := []struct {
+		name string
+		// hash returns the stored hash of "correct horse"
+		hash     func(t *testing.T) []byte
+		wantCost int
+	}{
+		{name: "legacy MD5 hash", hash: func(_ *testing.T) []byte {
+			return []byte(hex.EncodeToString(md5Sum[:]))
+		}, wantCost: bcrypt.MinCost},
+		{name: "legacy SHA-256 hash", hash: func(_ *testing.T) []byte {
+			return []byte(hex.EncodeToString(sha256Sum[:]))
+		}, wantCost: bcrypt.MinCost},
+		{name: "bcrypt hash of a lower cost", hash: func(t *testing.T) []byte {
+			hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := domain.SetPasswordCost(bcrypt.MinCost + 1); err != nil {
+				t.Fatal(err)
+			}
+
+			return hash
+		}, wantCost: bcrypt.MinCost + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := newTestUser(t, "user-1", "alice", "correct horse")
+			user.Password.Hash = tt.hash(t)
+
+			repo := &fakeUserRepo{users: map[string]domain.User{"user-1": user}, rehashed: make(chan []byte, 1)}
+			us, _, _ := newTestUserService(t, repo, &fakeLoginLimiter{})
+
+			// a wrong password neither signs in nor upgrades the hash
+			if _, err := us.Login(ctx, domain.UserAuthInput{Login: "alice", Password: "battery staple"},
+				domain.SessionClient{}); !errors.Is(err, auth.ErrInvalidCredentials) {
+				t.Fatalf("Login() with a wrong password error = %v, want %v", err, auth.ErrInvalidCredentials)
+			}
+
+			if _, err := us.Login(ctx, domain.UserAuthInput{Login: "alice", Password: "correct horse"},
+				domain.SessionClient{}); err != nil {
+				t.Fatalf("Login() error = %v", err)
+			}
+
+			var stored []byte
+			select {
+			case stored = <-repo.rehashed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the password was not rehashed")
+			}
+
+			if cost, err := bcrypt.Cost(stored); err != nil || cost != tt.wantCost {
+				t.Fatalf("stored hash cost = %d, %v, want %d", cost, err, tt.wantCost)
+			}
+
+			if err := bcrypt.CompareHashAndPassword(stored, []byte("correct horse")); err != nil {
+				t.Errorf("the stored hash does not match the password: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/internal/repository"
+	"github.com/mihailtudos/gophermart/pkg/netguard"
+)
+
+const (
+	WebhookEventHeaderName     = "X-Gophermart-Event"
+	WebhookDeliveryHeaderName  = "X-Gophermart-Delivery"
+	WebhookTimestampHeaderName = "X-Gophermart-Timestamp"
+	WebhookSignatureHeaderName = "X-Gophermart-Signature"
+
+	webhookSecretPrefix = "whsec_"
+	webhookSecretBytes  = 32
+
+	// limits how much of the receiver response is read before the connection is reused
+	webhookResponseReadLimit = 4 << 10
+
+	webhookMaxIdleConns    = 100
+	webhookIdleConnTimeout = 90 * time.Second
+)
+
+type webhookPayload struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type WebhookService struct {
+	repo   repository.WebhookRepo
+	client *http.Client
+	cfg    config.WebhookConfig
+}
+
+func NewWebhookService(repo repository.WebhookRepo, cfg config.WebhookConfig) (*WebhookService, error) {
+	// the addresses are checked when connecting, a host resolving to another address
+	// than when the webhook was created is refused as well
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateTargets {
+		dialer.Control = netguard.Control
+	}
+
+	return &WebhookService{
+		repo: repo,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// no proxy is used, it would connect to the target instead of the dialer
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				ForceAttemptHTTP2:   true,
+				MaxIdleConns:        webhookMaxIdleConns,
+				IdleConnTimeout:     webhookIdleConnTimeout,
+				TLSHandshakeTimeout: cfg.Timeout,
+			},
+			// a redirect could lead anywhere, the response is recorded as a failure instead
+			CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		cfg: cfg,
+	}, nil
+}
+
+// CreateWebhook registers the webhook with a new secret, its host must only resolve
+// to public addresses.
+func (ws *WebhookService) CreateWebhook(ctx context.Context, webhook domain.Webhook) (domain.Webhook, error) {
+	if !ws.cfg.AllowPrivateTargets {
+		u, err := url.Parse(webhook.URL)
+		if err != nil {
+			return domain.Webhook{}, err
+		}
+
+		if err := netguard.CheckHost(ctx, u.Hostname()); err != nil {
+			return domain.Webhook{}, err
+		}
+	}
+
+	b := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return domain.Webhook{}, err
+	}
+
+	webhook.Secret = webhookSecretPrefix + hex.EncodeToString(b)
+
+	return ws.repo.CreateWebhook(ctx, webhook)
+}
+
+func (ws *WebhookService) GetWebhooks(ctx context.Context, userID string) ([]domain.Webhook, error) {
+	return ws.repo.GetWebhooks(ctx, userID)
+}
+
+func (ws *WebhookService) DeleteWebhook(ctx context.Context, userID, webhookID string) error {
+	return ws.repo.DeleteWebhook(ctx, userID, webhookID)
+}
+
+func (ws *WebhookService) GetWebhookDeliveries(ctx context.Context,
+	userID, webhookID string) ([]domain.WebhookDelivery, error) {
+	return ws.repo.GetWebhookDeliveries(ctx, userID, webhookID)
+}
+
+func (ws *WebhookService) DeliverWebhooksInBackground(ctx context.Context, jobInterval time.Duration) {
+	ticker := time.NewTicker(jobInterval)
+
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				logger.Log.Warn("recover from panic ", slog.Any("err", p))
+			}
+		}()
+
+		for {
+			select {
+			case <-ticker.C:
+				ws.deliverPending(ctx)
+			case <-ctx.Done():
+				logger.Log.Info("shutting down the webhooks delivery process...")
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (ws *WebhookService) deliverPending(ctx context.Context) {
+	// the lease outlives the request timeout so that a delivery is never sent twice in parallel
+	deliveries, err := ws.repo.LeasePendingWebhookDeliveries(ctx, ws.cfg.BatchSize, 2*ws.cfg.Timeout)
+	if err != nil {
+		logger.Log.ErrorContext(ctx, "webhooks: lease pending deliveries", slog.String("err", err.Error()))
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(d domain.WebhookDelivery) {
+			defer wg.Done()
+			ws.deliver(ctx, d)
+		}(delivery)
+	}
+
+	wg.Wait()
+}
+
+func (ws *WebhookService) deliver(ctx context.Context, delivery domain.WebhookDelivery) {
+	started := time.Now()
+	status, err := ws.send(ctx, delivery)
+
+	attempt := domain.WebhookDeliveryAttempt{
+		DeliveryID: delivery.ID,
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+
+	if status != 0 {
+		attempt.ResponseStatus = &status
+	}
+
+	delivery.Attempts++
+
+	switch {
+	case err == nil:
+		now := time.Now()
+		delivery.Status = domain.WebhookDeliveryStatusDelivered
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = now
+	case delivery.Attempts >= ws.cfg.MaxAttempts:
+		msg := err.Error()
+		attempt.Error = &msg
+		delivery.Status = domain.WebhookDeliveryStatusFailed
+		delivery.NextAttemptAt = time.Now()
+	default:
+		msg := err.Error()
+		attempt.Error = &msg
+		delivery.Status = domain.WebhookDeliveryStatusPending
+		delivery.NextAttemptAt = time.Now().Add(ws.retryDelay(delivery.Attempts))
+	}
+
+	disabled, err := ws.repo.RecordWebhookDeliveryAttempt(ctx, delivery, attempt, ws.cfg.DisableAfterFailures)
+	if err != nil {
+		logger.Log.ErrorContext(ctx, "webhooks: record delivery attempt",
+			slog.String("delivery", delivery.ID),
+			slog.String("err", err.Error()))
+		return
+	}
+
+	if disabled {
+		logger.Log.WarnContext(ctx, "webhook disabled after repeated failures",
+			slog.String("webhook", delivery.WebhookID))
+	}
+}
+
+func (ws *WebhookService) send(ctx context.Context, delivery domain.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(webhookPayload{
+		ID:        delivery.ID,
+		Type:      delivery.EventType,
+		CreatedAt: delivery.CreatedAt,
+		Data:      delivery.Payload,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal webhook body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gophermart-webhooks")
+	req.Header.Set(WebhookEventHeaderName, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeaderName, delivery.ID)
+	req.Header.Set(WebhookTimestampHeaderName, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeaderName, SignWebhookPayload(delivery.Secret, timestamp, body))
+
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute webhook request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, webhookResponseReadLimit))
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp.StatusCode, fmt.Errorf("received non-2xx status code: %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// retryDelay doubles the base delay for every failed attempt, up to the configured maximum.
+func (ws *WebhookService) retryDelay(attempts int) time.Duration {
+	delay := ws.cfg.RetryBaseDelay
+	for i := 1; i < attempts && delay < ws.cfg.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, ws.cfg.RetryMaxDelay)
+}
+
+// SignWebhookPayload computes the signature sent along with the webhook, receivers
+// verify it by computing the HMAC-SHA256 of "<timestamp>.<body>" with the webhook secret.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
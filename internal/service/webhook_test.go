@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mihailtudos/gophermart/internal/config"
+	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/logger"
+	"github.com/mihailtudos/gophermart/pkg/netguard"
+)
+
+type fakeWebhookRepo struct {
+	pending  []domain.WebhookDelivery
+	recorded []domain.WebhookDelivery
+	attempts []domain.WebhookDeliveryAttempt
+}
+
+func (f *fakeWebhookRepo) CreateWebhook(_ context.Context, webhook domain.Webhook) (domain.Webhook, error) {
+	return webhook, nil
+}
+
+func (f *fakeWebhookRepo) GetWebhooks(_ context.Context, _ string) ([]domain.Webhook, error) {
+	return nil, nil
+}
+
+func (f *fakeWebhookRepo) DeleteWebhook(_ context.Context, _, _ string) error {
+	return nil
+}
+
+func (f *fakeWebhookRepo) GetWebhookDeliveries(_ context.Context, _, _ string) ([]domain.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (f *fakeWebhookRepo) LeasePendingWebhookDeliveries(_ context.Context,
+	_ int, _ time.Duration) ([]domain.WebhookDelivery, error) {
+	pending := f.pending
+	f.pending = nil
+	return pending, nil
+}
+
+func (f *fakeWebhookRepo) RecordWebhookDeliveryAttempt(_ context.Context,
+	delivery domain.WebhookDelivery,
+	attempt domain.WebhookDeliveryAttempt,
+	_ int) (bool, error) {
+	f.recorded = append(f.recorded, delivery)
+	f.attempts = append(f.attempts, attempt)
+	return false, nil
+}
+
+// newTestWebhookService allows the private targets, the test receivers listen on the loopback.
+func newTestWebhookService(repo *fakeWebhookRepo) *WebhookService {
+	return newTestWebhookServiceWithTargets(repo, true)
+}
+
+func newTestWebhookServiceWithTargets(repo *fakeWebhookRepo, allowPrivateTargets bool) *WebhookService {
+	logger.Init(io.Discard, "error")
+
+	ws, _ := NewWebhookService(repo, config.WebhookConfig{
+		Timeout:              time.Second,
+		RetryBaseDelay:       time.Minute,
+		RetryMaxDelay:        time.Hour,
+		MaxAttempts:          3,
+		DisableAfterFailures: 10,
+		BatchSize:            10,
+		AllowPrivateTargets:  allowPrivateTargets,
+	})
+
+	return ws
+}
+
+func TestWebhookService_DeliverSigned(t *testing.T) {
+	const secret = "whsec_test"
+
+	var verified bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(WebhookTimestampHeaderName), 10, 64)
+
+		verified = r.Header.Get(WebhookSignatureHeaderName) == SignWebhookPayload(secret, timestamp, body) &&
+			r.Header.Get(WebhookEventHeaderName) == domain.WebhookEventOrderProcessed &&
+			r.Header.Get(WebhookDeliveryHeaderName) == "delivery-1"
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	repo := &fakeWebhookRepo{pending: []domain.WebhookDelivery{{
+		ID:        "delivery-1",
+		WebhookID: "webhook-1",
+		EventType: domain.WebhookEventOrderProcessed,
+		Payload:   []byte(`{"number":"9278923470"}`),
+		Status:    domain.WebhookDeliveryStatusPending,
+		URL:       receiver.URL,
+		Secret:    secret,
+	}}}
+
+	newTestWebhookService(repo).deliverPending(context.Background())
+
+	if !verified {
+		t.Error("receiver could not verify the webhook signature and headers")
+	}
+
+	if len(repo.recorded) != 1 {
+		t.Fatalf("recorded %d delivery attempts, want 1", len(repo.recorded))
+	}
+
+	if got := repo.recorded[0]; got.Status != domain.WebhookDeliveryStatusDelivered || got.DeliveredAt == nil {
+		t.Errorf("delivery status = %s, want %s", got.Status, domain.WebhookDeliveryStatusDelivered)
+	}
+
+	if repo.attempts[0].Error != nil {
+		t.Errorf("successful attempt logged error %q", *repo.attempts[0].Error)
+	}
+}
+
+func TestWebhookService_DeliverRetries(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	tests := []struct {
+		name       string
+		attempts   int
+		wantStatus string
+	}{
+		{
+			name:       "first failure is retried",
+			attempts:   0,
+			wantStatus: domain.WebhookDeliveryStatusPending,
+		},
+		{
+			name:       "last attempt fails the delivery",
+			attempts:   2,
+			wantStatus: domain.WebhookDeliveryStatusFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeWebhookRepo{pending: []domain.WebhookDelivery{{
+				ID:       "delivery-1",
+				Status:   domain.WebhookDeliveryStatusPending,
+				Attempts: tt.attempts,
+				URL:      receiver.URL,
+			}}}
+
+			before := time.Now()
+			newTestWebhookService(repo).deliverPending(context.Background())
+
+			got := repo.recorded[0]
+			if got.Status != tt.wantStatus {
+				t.Errorf("delivery status = %s, want %s", got.Status, tt.wantStatus)
+			}
+
+			if got.Attempts != tt.attempts+1 {
+				t.Errorf("delivery attempts = %d, want %d", got.Attempts, tt.attempts+1)
+			}
+
+			if tt.wantStatus == domain.WebhookDeliveryStatusPending && got.NextAttemptAt.Before(before.Add(time.Minute)) {
+				t.Errorf("next attempt scheduled at %v, want at least a minute later", got.NextAttemptAt)
+			}
+
+			attempt := repo.attempts[0]
+			if attempt.Error == nil || attempt.ResponseStatus == nil || *attempt.ResponseStatus != http.StatusInternalServerError {
+				t.Errorf("failed attempt was not logged with the response status")
+			}
+		})
+	}
+}
+
+func TestWebhookService_retryDelay(t *testing.T) {
+	ws := newTestWebhookService(&fakeWebhookRepo{})
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Minute},
+		{attempts: 2, want: 2 * time.Minute},
+		{attempts: 4, want: 8 * time.Minute},
+		{attempts: 20, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := ws.retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookService_CreateWebhookTargets(t *testing.T) {
+	ws := newTestWebhookServiceWithTargets(&fakeWebhookRepo{}, false)
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr error
+	}{
+		{name: "public address", url: "https://93.184.216.34/hooks"},
+		{name: "loopback", url: "http://127.0.0.1:8080/hooks", wantErr: netguard.ErrForbiddenAddress},
+		{name: "localhost", url: "http://localhost/hooks", wantErr: netguard.ErrForbiddenAddress},
+		{name: "metadata endpoint", url: "http://169.254.169.254/latest/meta-data",
+			wantErr: netguard.ErrForbiddenAddress},
+		{name: "private IPv6", url: "http://[fd00::1]/hooks", wantErr: netguard.ErrForbiddenAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ws.CreateWebhook(context.Background(), domain.Webhook{URL: tt.url})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CreateWebhook(%s) error = %v, want %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookService_DeliverRefusedTargets(t *testing.T) {
+	var hits int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	redirect := httptest.NewServer(http.RedirectHandler(receiver.URL, http.StatusTemporaryRedirect))
+	defer redirect.Close()
+
+	tests := []struct {
+		name                string
+		url                 string
+		allowPrivateTargets bool
+		wantStatus          *int
+	}{
+		{name: "loopback target", url: receiver.URL},
+		{name: "redirect is not followed", url: redirect.URL, allowPrivateTargets: true,
+			wantStatus: ptr(http.StatusTemporaryRedirect)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeWebhookRepo{pending: []domain.WebhookDelivery{{
+				ID:     "delivery-1",
+				Status: domain.WebhookDeliveryStatusPending,
+				URL:    tt.url,
+			}}}
+
+			newTestWebhookServiceWithTargets(repo, tt.allowPrivateTargets).deliverPending(context.Background())
+
+			if hits != 0 {
+				t.Fatalf("receiver was hit %d times, want 0", hits)
+			}
+
+			attempt := repo.attempts[0]
+			if attempt.Error == nil {
+				t.Fatal("refused delivery was not logged as failed")
+			}
+
+			if (attempt.ResponseStatus == nil) != (tt.wantStatus == nil) ||
+				(tt.wantStatus != nil && *attempt.ResponseStatus != *tt.wantStatus) {
+				t.Errorf("response status = %v, want %v", attempt.ResponseStatus, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
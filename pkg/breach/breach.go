@@ -0,0 +1,84 @@
+// Package breach checks passwords against a local copy of a breached-password
+// corpus, so that no network access is needed at sign-up.
+//
+// The corpus is a k-anonymity SHA-1 prefix index: a directory of <PREFIX>.txt
+// files, one per 5 hex digit prefix, holding the SUFFIX:COUNT lines of the hashes
+// sharing the prefix. It is the layout written by the Pwned Passwords downloader.
+package breach
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	prefixLength = 5
+	fileExt      = ".txt"
+)
+
+type Index struct {
+	dir string
+	// minCount ignores the hashes seen fewer times, the downloader pads the
+	// files with entries counted 0
+	minCount int
+}
+
+func NewIndex(dir string, minCount int) (*Index, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the breached password index: %w", err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("the breached password index %s is not a directory", dir)
+	}
+
+	if minCount < 1 {
+		minCount = 1
+	}
+
+	return &Index{dir: dir, minCount: minCount}, nil
+}
+
+// Breached reports whether the password appears in the corpus, only the file of
+// its hash prefix is read.
+func (i *Index) Breached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	f, err := os.Open(filepath.Join(i.dir, prefix+fileExt))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineSuffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return false, fmt.Errorf("malformed breached password entry in %s: %w", f.Name(), err)
+		}
+
+		return n >= i.minCount, nil
+	}
+
+	return false, scanner.Err()
+}
@@ -0,0 +1,69 @@
+package breach
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndex_Breached(t *testing.T) {
+	dir := t.TempDir()
+
+	// SHA-1("password") is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	data := "1E4C9B93F3F0682250B6CF8331B7EE68FD8:10434004\r\n" +
+		"0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n"
+	if err := os.WriteFile(filepath.Join(dir, "5BAA6.txt"), []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := NewIndex(dir, 1)
+	if err != nil {
+		t.Fatalf("NewIndex() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     bool
+	}{
+		{name: "breached", password: "password", want: true},
+		{name: "missing prefix file", password: "a very unlikely passphrase", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := index.Breached(tt.password)
+			if err != nil {
+				t.Fatalf("Breached() error = %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Breached(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndex_MinCount(t *testing.T) {
+	dir := t.TempDir()
+
+	data := "1E4C9B93F3F0682250B6CF8331B7EE68FD8:0\n"
+	if err := os.WriteFile(filepath.Join(dir, "5BAA6.txt"), []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := NewIndex(dir, 0)
+	if err != nil {
+		t.Fatalf("NewIndex() error = %v", err)
+	}
+
+	if got, err := index.Breached("password"); err != nil || got {
+		t.Errorf("Breached() = %v, %v, padding entries must be ignored", got, err)
+	}
+}
+
+func TestNewIndex_MissingDir(t *testing.T) {
+	if _, err := NewIndex(filepath.Join(t.TempDir(), "missing"), 1); err == nil {
+		t.Error("NewIndex() expected an error for a missing directory")
+	}
+}
@@ -1,8 +1,9 @@
 package hash
 
 import (
-	"crypto"
-	"fmt"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 )
 
 // PasswordHasher provides hashing logic to securely store passwords.
@@ -10,7 +11,7 @@ type PasswordHasher interface {
 	Hash(password string) (string, error)
 }
 
-// SHA1Hasher uses SHA1 to hash passwords with provided salt.
+// SHA256Hasher uses HMAC-SHA256 keyed with the provided salt to hash secrets.
 type SHA256Hasher struct {
 	salt string
 }
@@ -19,13 +20,13 @@ func NewSHA256Hasher(salt string) *SHA256Hasher {
 	return &SHA256Hasher{salt: salt}
 }
 
-// Hash creates SHA1 hash of given password.
+// Hash creates a hex encoded HMAC-SHA256 of the given password.
 func (h *SHA256Hasher) Hash(password string) (string, error) {
-	hash := crypto.SHA256.New()
+	mac := hmac.New(sha256.New, []byte(h.salt))
 
-	if _, err := hash.Write([]byte(password)); err != nil {
+	if _, err := mac.Write([]byte(password)); err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("%x", hash.Sum([]byte(h.salt))), nil
+	return hex.EncodeToString(mac.Sum(nil)), nil
 }
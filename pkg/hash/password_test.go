@@ -0,0 +1,38 @@
+package hash
+
+import "testing"
+
+func TestSHA256Hasher_Hash(t *testing.T) {
+	tests := []struct {
+		name     string
+		salt     string
+		password string
+		want     string
+	}{
+		{
+			name:     "RFC 4231 test case 2",
+			salt:     "Jefe",
+			password: "what do ya want for nothing?",
+			want:     "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843",
+		},
+		{
+			name:     "empty salt",
+			salt:     "",
+			password: "",
+			want:     "b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewSHA256Hasher(tt.salt).Hash(tt.password)
+			if err != nil {
+				t.Fatalf("Hash() error = %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Hash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
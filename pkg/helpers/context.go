@@ -9,7 +9,11 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey   = contextKey("user")
+	claimsContextKey = contextKey("claims")
+	apiKeyContextKey = contextKey("api_key")
+)
 
 func ContextSetUser(r *http.Request, user domain.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -25,3 +29,30 @@ func ContextGetUser(r *http.Request) domain.User {
 
 	return user
 }
+
+func ContextSetTokenClaims(r *http.Request, claims domain.TokenClaims) *http.Request {
+	ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+	return r.WithContext(ctx)
+}
+
+func ContextGetTokenClaims(r *http.Request) domain.TokenClaims {
+	claims, ok := r.Context().Value(claimsContextKey).(domain.TokenClaims)
+
+	if !ok {
+		panic("missing token claims value in request context")
+	}
+
+	return claims
+}
+
+func ContextSetAPIKey(r *http.Request, key domain.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// ContextGetAPIKey returns the API key the request was authenticated with, ok is
+// false when it was authenticated with an access token.
+func ContextGetAPIKey(r *http.Request) (domain.APIKey, bool) {
+	key, ok := r.Context().Value(apiKeyContextKey).(domain.APIKey)
+	return key, ok
+}
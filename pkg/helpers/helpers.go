@@ -5,9 +5,26 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/mihailtudos/gophermart/internal/domain"
+	"github.com/mihailtudos/gophermart/internal/validator"
+)
+
+const (
+	RefreshTokenCookieName = "refresh_token"
+
+	// AccessTokenCookieName and CSRFTokenCookieName are only issued in the cookie
+	// session mode, the CSRF token must be echoed in the CSRFTokenHeaderName header.
+	AccessTokenCookieName = "access_token"
+	CSRFTokenCookieName   = "csrf_token"
+	CSRFTokenHeaderName   = "X-CSRF-Token"
+
+	// DeviceIDCookieName holds the server issued ID the sessions of a device are grouped by.
+	DeviceIDCookieName = "device_id"
 )
 
 type Envelope map[string]any
@@ -18,7 +35,7 @@ func SetAuthorizationHeaders(w http.ResponseWriter, tokens domain.Tokens) {
 
 	// Set the refresh token as a secure HTTP-only cookie
 	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
+		Name:     RefreshTokenCookieName,
 		Value:    tokens.RefreshToken,
 		HttpOnly: true, // Prevents access by JavaScript
 		Secure:   true, // Ensures it is only sent over HTTPS
@@ -26,6 +43,44 @@ func SetAuthorizationHeaders(w http.ResponseWriter, tokens domain.Tokens) {
 	})
 }
 
+// ClearRefreshTokenCookie removes the refresh token cookie from the client.
+func ClearRefreshTokenCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     RefreshTokenCookieName,
+		Value:    "",
+		HttpOnly: true,
+		Secure:   true,
+		Path:     "/",
+		MaxAge:   -1,
+	})
+}
+
+// ClearSessionCookies removes the refresh token and the cookie session mode cookies from the client.
+func ClearSessionCookies(w http.ResponseWriter) {
+	ClearRefreshTokenCookie(w)
+
+	for _, name := range []string{AccessTokenCookieName, CSRFTokenCookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			HttpOnly: name == AccessTokenCookieName,
+			Secure:   true,
+			Path:     "/",
+			MaxAge:   -1,
+		})
+	}
+}
+
+// ClientIP returns the IP address of the client from the connection's remote address.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
 func WriteUnwrappedJSON(w http.ResponseWriter, status int, data any, headers http.Header) error {
 	js, err := json.MarshalIndent(data, "", "\t")
 	if err != nil {
@@ -93,3 +148,20 @@ func ReadJSON(w http.ResponseWriter, r *http.Request, dst any) error {
 
 	return nil
 }
+
+// ReadInt returns the integer query string value of key, or defaultValue when it is missing.
+// An invalid value is recorded in the validator.
+func ReadInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
+}
@@ -0,0 +1,92 @@
+// Package netguard keeps the requests sent to user supplied URLs away from the
+// internal network, such as loopback services or the cloud metadata endpoint.
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+var (
+	ErrForbiddenAddress = errors.New("the address is not publicly routable")
+	ErrUnresolvableHost = errors.New("the host could not be resolved")
+)
+
+// nonPublicPrefixes are the ranges not covered by the netip predicates.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT, also used by some cloud metadata services
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64 maps to IPv4 addresses that may be private
+}
+
+// IsPublic reports whether the address is publicly routable, loopback, private,
+// link-local, multicast and reserved addresses are not.
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsValid() ||
+		addr.IsUnspecified() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CheckHost resolves the host and fails unless all of its addresses are public.
+func CheckHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !IsPublic(addr) {
+			return ErrForbiddenAddress
+		}
+
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnresolvableHost, err)
+	}
+
+	for _, addr := range addrs {
+		if !IsPublic(addr) {
+			return ErrForbiddenAddress
+		}
+	}
+
+	return nil
+}
+
+// Control is a net.Dialer Control function refusing to connect to addresses
+// which are not public. It runs after the name resolution, so a host resolving
+// to another address than when it was checked is still refused.
+func Control(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrForbiddenAddress, err)
+	}
+
+	if !IsPublic(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addrPort.Addr())
+	}
+
+	return nil
+}
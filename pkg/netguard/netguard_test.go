@@ -0,0 +1,79 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "93.184.216.34", want: true},
+		{addr: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{addr: "127.0.0.1", want: false},
+		{addr: "::1", want: false},
+		{addr: "10.1.2.3", want: false},
+		{addr: "172.16.0.1", want: false},
+		{addr: "192.168.1.1", want: false},
+		{addr: "169.254.169.254", want: false},
+		{addr: "100.100.100.200", want: false},
+		{addr: "0.0.0.0", want: false},
+		{addr: "fe80::1", want: false},
+		{addr: "fd00::1", want: false},
+		{addr: "::ffff:127.0.0.1", want: false},
+		{addr: "64:ff9b::a9fe:a9fe", want: false},
+		{addr: "224.0.0.1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := IsPublic(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("IsPublic(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		wantErr error
+	}{
+		{host: "93.184.216.34"},
+		{host: "127.0.0.1", wantErr: ErrForbiddenAddress},
+		{host: "localhost", wantErr: ErrForbiddenAddress},
+		{host: "host.invalid", wantErr: ErrUnresolvableHost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if err := CheckHost(context.Background(), tt.host); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckHost(%s) error = %v, want %v", tt.host, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestControl(t *testing.T) {
+	tests := []struct {
+		address string
+		wantErr error
+	}{
+		{address: "93.184.216.34:443"},
+		{address: "127.0.0.1:8080", wantErr: ErrForbiddenAddress},
+		{address: "[fe80::1]:80", wantErr: ErrForbiddenAddress},
+		{address: "not-an-address", wantErr: ErrForbiddenAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			if err := Control("tcp", tt.address, nil); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Control(%s) error = %v, want %v", tt.address, err, tt.wantErr)
+			}
+		})
+	}
+}
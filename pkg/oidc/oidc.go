@@ -0,0 +1,434 @@
+// Package oidc is a minimal OpenID Connect relying party implementing the
+// authorization code flow with PKCE: discovery, code exchange and validation
+// of the ID token against the JWKS of the provider.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+
+	// leeway tolerates the clock drift between us and the provider
+	leeway = time.Minute
+
+	maxResponseBytes = 1 << 20
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrUnknownKey     = errors.New("unknown id token signing key")
+)
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// discovery holds the endpoints read from the discovery document.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims is the identity asserted by a verified ID token.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type Provider struct {
+	cfg       Config
+	client    *http.Client
+	endpoints discovery
+
+	mu   sync.RWMutex
+	keys map[string]crypto.PublicKey
+}
+
+// NewProvider reads the discovery document of the issuer, the issuer it declares
+// must be the configured one.
+func NewProvider(ctx context.Context, cfg Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	p := &Provider{cfg: cfg, client: client}
+
+	if err := p.getJSON(ctx, strings.TrimSuffix(cfg.Issuer, "/")+discoveryPath, &p.endpoints); err != nil {
+		return nil, fmt.Errorf("failed to read the discovery document: %w", err)
+	}
+
+	if p.endpoints.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("the discovery document is for the issuer %q, not %q", p.endpoints.Issuer, cfg.Issuer)
+	}
+
+	if p.endpoints.AuthorizationEndpoint == "" || p.endpoints.TokenEndpoint == "" || p.endpoints.JWKSURI == "" {
+		return nil, errors.New("the discovery document misses an endpoint")
+	}
+
+	return p, nil
+}
+
+func (p *Provider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+// AuthCodeURL returns the URL the user is sent to for signing in at the provider.
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {CodeChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(p.endpoints.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return p.endpoints.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// Exchange redeems the authorization code and returns the claims of the verified ID token.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Claims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoints.TokenEndpoint,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Claims{}, fmt.Errorf("failed to redeem the authorization code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Claims{}, fmt.Errorf("the token endpoint responded with %d: %s", resp.StatusCode, body)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return Claims{}, fmt.Errorf("failed to decode the token response: %w", err)
+	}
+
+	if tokens.IDToken == "" {
+		return Claims{}, errors.New("the token response has no id token")
+	}
+
+	return p.Verify(ctx, tokens.IDToken, nonce)
+}
+
+// idTokenClaims are the claims of an ID token, the audience may be a string or a list.
+type idTokenClaims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	AuthorizedBy  string   `json:"azp"`
+	ExpiresAt     int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// Valid is called by the parser, the claims are checked by Verify instead.
+func (c *idTokenClaims) Valid() error {
+	return nil
+}
+
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+
+	*a = list
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Verify checks the signature of the ID token with the provider keys and its
+// issuer, audience, lifetime and nonce.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	var c idTokenClaims
+
+	_, err := jwt.ParseWithClaims(rawIDToken, &c, func(token *jwt.Token) (interface{}, error) {
+		return p.verificationKey(ctx, token)
+	})
+	if err != nil {
+		var ve *jwt.ValidationError
+		if errors.As(err, &ve) && errors.Is(ve.Inner, ErrUnknownKey) {
+			return Claims{}, ErrUnknownKey
+		}
+
+		return Claims{}, fmt.Errorf("%w: %s", ErrInvalidIDToken, err.Error())
+	}
+
+	now := time.Now()
+
+	switch {
+	case c.Issuer != p.cfg.Issuer:
+		return Claims{}, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, c.Issuer)
+	case !c.Audience.contains(p.cfg.ClientID):
+		return Claims{}, fmt.Errorf("%w: not issued for this client", ErrInvalidIDToken)
+	case len(c.Audience) > 1 && c.AuthorizedBy != p.cfg.ClientID:
+		return Claims{}, fmt.Errorf("%w: not authorized for this client", ErrInvalidIDToken)
+	case c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(leeway)):
+		return Claims{}, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	case c.IssuedAt != 0 && now.Add(leeway).Before(time.Unix(c.IssuedAt, 0)):
+		return Claims{}, fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	case c.Nonce != nonce:
+		return Claims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	case c.Subject == "":
+		return Claims{}, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	return Claims{
+		Subject:       c.Subject,
+		Email:         c.Email,
+		EmailVerified: c.EmailVerified,
+		Name:          c.Name,
+	}, nil
+}
+
+// verificationKey returns the provider key the token was signed with, the JWKS is
+// fetched again when the kid is unknown so that rotated keys are picked up.
+func (p *Provider) verificationKey(ctx context.Context, token *jwt.Token) (crypto.PublicKey, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := p.key(kid)
+	if !ok {
+		if err := p.refreshKeys(ctx); err != nil {
+			return nil, err
+		}
+
+		if key, ok = p.key(kid); !ok {
+			return nil, ErrUnknownKey
+		}
+	}
+
+	// the algorithm must match the key type, symmetric and none are never accepted
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v for an RSA key", token.Header["alg"])
+		}
+	case *ecdsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v for an EC key", token.Header["alg"])
+		}
+	default:
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+func (p *Provider) key(kid string) (crypto.PublicKey, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (p *Provider) refreshKeys(ctx context.Context) error {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := p.getJSON(ctx, p.endpoints.JWKSURI, &set); err != nil {
+		return fmt.Errorf("failed to read the provider keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		// keys of unsupported types are skipped rather than failing the whole set
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	return nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %d", url, resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(v)
+}
+
+// NewRandomString returns a random URL-safe string, used for the state, the nonce
+// and the PKCE code verifier.
+func NewRandomString() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge derives the S256 PKCE code challenge of the verifier.
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,229 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	testClientID = "gophermart"
+	testKid      = "key-1"
+)
+
+// fakeIdP is an in-process OpenID provider issuing ID tokens for a single code.
+type fakeIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	code      string
+	challenge string
+	claims    jwt.MapClaims
+	kid       string
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &fakeIdP{key: key, kid: testKid}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(discovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string][]jwk{"keys": {{
+			Kty: "RSA",
+			Kid: testKid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, _, _ := r.BasicAuth()
+		if r.PostFormValue("code") != idp.code || clientID != testClientID ||
+			CodeChallenge(r.PostFormValue("code_verifier")) != idp.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idp.sign(t)})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *fakeIdP) sign(t *testing.T) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+	token.Header["kid"] = idp.kid
+
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	idp := newFakeIdP(t)
+
+	p, err := NewProvider(context.Background(), Config{
+		Issuer:      idp.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://gophermart.example/api/user/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+	}, idp.server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            idp.server.URL,
+			"sub":            "subject-1",
+			"aud":            testClientID,
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          "nonce-1",
+			"email":          "gopher@example.com",
+			"email_verified": true,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(c jwt.MapClaims)
+		kid      string
+		verifier string
+		wantErr  error
+		// the provider refuses to redeem the code, its error is not ours
+		wantExchangeErr bool
+	}{
+		{name: "valid id token"},
+		{name: "audience list with the authorized party", modify: func(c jwt.MapClaims) {
+			c["aud"] = []string{"other", testClientID}
+			c["azp"] = testClientID
+		}},
+		{name: "other nonce", modify: func(c jwt.MapClaims) { c["nonce"] = "nonce-2" }, wantErr: ErrInvalidIDToken},
+		{name: "other audience", modify: func(c jwt.MapClaims) { c["aud"] = "other" }, wantErr: ErrInvalidIDToken},
+		{name: "other issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example" },
+			wantErr: ErrInvalidIDToken},
+		{name: "expired", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+			wantErr: ErrInvalidIDToken},
+		{name: "unknown signing key", kid: "key-2", wantErr: ErrUnknownKey},
+		{name: "wrong code verifier", verifier: "other-verifier", wantExchangeErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := NewRandomString()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			authURL, err := url.Parse(p.AuthCodeURL("state-1", "nonce-1", verifier))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			idp.code = "code-1"
+			idp.challenge = authURL.Query().Get("code_challenge")
+			idp.claims = validClaims()
+			idp.kid = testKid
+
+			if tt.modify != nil {
+				tt.modify(idp.claims)
+			}
+
+			if tt.kid != "" {
+				idp.kid = tt.kid
+			}
+
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+
+			claims, err := p.Exchange(context.Background(), "code-1", verifier, "nonce-1")
+			if tt.wantExchangeErr {
+				if err == nil {
+					t.Fatal("expected the code exchange to fail")
+				}
+				return
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && (claims.Subject != "subject-1" || !claims.EmailVerified) {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestProvider_RejectsSymmetricTokens(t *testing.T) {
+	idp := newFakeIdP(t)
+
+	p, err := NewProvider(context.Background(), Config{Issuer: idp.server.URL, ClientID: testClientID},
+		idp.server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an attacker signing with the public key as an HMAC secret
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"sub":   "subject-1",
+		"aud":   testClientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": "nonce-1",
+	})
+	token.Header["kid"] = testKid
+
+	signed, err := token.SignedString(idp.key.N.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Verify(context.Background(), signed, "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidIDToken)
+	}
+}
+
+func TestNewProvider_IssuerMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+
+	_, err := NewProvider(context.Background(), Config{Issuer: idp.server.URL + "/"}, idp.server.Client())
+	if err == nil {
+		t.Error("expected the issuer mismatch to be rejected")
+	}
+}
@@ -0,0 +1,118 @@
+// Package totp implements the time-based one-time passwords of RFC 6238 with
+// the defaults authenticator apps expect: HMAC-SHA1, 6 digits and 30 second steps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+
+	secretSize = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random base32 encoded secret.
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretSize)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(b), nil
+}
+
+// Step returns the time step t falls into.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code computes the HOTP value (RFC 4226) of the key for the given step.
+func Code(key []byte, step int64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// CodeAt returns the code of the base32 encoded secret at t.
+func CodeAt(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return Code(key, Step(t), Digits), nil
+}
+
+// Validate checks the code against the steps around t, skew steps in both
+// directions are accepted to tolerate clock drift. Steps up to lastStep are
+// rejected so that a code can not be replayed, the matched step is returned
+// to be stored as the new lastStep.
+func Validate(secret, code string, t time.Time, skew int, lastStep int64) (int64, bool) {
+	key, err := decodeSecret(secret)
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+	for i := -int64(skew); i <= int64(skew); i++ {
+		step := current + i
+		if step <= lastStep {
+			continue
+		}
+
+		if hmac.Equal([]byte(Code(key, step, Digits)), []byte(code)) {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// URI returns the otpauth:// URI authenticator apps enroll from, usually shown as a QR code.
+func URI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+
+	return u.String()
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	return encoding.DecodeString(strings.TrimRight(strings.ToUpper(secret), "="))
+}
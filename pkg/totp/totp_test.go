@@ -0,0 +1,81 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Key is the SHA1 seed of the RFC 6238 appendix B test vectors.
+var rfc6238Key = []byte("12345678901234567890")
+
+func TestCode_RFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "94287082"},
+		{unix: 1111111109, want: "07081804"},
+		{unix: 1111111111, want: "14050471"},
+		{unix: 1234567890, want: "89005924"},
+		{unix: 2000000000, want: "69279037"},
+		{unix: 20000000000, want: "65353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := Code(rfc6238Key, Step(time.Unix(tt.unix, 0)), 8); got != tt.want {
+				t.Errorf("Code() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := encoding.EncodeToString(rfc6238Key)
+	now := time.Unix(1111111109, 0)
+	step := Step(now)
+	code := func(step int64) string { return Code(rfc6238Key, step, Digits) }
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", code: code(step), wantStep: step, wantOK: true},
+		{name: "previous step within skew", code: code(step - 1), wantStep: step - 1, wantOK: true},
+		{name: "next step within skew", code: code(step + 1), wantStep: step + 1, wantOK: true},
+		{name: "outside skew", code: code(step - 2)},
+		{name: "replayed code", code: code(step), lastStep: step},
+		{name: "code older than the last used one", code: code(step - 1), lastStep: step},
+		{name: "wrong length", code: "12345"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, gotOK := Validate(secret, tt.code, now, 1, tt.lastStep)
+			if gotOK != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("Validate() = %v, %v, want %v, %v", gotStep, gotOK, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := decodeSecret(secret)
+	if err != nil || len(key) != secretSize {
+		t.Fatalf("secret %q decodes to %d bytes, err = %v", secret, len(key), err)
+	}
+
+	uri := URI("Gophermart", "alice", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Gophermart:alice?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("URI() = %v", uri)
+	}
+}